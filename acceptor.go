@@ -1,6 +1,7 @@
 package acceptor
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -19,7 +20,7 @@ const (
 
 const (
 	HeadLength        = 4
-	MaxPacketSize     = 1 << 24 //16MB
+	MaxPacketSize     = 1<<24 - 1 // the largest length the 3-byte header holds
 	IOBufferBytesSize = 4096
 )
 
@@ -42,6 +43,9 @@ type Acceptor interface {
 
 type Conn interface {
 	GetNextMessage() (b []byte, err error)
+	GetNextMessageContext(ctx context.Context) (b []byte, err error)
+	ReadPacket() (*Packet, error)
+	WritePacket(typ Type, data []byte) error
 	net.Conn
 }
 
@@ -0,0 +1,385 @@
+// Package acceptortest is a conformance suite for Acceptor implementations.
+//
+// A transport package runs it from its tests with a Factory telling how to
+// create its acceptor and dial it:
+//
+//	func TestConformance(t *testing.T) {
+//		acceptortest.Run(t, acceptortest.Factory{
+//			New:    func() acceptor.Acceptor { return NewTCP("127.0.0.1:0") },
+//			Dial:   func(addr string) (acceptor.Conn, error) { ... },
+//			Stream: true,
+//		})
+//	}
+//
+// The suite expects the acceptor to deliver a connection as soon as a client
+// dials it, before anything is written, and dialing to fail once it stopped.
+// Transports working otherwise tell it with FirstPacket and Connectionless.
+// Every packet must arrive, in order, and closing an end must be noticed by
+// the other one, which rules out datagram transports such as udp.
+package acceptortest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Timeout bounds how long the suite waits for something to happen.
+const Timeout = time.Second
+
+type Factory struct {
+	// New returns an acceptor listening on a free address once ListenAndServe
+	// is called.
+	New func() acceptor.Acceptor
+	// Dial connects a client to the address returned by GetAddr.
+	Dial func(addr string) (acceptor.Conn, error)
+	// Stream tells the transport is a byte stream: a packet may be written in
+	// several parts and several packets at once. Message based transports
+	// take every write as one packet.
+	Stream bool
+	// FirstPacket tells the acceptor only delivers a connection once its
+	// client sent something. The suite then writes a heartbeat right after
+	// dialing, which the server reads before the test goes on.
+	FirstPacket bool
+	// Connectionless tells dialing doesn't reach the acceptor, so it still
+	// succeeds once the acceptor stopped. The suite then checks a stopped
+	// acceptor delivers no connection instead.
+	Connectionless bool
+}
+
+// Run runs the conformance suite against the transport of factory.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(*testing.T, Factory)
+	}{
+		{"ListenAndStop", testListenAndStop},
+		{"Addresses", testAddresses},
+		{"Packets", testPackets},
+		{"Fragmented", testFragmented},
+		{"Coalesced", testCoalesced},
+		{"Oversized", testOversized},
+		{"InvalidPackets", testInvalidPackets},
+		{"ConcurrentWrites", testConcurrentWrites},
+		{"ReadDeadline", testReadDeadline},
+		{"WriteDeadline", testWriteDeadline},
+		{"Context", testContext},
+		{"PeerClose", testPeerClose},
+		{"Close", testClose},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, factory)
+		})
+	}
+}
+
+// listen starts an acceptor of factory, stopped when the test ends.
+func listen(t *testing.T, factory Factory) acceptor.Acceptor {
+	t.Helper()
+	a := factory.New()
+	require.Equal(t, "", a.GetAddr(), "GetAddr must be empty before listening")
+	go a.ListenAndServe()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, Timeout)
+	t.Cleanup(a.Stop)
+	return a
+}
+
+// dial connects a client to addr, writing the first packet when the acceptor
+// waits for one.
+func dial(factory Factory, addr string) (acceptor.Conn, error) {
+	client, err := factory.Dial(addr)
+	if err != nil || !factory.FirstPacket {
+		return client, err
+	}
+	if err := client.WritePacket(acceptor.Heartbeat, nil); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// connect returns both ends of a new connection, closed when the test ends.
+func connect(t *testing.T, factory Factory) (server, client acceptor.Conn) {
+	t.Helper()
+	a := listen(t, factory)
+	client, err := dial(factory, a.GetAddr())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	select {
+	case server = <-a.GetConnChan():
+	case <-time.After(Timeout):
+		t.Fatal("no connection received")
+	}
+	t.Cleanup(func() { server.Close() })
+	if factory.FirstPacket {
+		p, err := server.ReadPacket()
+		require.NoError(t, err)
+		require.Equal(t, acceptor.Type(acceptor.Heartbeat), p.Type)
+	}
+	return server, client
+}
+func testListenAndStop(t *testing.T, factory Factory) {
+	a := factory.New()
+	assert.NotNil(t, a.GetConnChan())
+	assert.Equal(t, "", a.GetAddr())
+	go a.ListenAndServe()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, Timeout)
+	addr := a.GetAddr()
+	client, err := dial(factory, addr)
+	require.NoError(t, err)
+	client.Close()
+	select {
+	case server := <-a.GetConnChan():
+		server.Close()
+	case <-time.After(Timeout):
+		t.Fatal("no connection received")
+	}
+
+	a.Stop()
+	if !factory.Connectionless {
+		utils.ShouldEventuallyReturn(t, func() bool {
+			client, err := dial(factory, addr)
+			if err == nil {
+				client.Close()
+			}
+			return err != nil
+		}, true, 10*time.Millisecond, Timeout)
+		return
+	}
+	if client, err := dial(factory, addr); err == nil {
+		defer client.Close()
+	}
+	select {
+	case server, ok := <-a.GetConnChan():
+		if ok {
+			server.Close()
+			t.Fatal("a connection was received after stopping")
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+func testAddresses(t *testing.T, factory Factory) {
+	server, client := connect(t, factory)
+	require.NotNil(t, server.LocalAddr())
+	require.NotNil(t, server.RemoteAddr())
+	assert.Equal(t, client.LocalAddr().String(), server.RemoteAddr().String())
+	assert.Equal(t, client.RemoteAddr().String(), server.LocalAddr().String())
+	assert.Equal(t, server.LocalAddr().Network(), server.RemoteAddr().Network())
+}
+func testPackets(t *testing.T, factory Factory) {
+	server, client := connect(t, factory)
+	big := bytes.Repeat([]byte{0xab}, 256*1024)
+	// the big packet may not fit in the buffers of the transport before the
+	// server reads
+	written := make(chan error, 1)
+	go func() {
+		for _, typ := range []acceptor.Type{acceptor.Handshake, acceptor.HandshakeAck, acceptor.Heartbeat, acceptor.Data, acceptor.Kick} {
+			if err := client.WritePacket(typ, []byte{byte(typ)}); err != nil {
+				written <- err
+				return
+			}
+		}
+		if err := client.WritePacket(acceptor.Data, nil); err != nil {
+			written <- err
+			return
+		}
+		written <- client.WritePacket(acceptor.Data, big)
+	}()
+
+	msg, err := server.GetNextMessage()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{acceptor.Handshake, 0x00, 0x00, 0x01, acceptor.Handshake}, msg)
+	for _, typ := range []acceptor.Type{acceptor.HandshakeAck, acceptor.Heartbeat, acceptor.Data, acceptor.Kick} {
+		p, err := server.ReadPacket()
+		require.NoError(t, err)
+		assert.Equal(t, typ, p.Type)
+		assert.Equal(t, 1, p.Length)
+		assert.Equal(t, []byte{byte(typ)}, p.Data)
+	}
+	p, err := server.ReadPacket()
+	require.NoError(t, err)
+	assert.Equal(t, 0, p.Length)
+	assert.Empty(t, p.Data)
+	p, err = server.ReadPacket()
+	require.NoError(t, err)
+	assert.Equal(t, len(big), p.Length)
+	assert.Equal(t, big, p.Data)
+	require.NoError(t, <-written)
+
+	require.NoError(t, server.WritePacket(acceptor.Data, []byte("pong")))
+	p, err = client.ReadPacket()
+	require.NoError(t, err)
+	assert.Equal(t, acceptor.Type(acceptor.Data), p.Type)
+	assert.Equal(t, []byte("pong"), p.Data)
+}
+func testFragmented(t *testing.T, factory Factory) {
+	if !factory.Stream {
+		t.Skip("packets of message based transports can't be fragmented")
+	}
+	server, client := connect(t, factory)
+	go func() {
+		for _, b := range []byte{0x04, 0x00, 0x00, 0x03, 0x01, 0x02, 0x03} {
+			if _, err := client.Write([]byte{b}); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	msg, err := server.GetNextMessage()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x03, 0x01, 0x02, 0x03}, msg)
+}
+func testCoalesced(t *testing.T, factory Factory) {
+	if !factory.Stream {
+		t.Skip("message based transports take every write as one packet")
+	}
+	server, client := connect(t, factory)
+	_, err := client.Write([]byte{0x04, 0x00, 0x00, 0x01, 0x01, 0x03, 0x00, 0x00, 0x00, 0x04, 0x00})
+	require.NoError(t, err)
+	_, err = client.Write([]byte{0x00, 0x01, 0x02})
+	require.NoError(t, err)
+	for _, expected := range [][]byte{
+		{0x04, 0x00, 0x00, 0x01, 0x01},
+		{0x03, 0x00, 0x00, 0x00},
+		{0x04, 0x00, 0x00, 0x01, 0x02},
+	} {
+		msg, err := server.GetNextMessage()
+		require.NoError(t, err)
+		assert.Equal(t, expected, msg)
+	}
+}
+func testOversized(t *testing.T, factory Factory) {
+	server, client := connect(t, factory)
+	assert.Equal(t, acceptor.ErrPacketSizeExceed, server.WritePacket(acceptor.Data, make([]byte, acceptor.MaxPacketSize+1)))
+	assert.Equal(t, acceptor.ErrPacketSizeExceed, client.WritePacket(acceptor.Data, make([]byte, acceptor.MaxPacketSize+1)))
+	// nothing was written
+	require.NoError(t, client.WritePacket(acceptor.Heartbeat, nil))
+	p, err := server.ReadPacket()
+	require.NoError(t, err)
+	assert.Equal(t, acceptor.Type(acceptor.Heartbeat), p.Type)
+}
+func testInvalidPackets(t *testing.T, factory Factory) {
+	tables := []struct {
+		name  string
+		write []byte
+		err   error
+	}{
+		{"wrong_type", []byte{0x09, 0x00, 0x00, 0x00}, acceptor.ErrWrongPacketType},
+		{"zero_type", []byte{0x00, 0x00, 0x00, 0x00}, acceptor.ErrWrongPacketType},
+		{"truncated", []byte{0x04, 0x00, 0x00, 0x02, 0x01}, acceptor.ErrReceivedMsgSmallerThanExpected},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			server, client := connect(t, factory)
+			assert.Equal(t, acceptor.ErrWrongPacketType, client.WritePacket(0x09, nil))
+			_, err := client.Write(table.write)
+			require.NoError(t, err)
+			// a stream ends the truncated packet by closing
+			client.Close()
+			_, err = server.GetNextMessage()
+			assert.Equal(t, table.err, err)
+		})
+	}
+}
+func testConcurrentWrites(t *testing.T, factory Factory) {
+	server, client := connect(t, factory)
+	const writers, packets = 8, 32
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < packets; i++ {
+				data := bytes.Repeat([]byte{byte(w), byte(i)}, 512)
+				assert.NoError(t, server.WritePacket(acceptor.Data, data))
+			}
+		}(w)
+	}
+	next := make([]int, writers)
+	for n := 0; n < writers*packets; n++ {
+		p, err := client.ReadPacket()
+		require.NoError(t, err)
+		require.Len(t, p.Data, 1024)
+		w, i := int(p.Data[0]), int(p.Data[1])
+		require.Equal(t, bytes.Repeat([]byte{byte(w), byte(i)}, 512), p.Data, "packets must not interleave")
+		// the packets of one writer keep their order
+		require.Equal(t, next[w], i)
+		next[w]++
+	}
+	wg.Wait()
+}
+func testReadDeadline(t *testing.T, factory Factory) {
+	server, _ := connect(t, factory)
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	start := time.Now()
+	_, err := server.GetNextMessage()
+	assertTimeout(t, err)
+	assert.Less(t, time.Since(start), Timeout)
+}
+func testWriteDeadline(t *testing.T, factory Factory) {
+	server, _ := connect(t, factory)
+	require.NoError(t, server.SetWriteDeadline(time.Now().Add(-time.Second)))
+	assertTimeout(t, server.WritePacket(acceptor.Data, []byte{0x01}))
+}
+func assertTimeout(t *testing.T, err error) {
+	t.Helper()
+	var netErr net.Error
+	if assert.True(t, errors.As(err, &netErr), "%v is not a net.Error", err) {
+		assert.True(t, netErr.Timeout(), "%v is not a timeout", err)
+	}
+}
+func testContext(t *testing.T, factory Factory) {
+	server, client := connect(t, factory)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := server.GetNextMessageContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = server.GetNextMessageContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// the interrupted read lost nothing
+	require.NoError(t, client.WritePacket(acceptor.Data, []byte{0x01}))
+	msg, err := server.GetNextMessageContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x01}, msg)
+}
+func testPeerClose(t *testing.T, factory Factory) {
+	server, client := connect(t, factory)
+	require.NoError(t, client.WritePacket(acceptor.Data, []byte{0x01}))
+	require.NoError(t, client.Close())
+	// packets written before closing are read first
+	_, err := server.GetNextMessage()
+	require.NoError(t, err)
+	_, err = server.GetNextMessage()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+
+	server, client = connect(t, factory)
+	require.NoError(t, server.Close())
+	_, err = client.GetNextMessage()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+}
+func testClose(t *testing.T, factory Factory) {
+	server, _ := connect(t, factory)
+	require.NoError(t, server.Close())
+	assert.Error(t, server.WritePacket(acceptor.Data, []byte{0x01}))
+	_, err := server.GetNextMessage()
+	assert.Error(t, err)
+	// closing twice doesn't panic
+	assert.NotPanics(t, func() { server.Close() })
+}
@@ -0,0 +1,218 @@
+// Package bridge connects the clients of an acceptor, typically WebSocket
+// ones, to a backend that only speaks the raw TCP framing.
+//
+// Every client gets its own backend connection, which starts with a PROXY
+// protocol header carrying the client address. Packets are validated in both
+// directions; a kick from the backend reaches the client before the bridge
+// closes, and a client breaking the protocol is kicked.
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/proxyproto"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	logger "github.com/gotechbook/gotechbook-framework-logger"
+	"net"
+	"time"
+)
+
+var (
+	ErrInvalidPacket = errors.New("bridge: invalid packet")
+	ErrBackend       = errors.New("bridge: backend unavailable")
+)
+
+type Config struct {
+	// Backend is the TCP address of the backend.
+	Backend string
+	// DialTimeout bounds the dial to the backend, zero doesn't.
+	DialTimeout time.Duration
+	// ProxyProtocol is the version of the PROXY protocol header sent to the
+	// backend, 1 or 2, zero sends none.
+	ProxyProtocol int
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		DialTimeout:   5 * time.Second,
+		ProxyProtocol: 2,
+	}
+}
+
+// Bridge bridges the connections of an acceptor to the backend.
+type Bridge struct {
+	acceptor *acceptor.WrapAcceptor
+	config   Config
+}
+
+func NewBridge(a acceptor.Acceptor, config Config) *Bridge {
+	b := &Bridge{config: config}
+	b.acceptor = acceptor.NewWrapAcceptor(a, func(_ int, conn acceptor.Conn) (acceptor.Conn, error) {
+		if err := b.Serve(conn); err != nil {
+			logger.Log.Errorf("Failed to bridge %s: %s", conn.RemoteAddr(), err.Error())
+		}
+		return nil, nil
+	})
+	return b
+}
+
+// ListenAndServe runs the acceptor and bridges its connections until Stop.
+func (b *Bridge) ListenAndServe() {
+	b.acceptor.ListenAndServe()
+}
+
+// Stop stops accepting, the bridged connections go on until either end
+// closes.
+func (b *Bridge) Stop() {
+	b.acceptor.Stop()
+}
+func (b *Bridge) GetAddr() string {
+	return b.acceptor.GetAddr()
+}
+
+// Serve bridges conn to a new backend connection until either end closes.
+// It only returns an error when the backend can't be reached or a packet is
+// invalid.
+func (b *Bridge) Serve(conn acceptor.Conn) error {
+	defer conn.Close()
+	backend, err := b.dial(conn)
+	if err != nil {
+		acceptor.SendKick(conn, &acceptor.KickReason{Code: acceptor.KickCodeServerShutdown, Message: "backend unavailable"})
+		return fmt.Errorf("%w: %s", ErrBackend, err.Error())
+	}
+	defer backend.Close()
+
+	clientDone := make(chan error, 1)
+	go func() {
+		err := toBackend(conn, backend)
+		if err != nil {
+			backend.Close()
+		} else {
+			// let the backend see the end of the client and finish writing
+			flush(backend)
+		}
+		clientDone <- err
+	}()
+	backendErr := toClient(backend, conn)
+	if clientErr := <-clientDone; clientErr != nil {
+		return clientErr
+	}
+	return backendErr
+}
+
+// dial connects to the backend and sends it the PROXY protocol header of
+// conn. Addresses the header can't carry are sent as a LOCAL command.
+func (b *Bridge) dial(conn acceptor.Conn) (acceptor.Conn, error) {
+	d := net.Dialer{Timeout: b.config.DialTimeout}
+	c, err := d.Dial("tcp", b.config.Backend)
+	if err != nil {
+		return nil, err
+	}
+	if b.config.ProxyProtocol != 0 {
+		h := &proxyproto.Header{
+			Version:     b.config.ProxyProtocol,
+			Command:     proxyproto.Proxy,
+			Source:      conn.RemoteAddr(),
+			Destination: conn.LocalAddr(),
+		}
+		header, err := h.Format()
+		if err != nil {
+			h.Command = proxyproto.Local
+			header, err = h.Format()
+		}
+		if err == nil {
+			_, err = c.Write(header)
+		}
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return tcp.NewConn(c), nil
+}
+
+// toBackend forwards the packets of the client until it closes. A client
+// sending an invalid packet is kicked.
+func toBackend(conn, backend acceptor.Conn) error {
+	for {
+		msg, err := conn.GetNextMessage()
+		if err == nil {
+			err = validate(msg)
+		}
+		if err != nil {
+			if !isProtocolError(err) {
+				return nil
+			}
+			acceptor.SendKick(conn, &acceptor.KickReason{Code: acceptor.KickCodeProtocolError, Message: "invalid packet"})
+			return fmt.Errorf("%w from client: %s", ErrInvalidPacket, err.Error())
+		}
+		if _, err := backend.Write(msg); err != nil {
+			return nil
+		}
+	}
+}
+
+// toClient forwards the packets of the backend until it closes, then closes
+// the client gracefully so that a last kick gets through.
+func toClient(backend, conn acceptor.Conn) error {
+	for {
+		msg, err := backend.GetNextMessage()
+		if err == nil {
+			err = validate(msg)
+		}
+		if err == acceptor.ErrConnectionClosed {
+			flush(conn)
+			return nil
+		}
+		if err != nil {
+			conn.Close()
+			if !isProtocolError(err) {
+				return nil
+			}
+			return fmt.Errorf("%w from backend: %s", ErrInvalidPacket, err.Error())
+		}
+		if _, err := conn.Write(msg); err != nil {
+			return nil
+		}
+		if msg[0] == acceptor.Kick {
+			flush(conn)
+			return nil
+		}
+	}
+}
+
+// flush shuts down the writing side of conn and lets the client close its
+// side, for up to acceptor.KickFlushTimeout.
+func flush(conn acceptor.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok && cw.CloseWrite() == nil {
+		conn.SetReadDeadline(time.Now().Add(acceptor.KickFlushTimeout))
+		return
+	}
+	conn.Close()
+}
+
+// isProtocolError tells if err comes from reading bytes that aren't packets.
+func isProtocolError(err error) bool {
+	switch err {
+	case acceptor.ErrInvalidHeader, acceptor.ErrWrongPacketType, acceptor.ErrPacketSizeExceed,
+		acceptor.ErrReceivedMsgSmallerThanExpected, acceptor.ErrReceivedMsgBiggerThanExpected:
+		return true
+	}
+	return false
+}
+
+// validate checks msg is a single packet with a valid header.
+func validate(msg []byte) error {
+	if len(msg) < acceptor.HeadLength {
+		return acceptor.ErrInvalidHeader
+	}
+	size, _, err := acceptor.ParseHeader(msg[:acceptor.HeadLength])
+	if err != nil {
+		return err
+	}
+	if size != len(msg)-acceptor.HeadLength {
+		return acceptor.ErrInvalidHeader
+	}
+	return nil
+}
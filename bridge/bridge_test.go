@@ -0,0 +1,244 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/proxyproto"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	"github.com/gotechbook/gotechbook-framework-acceptor/ws"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// setup runs a TCP backend reading PROXY protocol headers and a WebSocket
+// bridge to it.
+func setup(t *testing.T, version int) (*tcp.TCP, *Bridge) {
+	t.Helper()
+	config := proxyproto.NewDefaultConfig()
+	config.TrustedCIDRs, _ = proxyproto.ParseCIDRs("127.0.0.0/8")
+	backend := tcp.NewTCP("127.0.0.1:0")
+	backend.UseProxyProtocol(config)
+	go backend.ListenAndServe()
+	t.Cleanup(backend.Stop)
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return backend.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+
+	bridgeConfig := NewDefaultConfig()
+	bridgeConfig.Backend = backend.GetAddr()
+	bridgeConfig.ProxyProtocol = version
+	b := NewBridge(ws.NewWS("127.0.0.1:0"), bridgeConfig)
+	go b.ListenAndServe()
+	t.Cleanup(b.Stop)
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return b.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+	return backend, b
+}
+
+// connect dials the bridge and returns the client and the backend side.
+func connect(t *testing.T, backend *tcp.TCP, b *Bridge) (*ws.Conn, acceptor.Conn) {
+	t.Helper()
+	c, _, err := websocket.DefaultDialer.Dial("ws://"+b.GetAddr(), nil)
+	assert.NoError(t, err)
+	client, err := ws.NewWSConn(c)
+	assert.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	conn := utils.ShouldEventuallyReceive(t, backend.GetConnChan(), time.Second).(acceptor.Conn)
+	t.Cleanup(func() { conn.Close() })
+	return client, conn
+}
+
+func TestBridge(t *testing.T) {
+	tables := []struct {
+		name    string
+		version int
+	}{
+		{"test_1", 1},
+		{"test_2", 2},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			backend, b := setup(t, table.version)
+			client, conn := connect(t, backend, b)
+			// the backend sees the client address
+			assert.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+
+			assert.NoError(t, client.WritePacket(acceptor.Handshake, []byte("{}")))
+			assert.NoError(t, client.WritePacket(acceptor.Data, []byte{0x01}))
+			p, err := conn.ReadPacket()
+			assert.NoError(t, err)
+			assert.Equal(t, acceptor.Type(acceptor.Handshake), p.Type)
+			p, err = conn.ReadPacket()
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{0x01}, p.Data)
+
+			assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x02}))
+			assert.NoError(t, conn.WritePacket(acceptor.Heartbeat, nil))
+			p, err = client.ReadPacket()
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{0x02}, p.Data)
+			p, err = client.ReadPacket()
+			assert.NoError(t, err)
+			assert.Equal(t, acceptor.Type(acceptor.Heartbeat), p.Type)
+		})
+	}
+}
+
+func TestBridgeWithoutProxyProtocol(t *testing.T) {
+	backend := tcp.NewTCP("127.0.0.1:0")
+	go backend.ListenAndServe()
+	defer backend.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return backend.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+	config := NewDefaultConfig()
+	config.Backend = backend.GetAddr()
+	config.ProxyProtocol = 0
+	b := NewBridge(ws.NewWS("127.0.0.1:0"), config)
+	go b.ListenAndServe()
+	defer b.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return b.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+
+	client, conn := connect(t, backend, b)
+	assert.NoError(t, client.WritePacket(acceptor.Data, []byte{0x01}))
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, p.Data)
+}
+
+func TestBackendKick(t *testing.T) {
+	backend, b := setup(t, 2)
+	client, conn := connect(t, backend, b)
+
+	done := make(chan error)
+	go func() {
+		done <- acceptor.SendKick(conn, &acceptor.KickReason{Code: acceptor.KickCodeDuplicateSession})
+	}()
+	p, err := client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.Type(acceptor.Kick), p.Type)
+	reason, err := acceptor.ParseKick(p.Data)
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.KickCodeDuplicateSession, reason.Code)
+	_, err = client.ReadPacket()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+	client.Close()
+	assert.Nil(t, utils.ShouldEventuallyReceive(t, done, time.Second))
+}
+
+func TestBackendClose(t *testing.T) {
+	backend, b := setup(t, 2)
+	client, conn := connect(t, backend, b)
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x01}))
+	conn.Close()
+	// what the backend wrote before closing still arrives
+	p, err := client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, p.Data)
+	_, err = client.ReadPacket()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+}
+
+func TestClientClose(t *testing.T) {
+	backend, b := setup(t, 2)
+	client, conn := connect(t, backend, b)
+	client.Close()
+	_, err := conn.GetNextMessage()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+	// only the writing side of the backend connection was shut down
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x01}))
+}
+
+func TestZeroDialTimeout(t *testing.T) {
+	backend, _ := setup(t, 2)
+	config := NewDefaultConfig()
+	config.Backend = backend.GetAddr()
+	config.DialTimeout = 0
+	b := NewBridge(ws.NewWS("127.0.0.1:0"), config)
+	go b.ListenAndServe()
+	defer b.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return b.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+
+	client, conn := connect(t, backend, b)
+	assert.NoError(t, client.WritePacket(acceptor.Data, []byte{0x01}))
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, p.Data)
+}
+
+func TestInvalidPackets(t *testing.T) {
+	t.Run("client", func(t *testing.T) {
+		backend, b := setup(t, 2)
+		client, conn := connect(t, backend, b)
+		_, err := client.Write([]byte{0x09, 0x00, 0x00, 0x00})
+		assert.NoError(t, err)
+		p, err := client.ReadPacket()
+		assert.NoError(t, err)
+		assert.Equal(t, acceptor.Type(acceptor.Kick), p.Type)
+		reason, err := acceptor.ParseKick(p.Data)
+		assert.NoError(t, err)
+		assert.Equal(t, acceptor.KickCodeProtocolError, reason.Code)
+		client.Close()
+		_, err = conn.GetNextMessage()
+		assert.Equal(t, acceptor.ErrConnectionClosed, err)
+	})
+	t.Run("backend", func(t *testing.T) {
+		backend, b := setup(t, 2)
+		client, conn := connect(t, backend, b)
+		_, err := conn.Write([]byte{0x09, 0x00, 0x00, 0x00})
+		assert.NoError(t, err)
+		_, err = client.ReadPacket()
+		assert.Error(t, err)
+		_, err = conn.GetNextMessage()
+		assert.Equal(t, acceptor.ErrConnectionClosed, err)
+	})
+}
+
+func TestBackendUnavailable(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Backend = "127.0.0.1:1"
+	b := NewBridge(ws.NewWS("127.0.0.1:0"), config)
+	go b.ListenAndServe()
+	defer b.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return b.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+
+	c, _, err := websocket.DefaultDialer.Dial("ws://"+b.GetAddr(), nil)
+	assert.NoError(t, err)
+	client, err := ws.NewWSConn(c)
+	assert.NoError(t, err)
+	defer client.Close()
+	p, err := client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.Type(acceptor.Kick), p.Type)
+	reason, err := acceptor.ParseKick(p.Data)
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.KickCodeServerShutdown, reason.Code)
+}
+
+func TestValidate(t *testing.T) {
+	tables := []struct {
+		name string
+		msg  []byte
+		err  error
+	}{
+		{"test_1", []byte{0x04, 0x00, 0x00, 0x01, 0x01}, nil},
+		{"test_2", []byte{0x04, 0x00, 0x00}, acceptor.ErrInvalidHeader},
+		{"test_3", []byte{0x09, 0x00, 0x00, 0x00}, acceptor.ErrWrongPacketType},
+		{"test_4", []byte{0x04, 0x00, 0x00, 0x02, 0x01}, acceptor.ErrInvalidHeader},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			assert.Equal(t, table.err, validate(table.msg))
+		})
+	}
+}
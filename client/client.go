@@ -0,0 +1,377 @@
+// Package client connects to the acceptors of this module, for bots, load
+// tests and Go clients.
+//
+// Dial takes a tcp://, tls://, ws:// or wss:// URL, runs the handshake and
+// returns a Conn reading and writing packets. Server heartbeats are answered
+// in the background and a lost connection is dialed again with exponential
+// backoff, handshake included.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	"github.com/gotechbook/gotechbook-framework-acceptor/ws"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnsupportedScheme = errors.New("client: unsupported scheme")
+	ErrHandshakeFailed   = errors.New("client: handshake failed")
+	ErrDisconnected      = errors.New("client: disconnected")
+)
+
+// KickError is returned once the server kicked the client. A kicked client
+// doesn't reconnect.
+type KickError struct {
+	Reason *acceptor.KickReason
+}
+
+func (e *KickError) Error() string {
+	return fmt.Sprintf("client: kicked with code %d: %s", e.Reason.Code, e.Reason.Message)
+}
+
+type Config struct {
+	// Handshake is sent when connecting, nil skips the handshake for servers
+	// which don't use a HandshakeAcceptor.
+	Handshake *acceptor.HandshakeData
+	// HandshakeTimeout bounds how long the server may take to answer the handshake.
+	HandshakeTimeout time.Duration
+	// TLSConfig is used by tls:// and wss:// URLs.
+	TLSConfig *tls.Config
+	// Header is sent with the upgrade request of ws:// and wss:// URLs.
+	Header http.Header
+	// Reconnect dials again when the connection is lost.
+	Reconnect bool
+	// MinBackoff and MaxBackoff bound the wait between reconnection attempts,
+	// which doubles after each failed attempt.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts is how many times reconnecting is attempted in a row before
+	// giving up, zero never gives up.
+	MaxAttempts int
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		Handshake: &acceptor.HandshakeData{
+			Sys: acceptor.HandshakeClientData{Platform: "go", LibVersion: "1.0.0"},
+		},
+		HandshakeTimeout: 5 * time.Second,
+		Reconnect:        true,
+		MinBackoff:       100 * time.Millisecond,
+		MaxBackoff:       30 * time.Second,
+	}
+}
+
+// withDefaults replaces the durations of config a connection can't run with
+// by their default value. A zero backoff would reconnect in a busy loop.
+func (config Config) withDefaults() Config {
+	defaults := NewDefaultConfig()
+	if config.HandshakeTimeout <= 0 {
+		config.HandshakeTimeout = defaults.HandshakeTimeout
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaults.MinBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaults.MaxBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = config.MinBackoff
+	}
+	return config
+}
+
+// Conn is a client connection. It is safe to write from several goroutines,
+// packets must be read by one.
+type Conn struct {
+	url       *url.URL
+	config    Config
+	packets   chan *acceptor.Packet
+	err       error
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu   sync.Mutex
+	conn acceptor.Conn
+	ack  *acceptor.HandshakeAckData
+}
+
+// Dial connects to rawURL with the default config.
+func Dial(ctx context.Context, rawURL string) (*Conn, error) {
+	return DialConfig(ctx, rawURL, NewDefaultConfig())
+}
+
+// DialConfig connects to rawURL, the zero durations of config take their
+// default value. ctx bounds the first connection only, later reconnections
+// last until Close is called.
+func DialConfig(ctx context.Context, rawURL string, config Config) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{
+		url:     u,
+		config:  config.withDefaults(),
+		packets: make(chan *acceptor.Packet),
+		done:    make(chan struct{}),
+	}
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go c.run(conn)
+	return c, nil
+}
+
+// connect dials the transport and runs the handshake.
+func (c *Conn) connect(ctx context.Context) (acceptor.Conn, error) {
+	conn, err := dial(ctx, c.url, c.config)
+	if err != nil {
+		return nil, err
+	}
+	var ack *acceptor.HandshakeAckData
+	if c.config.Handshake != nil {
+		if ack, err = handshake(ctx, conn, c.config); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		conn.Close()
+		return nil, acceptor.ErrConnectionClosed
+	default:
+	}
+	c.conn, c.ack = conn, ack
+	return conn, nil
+}
+func dial(ctx context.Context, u *url.URL, config Config) (acceptor.Conn, error) {
+	switch u.Scheme {
+	case "tcp":
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+		return tcp.NewConn(conn), nil
+	case "tls":
+		d := tls.Dialer{Config: config.TLSConfig}
+		conn, err := d.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+		return tcp.NewConn(conn), nil
+	case "ws", "wss":
+		d := websocket.Dialer{
+			TLSClientConfig: config.TLSConfig,
+			ReadBufferSize:  acceptor.IOBufferBytesSize,
+			WriteBufferSize: acceptor.IOBufferBytesSize,
+		}
+		conn, _, err := d.DialContext(ctx, u.String(), config.Header)
+		if err != nil {
+			return nil, err
+		}
+		return ws.NewWSConn(conn)
+	}
+	return nil, ErrUnsupportedScheme
+}
+
+// handshake sends the Handshake packet and waits for the HandshakeAck.
+func handshake(ctx context.Context, conn acceptor.Conn, config Config) (*acceptor.HandshakeAckData, error) {
+	payload, err := json.Marshal(config.Handshake)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.WritePacket(acceptor.Handshake, payload); err != nil {
+		return nil, err
+	}
+	if config.HandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.HandshakeTimeout)
+		defer cancel()
+	}
+	for {
+		b, err := conn.GetNextMessageContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p := &acceptor.Packet{Type: acceptor.Type(b[0]), Length: len(b) - acceptor.HeadLength, Data: b[acceptor.HeadLength:]}
+		switch p.Type {
+		case acceptor.Heartbeat:
+			continue
+		case acceptor.Kick:
+			return nil, kickError(p.Data)
+		case acceptor.HandshakeAck:
+			ack := &acceptor.HandshakeAckData{}
+			if err := json.Unmarshal(p.Data, ack); err != nil || ack.Code != acceptor.HandshakeCodeOK {
+				return nil, ErrHandshakeFailed
+			}
+			return ack, nil
+		}
+		return nil, ErrHandshakeFailed
+	}
+}
+func kickError(data []byte) error {
+	reason, err := acceptor.ParseKick(data)
+	if err != nil {
+		reason = &acceptor.KickReason{}
+	}
+	return &KickError{Reason: reason}
+}
+
+// run reads the connection, reconnecting when it is lost, until it can't go on.
+func (c *Conn) run(conn acceptor.Conn) {
+	defer close(c.packets)
+	for {
+		err := c.read(conn)
+		conn.Close()
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		if c.closed() {
+			c.err = acceptor.ErrConnectionClosed
+			return
+		}
+		if _, kicked := err.(*KickError); kicked || !c.config.Reconnect {
+			c.err = err
+			return
+		}
+		if conn, err = c.reconnect(); err != nil {
+			c.err = err
+			return
+		}
+	}
+}
+
+// read delivers the packets of conn and answers its heartbeats.
+func (c *Conn) read(conn acceptor.Conn) error {
+	for {
+		p, err := conn.ReadPacket()
+		if err != nil {
+			return err
+		}
+		switch p.Type {
+		case acceptor.Heartbeat:
+			conn.WritePacket(acceptor.Heartbeat, nil)
+			continue
+		case acceptor.Kick:
+			return kickError(p.Data)
+		}
+		select {
+		case c.packets <- p:
+		case <-c.done:
+			return acceptor.ErrConnectionClosed
+		}
+	}
+}
+func (c *Conn) reconnect() (acceptor.Conn, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	var err error
+	for attempt := 0; c.config.MaxAttempts == 0 || attempt < c.config.MaxAttempts; attempt++ {
+		timer := time.NewTimer(backoff(c.config.MinBackoff, c.config.MaxBackoff, attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, acceptor.ErrConnectionClosed
+		}
+		var conn acceptor.Conn
+		if conn, err = c.connect(ctx); err == nil {
+			return conn, nil
+		}
+		if _, kicked := err.(*KickError); kicked {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// backoff returns the wait before attempt, doubling from min up to max, with
+// a random jitter of up to half of it so clients don't reconnect together.
+func backoff(min, max time.Duration, attempt int) time.Duration {
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+func (c *Conn) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadPacket returns the next packet other than a heartbeat. Once the
+// connection is closed or lost for good it returns the reason, a *KickError
+// if the server kicked the client.
+func (c *Conn) ReadPacket() (*acceptor.Packet, error) {
+	p, ok := <-c.packets
+	if !ok {
+		return nil, c.err
+	}
+	return p, nil
+}
+
+// WritePacket sends a packet, it fails with ErrDisconnected while reconnecting.
+func (c *Conn) WritePacket(typ acceptor.Type, data []byte) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		if c.closed() {
+			return acceptor.ErrConnectionClosed
+		}
+		return ErrDisconnected
+	}
+	return conn.WritePacket(typ, data)
+}
+
+// HandshakeAck returns the answer of the server to the last handshake.
+func (c *Conn) HandshakeAck() *acceptor.HandshakeAckData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ack
+}
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		close(c.done)
+		conn := c.conn
+		c.mu.Unlock()
+		if conn != nil {
+			conn.Close()
+		}
+	})
+	return nil
+}
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	"github.com/gotechbook/gotechbook-framework-acceptor/ws"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func listen(t *testing.T, a acceptor.Acceptor) acceptor.Acceptor {
+	t.Helper()
+	config := acceptor.NewDefaultHandshakeConfig()
+	config.Heartbeat = 10 * time.Second
+	h := acceptor.NewHandshakeAcceptor(a, config)
+	go h.ListenAndServe()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return h.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	return h
+}
+
+func testConfig() Config {
+	config := NewDefaultConfig()
+	config.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	config.MinBackoff = 10 * time.Millisecond
+	config.MaxBackoff = 20 * time.Millisecond
+	return config
+}
+
+func TestDial(t *testing.T) {
+	tables := []struct {
+		name     string
+		scheme   string
+		acceptor func() acceptor.Acceptor
+	}{
+		{"tcp", "tcp", func() acceptor.Acceptor { return tcp.NewTCP("127.0.0.1:0") }},
+		{"tls", "tls", func() acceptor.Acceptor {
+			return tcp.NewTCP("127.0.0.1:0", "../fixtures/server.crt", "../fixtures/server.key")
+		}},
+		{"ws", "ws", func() acceptor.Acceptor { return ws.NewWS("127.0.0.1:0") }},
+		{"wss", "wss", func() acceptor.Acceptor {
+			return ws.NewWS("127.0.0.1:0", "../fixtures/server.crt", "../fixtures/server.key")
+		}},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			a := listen(t, table.acceptor())
+			defer a.Stop()
+			c, err := DialConfig(context.Background(), fmt.Sprintf("%s://%s", table.scheme, a.GetAddr()), testConfig())
+			assert.NoError(t, err)
+			defer c.Close()
+			assert.Equal(t, 10, c.HandshakeAck().Sys.Heartbeat)
+
+			conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(*acceptor.HandshakeConn)
+			defer conn.Close()
+			assert.Equal(t, "go", conn.HandshakeData().Sys.Platform)
+
+			assert.NoError(t, c.WritePacket(acceptor.Data, []byte{0x01}))
+			p, err := conn.ReadPacket()
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{0x01}, p.Data)
+
+			// heartbeats are answered and not returned
+			assert.NoError(t, conn.WritePacket(acceptor.Heartbeat, nil))
+			p, err = conn.ReadPacket()
+			assert.NoError(t, err)
+			assert.Equal(t, acceptor.Type(acceptor.Heartbeat), p.Type)
+			assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x02}))
+			p, err = c.ReadPacket()
+			assert.NoError(t, err)
+			assert.Equal(t, acceptor.Type(acceptor.Data), p.Type)
+			assert.Equal(t, []byte{0x02}, p.Data)
+		})
+	}
+}
+
+func TestDialErrors(t *testing.T) {
+	_, err := Dial(context.Background(), "udp://127.0.0.1:1")
+	assert.Equal(t, ErrUnsupportedScheme, err)
+	_, err = Dial(context.Background(), "tcp://127.0.0.1:1")
+	assert.Error(t, err)
+
+	// a server without handshake doesn't answer
+	a := tcp.NewTCP("127.0.0.1:0")
+	go a.ListenAndServe()
+	defer a.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	config := testConfig()
+	config.HandshakeTimeout = 20 * time.Millisecond
+	_, err = DialConfig(context.Background(), "tcp://"+a.GetAddr(), config)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestDialWithoutHandshake(t *testing.T) {
+	a := tcp.NewTCP("127.0.0.1:0")
+	go a.ListenAndServe()
+	defer a.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	config := testConfig()
+	config.Handshake = nil
+	c, err := DialConfig(context.Background(), "tcp://"+a.GetAddr(), config)
+	assert.NoError(t, err)
+	defer c.Close()
+	assert.Nil(t, c.HandshakeAck())
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(acceptor.Conn)
+	defer conn.Close()
+	assert.NoError(t, c.WritePacket(acceptor.Data, nil))
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.Type(acceptor.Data), p.Type)
+}
+
+func TestReconnect(t *testing.T) {
+	a := listen(t, tcp.NewTCP("127.0.0.1:0"))
+	defer a.Stop()
+	c, err := DialConfig(context.Background(), "tcp://"+a.GetAddr(), testConfig())
+	assert.NoError(t, err)
+	defer c.Close()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(acceptor.Conn)
+	conn.Close()
+
+	// the client dials again and handshakes
+	conn = utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(acceptor.Conn)
+	defer conn.Close()
+	utils.ShouldEventuallyReturn(t, func() error {
+		return c.WritePacket(acceptor.Data, []byte{0x01})
+	}, nil, 10*time.Millisecond, time.Second)
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, p.Data)
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	a := listen(t, tcp.NewTCP("127.0.0.1:0"))
+	config := testConfig()
+	config.MaxAttempts = 2
+	c, err := DialConfig(context.Background(), "tcp://"+a.GetAddr(), config)
+	assert.NoError(t, err)
+	defer c.Close()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(acceptor.Conn)
+	a.Stop()
+	conn.Close()
+
+	_, err = c.ReadPacket()
+	assert.Error(t, err)
+	assert.Equal(t, ErrDisconnected, c.WritePacket(acceptor.Data, nil))
+}
+
+func TestKick(t *testing.T) {
+	a := listen(t, tcp.NewTCP("127.0.0.1:0"))
+	defer a.Stop()
+	c, err := DialConfig(context.Background(), "tcp://"+a.GetAddr(), testConfig())
+	assert.NoError(t, err)
+	defer c.Close()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(acceptor.Conn)
+
+	assert.NoError(t, acceptor.SendKick(conn, &acceptor.KickReason{Code: acceptor.KickCodeKicked, Message: "bye"}))
+	_, err = c.ReadPacket()
+	kickErr, ok := err.(*KickError)
+	assert.True(t, ok)
+	assert.Equal(t, &acceptor.KickReason{Code: acceptor.KickCodeKicked, Message: "bye"}, kickErr.Reason)
+	// a kicked client doesn't come back
+	select {
+	case <-a.GetConnChan():
+		t.Fatal("client reconnected after a kick")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestClose(t *testing.T) {
+	a := listen(t, tcp.NewTCP("127.0.0.1:0"))
+	defer a.Stop()
+	c, err := DialConfig(context.Background(), "tcp://"+a.GetAddr(), testConfig())
+	assert.NoError(t, err)
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(acceptor.Conn)
+	defer conn.Close()
+
+	assert.NoError(t, c.Close())
+	_, err = c.ReadPacket()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+	assert.Equal(t, acceptor.ErrConnectionClosed, c.WritePacket(acceptor.Data, nil))
+	_, err = conn.ReadPacket()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+}
+
+func TestConfigWithDefaults(t *testing.T) {
+	defaults := NewDefaultConfig()
+	config := Config{Reconnect: true}.withDefaults()
+	assert.Equal(t, defaults.HandshakeTimeout, config.HandshakeTimeout)
+	assert.Equal(t, defaults.MinBackoff, config.MinBackoff)
+	assert.Equal(t, defaults.MaxBackoff, config.MaxBackoff)
+
+	// the wait never shrinks below the min
+	config = Config{MinBackoff: time.Second, MaxBackoff: time.Millisecond}.withDefaults()
+	assert.Equal(t, time.Second, config.MaxBackoff)
+}
+
+func TestBackoff(t *testing.T) {
+	tables := []struct {
+		name    string
+		attempt int
+		max     time.Duration
+	}{
+		{"test_1", 0, 100 * time.Millisecond},
+		{"test_2", 1, 200 * time.Millisecond},
+		{"test_3", 3, 800 * time.Millisecond},
+		{"test_4", 10, time.Second},
+		{"test_5", 1000, time.Second},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			d := backoff(100*time.Millisecond, time.Second, table.attempt)
+			assert.True(t, d >= table.max/2 && d <= table.max, d)
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/client"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	"github.com/gotechbook/gotechbook-framework-acceptor/ws"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stampSize is the size of the send time at the start of each packet.
+const stampSize = 8
+
+// dialConcurrency bounds how many clients connect at the same time.
+const dialConcurrency = 64
+
+var ErrInvalidConfig = errors.New("acceptor-bench: invalid config")
+
+type Config struct {
+	// Transport is the acceptor started in process, tcp or ws, when Target
+	// is empty.
+	Transport string
+	// Target is the URL of a running acceptor, which must echo Data packets
+	// for latencies to be measured.
+	Target string
+	// Clients is the number of connections.
+	Clients int
+	// Rate is the number of packets each client sends per second.
+	Rate float64
+	// Size is the size of the packets data, at least 8 bytes.
+	Size int
+	// Duration is how long the clients send for.
+	Duration time.Duration
+	// Drain is how long to wait for the echoes of the last packets.
+	Drain time.Duration
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		Transport: "tcp",
+		Clients:   100,
+		Rate:      10,
+		Size:      64,
+		Duration:  10 * time.Second,
+		Drain:     time.Second,
+	}
+}
+
+// Report is the outcome of a run, in the JSON form used to track trends.
+type Report struct {
+	Transport  string  `json:"transport,omitempty"`
+	Target     string  `json:"target"`
+	Clients    int     `json:"clients"`
+	Connected  int     `json:"connected"`
+	Rate       float64 `json:"rate"`
+	Size       int     `json:"size"`
+	Duration   float64 `json:"durationSeconds"`
+	Sent       int64   `json:"sent"`
+	Received   int64   `json:"received"`
+	Throughput float64 `json:"throughput"`
+	Errors     Errors  `json:"errors"`
+	// Handshake is the latency of connecting, handshake included.
+	Handshake Latency `json:"handshake"`
+	// Latency is the round trip of the packets.
+	Latency Latency `json:"latency"`
+	Memory  Memory  `json:"memory"`
+}
+
+type Errors struct {
+	Connect int64 `json:"connect"`
+	Write   int64 `json:"write"`
+	Read    int64 `json:"read"`
+}
+
+// Latency percentiles, in milliseconds.
+type Latency struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	P999  float64 `json:"p999"`
+	Max   float64 `json:"max"`
+}
+
+// Memory of the process at the end of the run, the in-process acceptor
+// included.
+type Memory struct {
+	HeapAlloc  uint64 `json:"heapAlloc"`
+	TotalAlloc uint64 `json:"totalAlloc"`
+	Sys        uint64 `json:"sys"`
+	NumGC      uint32 `json:"numGC"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// bench is the state shared by the clients of a run.
+type bench struct {
+	config    Config
+	sent      atomic.Int64
+	received  atomic.Int64
+	errors    [3]atomic.Int64 // connect, write, read
+	mu        sync.Mutex
+	handshake []time.Duration
+	latency   []time.Duration
+}
+
+const (
+	errConnect = iota
+	errWrite
+	errRead
+)
+
+// Run starts the acceptor of config unless it has a target, connects the
+// clients, sends for config.Duration and reports.
+func Run(ctx context.Context, config Config) (*Report, error) {
+	if config.Clients <= 0 || config.Rate <= 0 || config.Rate > float64(time.Second) ||
+		config.Size < stampSize || config.Duration <= 0 {
+		return nil, ErrInvalidConfig
+	}
+	target := config.Target
+	if target == "" {
+		a, err := newAcceptor(config.Transport)
+		if err != nil {
+			return nil, err
+		}
+		h := acceptor.NewHandshakeAcceptor(a, acceptor.NewDefaultHandshakeConfig())
+		defer h.Stop()
+		addr, err := serve(h)
+		if err != nil {
+			return nil, err
+		}
+		target = fmt.Sprintf("%s://%s", config.Transport, addr)
+	}
+
+	b := &bench{config: config}
+	conns := b.connect(ctx, target)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, config.Duration)
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(2)
+		go func(conn *client.Conn) {
+			defer wg.Done()
+			b.send(ctx, conn)
+		}(conn)
+		go func(conn *client.Conn) {
+			defer wg.Done()
+			b.receive(conn)
+		}(conn)
+	}
+	<-ctx.Done()
+	cancel()
+	b.drain(config.Drain)
+	elapsed := time.Since(start)
+	for _, conn := range conns {
+		conn.Close()
+	}
+	wg.Wait()
+
+	report := &Report{
+		Target:     target,
+		Clients:    config.Clients,
+		Connected:  len(conns),
+		Rate:       config.Rate,
+		Size:       config.Size,
+		Duration:   elapsed.Seconds(),
+		Sent:       b.sent.Load(),
+		Received:   b.received.Load(),
+		Throughput: float64(b.received.Load()) / elapsed.Seconds(),
+		Errors: Errors{
+			Connect: b.errors[errConnect].Load(),
+			Write:   b.errors[errWrite].Load(),
+			Read:    b.errors[errRead].Load(),
+		},
+		Handshake: percentiles(b.handshake),
+		Latency:   percentiles(b.latency),
+		Memory:    memory(),
+	}
+	if config.Target == "" {
+		report.Transport = config.Transport
+	}
+	return report, nil
+}
+
+// connect dials the clients, the ones that fail are counted and left out.
+func (b *bench) connect(ctx context.Context, target string) []*client.Conn {
+	config := client.NewDefaultConfig()
+	config.Reconnect = false
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		conns []*client.Conn
+		sem   = make(chan struct{}, dialConcurrency)
+	)
+	for i := 0; i < b.config.Clients; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			start := time.Now()
+			conn, err := client.DialConfig(ctx, target, config)
+			if err != nil {
+				b.errors[errConnect].Add(1)
+				return
+			}
+			b.record(&b.handshake, time.Since(start))
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return conns
+}
+
+// send writes packets stamped with their send time at the configured rate.
+func (b *bench) send(ctx context.Context, conn *client.Conn) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / b.config.Rate))
+	defer ticker.Stop()
+	data := make([]byte, b.config.Size)
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		binary.BigEndian.PutUint64(data, uint64(time.Now().UnixNano()))
+		if err := conn.WritePacket(acceptor.Data, data); err != nil {
+			b.errors[errWrite].Add(1)
+			continue
+		}
+		b.sent.Add(1)
+	}
+}
+
+// receive measures the round trip of the echoed packets until conn is
+// closed.
+func (b *bench) receive(conn *client.Conn) {
+	for {
+		p, err := conn.ReadPacket()
+		if err != nil {
+			if err != acceptor.ErrConnectionClosed {
+				b.errors[errRead].Add(1)
+			}
+			return
+		}
+		if p.Type != acceptor.Data || len(p.Data) < stampSize {
+			continue
+		}
+		sent := time.Unix(0, int64(binary.BigEndian.Uint64(p.Data)))
+		b.record(&b.latency, time.Since(sent))
+		b.received.Add(1)
+	}
+}
+
+// drain waits up to timeout for every packet sent to be echoed.
+func (b *bench) drain(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for b.received.Load() < b.sent.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+func (b *bench) record(samples *[]time.Duration, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	*samples = append(*samples, d)
+}
+
+// percentiles summarizes samples, nearest rank.
+func percentiles(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	var sum time.Duration
+	for _, s := range samples {
+		sum += s
+	}
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(samples)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return millis(samples[i])
+	}
+	return Latency{
+		Count: len(samples),
+		Min:   millis(samples[0]),
+		Mean:  millis(sum / time.Duration(len(samples))),
+		P50:   rank(0.50),
+		P90:   rank(0.90),
+		P99:   rank(0.99),
+		P999:  rank(0.999),
+		Max:   millis(samples[len(samples)-1]),
+	}
+}
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+func memory() Memory {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return Memory{
+		HeapAlloc:  m.HeapAlloc,
+		TotalAlloc: m.TotalAlloc,
+		Sys:        m.Sys,
+		NumGC:      m.NumGC,
+		Goroutines: runtime.NumGoroutine(),
+	}
+}
+
+// newAcceptor returns the in-process acceptor, on a free local port.
+func newAcceptor(transport string) (acceptor.Acceptor, error) {
+	switch transport {
+	case "tcp":
+		return tcp.NewTCP("127.0.0.1:0"), nil
+	case "ws":
+		return ws.NewWS("127.0.0.1:0"), nil
+	}
+	return nil, fmt.Errorf("%w: unknown transport %q", ErrInvalidConfig, transport)
+}
+
+// serve runs a, echoing the Data packets of every connection, and returns
+// its address once it listens.
+func serve(a acceptor.Acceptor) (string, error) {
+	go a.ListenAndServe()
+	go func() {
+		for conn := range a.GetConnChan() {
+			go echo(conn)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if addr := a.GetAddr(); addr != "" {
+			return addr, nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return "", errors.New("acceptor-bench: acceptor did not start")
+}
+func echo(conn acceptor.Conn) {
+	defer conn.Close()
+	for {
+		p, err := conn.ReadPacket()
+		if err != nil {
+			return
+		}
+		if p.Type == acceptor.Data {
+			if err := conn.WritePacket(acceptor.Data, p.Data); err != nil {
+				return
+			}
+		}
+	}
+}
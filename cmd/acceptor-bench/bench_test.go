@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentiles(t *testing.T) {
+	samples := make([]time.Duration, 0, 1000)
+	for i := 1000; i > 0; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	l := percentiles(samples)
+	assert.Equal(t, Latency{
+		Count: 1000,
+		Min:   1,
+		Mean:  500.5,
+		P50:   500,
+		P90:   900,
+		P99:   990,
+		P999:  999,
+		Max:   1000,
+	}, l)
+	assert.Equal(t, Latency{}, percentiles(nil))
+	assert.Equal(t, 7.0, percentiles([]time.Duration{7 * time.Millisecond}).P999)
+}
+
+func TestRun(t *testing.T) {
+	tables := []struct {
+		name      string
+		transport string
+	}{
+		{"test_1", "tcp"},
+		{"test_2", "ws"},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			config := NewDefaultConfig()
+			config.Transport = table.transport
+			config.Clients = 5
+			config.Rate = 100
+			config.Duration = 200 * time.Millisecond
+			report, err := Run(context.Background(), config)
+			assert.NoError(t, err)
+			assert.Equal(t, table.transport, report.Transport)
+			assert.Equal(t, 5, report.Connected)
+			assert.Equal(t, Errors{}, report.Errors)
+			assert.Greater(t, report.Sent, int64(0))
+			assert.Equal(t, report.Sent, report.Received)
+			assert.Equal(t, int(report.Received), report.Latency.Count)
+			assert.Equal(t, 5, report.Handshake.Count)
+
+			var buf bytes.Buffer
+			assert.NoError(t, json.NewEncoder(&buf).Encode(report))
+			assert.Contains(t, buf.String(), `"p99"`)
+		})
+	}
+}
+
+func TestRunUnreachable(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Target = "tcp://127.0.0.1:1"
+	config.Clients = 3
+	config.Duration = 10 * time.Millisecond
+	report, err := Run(context.Background(), config)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Connected)
+	assert.Equal(t, int64(3), report.Errors.Connect)
+}
+
+func TestRunInvalidConfig(t *testing.T) {
+	tables := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"test_1", func(c *Config) { c.Clients = 0 }},
+		{"test_2", func(c *Config) { c.Rate = 0 }},
+		{"test_3", func(c *Config) { c.Size = 4 }},
+		{"test_4", func(c *Config) { c.Duration = 0 }},
+		{"test_5", func(c *Config) { c.Transport = "udp" }},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			config := NewDefaultConfig()
+			table.modify(&config)
+			_, err := Run(context.Background(), config)
+			assert.True(t, errors.Is(err, ErrInvalidConfig))
+		})
+	}
+}
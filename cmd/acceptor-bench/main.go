@@ -0,0 +1,67 @@
+// Command acceptor-bench measures how many connections and packets per second
+// an acceptor handles.
+//
+// It starts a TCP or WebSocket acceptor in process, or targets a running one
+// by URL, connects clients that handshake and send stamped Data packets at a
+// fixed rate, and reports the round trip latencies of the echoed packets,
+// throughput, errors and memory:
+//
+//	acceptor-bench -transport ws -clients 1000 -rate 20 -duration 30s
+//	acceptor-bench -target tcp://10.0.0.1:3250 -json > bench.json
+//
+// A target must echo the Data packets back for latencies to be measured.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	config := NewDefaultConfig()
+	flag.StringVar(&config.Transport, "transport", config.Transport, "acceptor to start in process, tcp or ws")
+	flag.StringVar(&config.Target, "target", config.Target, "URL of a running acceptor, tcp://, tls://, ws:// or wss://")
+	flag.IntVar(&config.Clients, "clients", config.Clients, "number of clients")
+	flag.Float64Var(&config.Rate, "rate", config.Rate, "packets per second of each client")
+	flag.IntVar(&config.Size, "size", config.Size, "size of the packets data, at least 8")
+	flag.DurationVar(&config.Duration, "duration", config.Duration, "how long the clients send for")
+	flag.DurationVar(&config.Drain, "drain", config.Drain, "how long to wait for the last echoes")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := Run(ctx, config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return
+	}
+	printReport(os.Stdout, report)
+}
+func printReport(w io.Writer, r *Report) {
+	fmt.Fprintf(w, "target      %s\n", r.Target)
+	fmt.Fprintf(w, "clients     %d connected of %d\n", r.Connected, r.Clients)
+	fmt.Fprintf(w, "duration    %.2fs\n", r.Duration)
+	fmt.Fprintf(w, "packets     %d sent, %d received\n", r.Sent, r.Received)
+	fmt.Fprintf(w, "throughput  %.1f packets/s\n", r.Throughput)
+	fmt.Fprintf(w, "errors      %d connect, %d write, %d read\n", r.Errors.Connect, r.Errors.Write, r.Errors.Read)
+	printLatency(w, "handshake", r.Handshake)
+	printLatency(w, "latency", r.Latency)
+	fmt.Fprintf(w, "memory      %d heap, %d sys, %d GC, %d goroutines\n",
+		r.Memory.HeapAlloc, r.Memory.Sys, r.Memory.NumGC, r.Memory.Goroutines)
+}
+func printLatency(w io.Writer, name string, l Latency) {
+	fmt.Fprintf(w, "%-11s min %.2fms mean %.2fms p50 %.2fms p90 %.2fms p99 %.2fms p99.9 %.2fms max %.2fms\n",
+		name, l.Min, l.Mean, l.P50, l.P90, l.P99, l.P999, l.Max)
+}
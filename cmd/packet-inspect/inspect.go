@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+var codec = acceptor.NewPacketCodec()
+
+// Payload formats.
+const (
+	PayloadHex  = "hex"
+	PayloadText = "text"
+	PayloadJSON = "json"
+	PayloadNone = "none"
+)
+
+// Inspector prints the packets of byte streams and flags what is wrong with
+// them.
+type Inspector struct {
+	w       io.Writer
+	payload string
+	max     int
+	// Problems counts the invalid headers, oversize lengths and truncated
+	// frames found so far.
+	Problems int
+}
+
+// NewInspector prints to w the payloads in the payload format, and flags
+// the lengths above max.
+func NewInspector(w io.Writer, payload string, max int) *Inspector {
+	return &Inspector{w: w, payload: payload, max: max}
+}
+
+// Inspect prints the packets of the stream data named name. A stream can't
+// be trusted past an invalid header, so Inspect stops at the first one. The
+// length of a header is checked against max before its type, so an oversize
+// length is reported as such even when the type is wrong too.
+func (i *Inspector) Inspect(name string, data []byte) {
+	fmt.Fprintf(i.w, "== %s (%d bytes)\n", name, len(data))
+	packets, err := codec.Decode(data)
+	offset := 0
+	for n, p := range packets {
+		if p.Length > i.max {
+			i.problem(offset, "%s length %d exceeds %d", typeName(p.Type), p.Length, i.max)
+			return
+		}
+		fmt.Fprintf(i.w, "#%d offset %d %s length %d\n", n+1, offset, typeName(p.Type), p.Length)
+		i.print(p.Data)
+		offset += acceptor.HeadLength + p.Length
+	}
+	rest := data[offset:]
+	if len(rest) == 0 {
+		return
+	}
+	if len(rest) < acceptor.HeadLength {
+		i.problem(offset, "truncated header, %d of %d bytes: % x", len(rest), acceptor.HeadLength, rest)
+		return
+	}
+	header := rest[:acceptor.HeadLength]
+	typ, size := acceptor.Type(header[0]), acceptor.BytesToInt(header[1:])
+	switch {
+	case size > i.max:
+		i.problem(offset, "%s length %d exceeds %d", typeName(typ), size, i.max)
+	case err != nil:
+		i.problem(offset, "invalid header % x: %s", header, err)
+	default:
+		i.problem(offset, "truncated %s frame, %d of %d bytes", typeName(typ), len(rest)-acceptor.HeadLength, size)
+	}
+}
+func (i *Inspector) problem(offset int, format string, args ...interface{}) {
+	i.Problems++
+	fmt.Fprintf(i.w, "!! offset %d: %s\n", offset, fmt.Sprintf(format, args...))
+}
+
+// print writes payload in the payload format, falling back to hex when it
+// isn't valid UTF-8 or JSON.
+func (i *Inspector) print(payload []byte) {
+	if len(payload) == 0 || i.payload == PayloadNone {
+		return
+	}
+	switch i.payload {
+	case PayloadText:
+		if utf8.Valid(payload) {
+			fmt.Fprintln(i.w, indent(string(payload)))
+			return
+		}
+	case PayloadJSON:
+		var buf bytes.Buffer
+		if json.Indent(&buf, payload, "", "  ") == nil {
+			fmt.Fprintln(i.w, indent(buf.String()))
+			return
+		}
+	}
+	fmt.Fprint(i.w, indent(hex.Dump(payload)))
+}
+func indent(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for n, line := range lines {
+		if line != "" {
+			lines[n] = "    " + line
+		}
+	}
+	return strings.Join(lines, "")
+}
+func typeName(typ acceptor.Type) string {
+	switch typ {
+	case acceptor.Handshake:
+		return "Handshake"
+	case acceptor.HandshakeAck:
+		return "HandshakeAck"
+	case acceptor.Heartbeat:
+		return "Heartbeat"
+	case acceptor.Data:
+		return "Data"
+	case acceptor.Kick:
+		return "Kick"
+	}
+	return fmt.Sprintf("Type(%d)", typ)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/stretchr/testify/assert"
+)
+
+func encode(t *testing.T, typ acceptor.Type, data []byte) []byte {
+	t.Helper()
+	b, err := acceptor.NewPacketCodec().Encode(typ, data)
+	assert.NoError(t, err)
+	return b
+}
+
+func TestInspect(t *testing.T) {
+	stream := append(encode(t, acceptor.Handshake, []byte(`{"sys":{"platform":"go"}}`)),
+		encode(t, acceptor.Heartbeat, nil)...)
+	stream = append(stream, encode(t, acceptor.Data, []byte{0xff, 0x00})...)
+
+	tables := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"test_1", PayloadNone, "== s (39 bytes)\n" +
+			"#1 offset 0 Handshake length 25\n" +
+			"#2 offset 29 Heartbeat length 0\n" +
+			"#3 offset 33 Data length 2\n"},
+		{"test_2", PayloadText, "== s (39 bytes)\n" +
+			"#1 offset 0 Handshake length 25\n" +
+			"    {\"sys\":{\"platform\":\"go\"}}\n" +
+			"#2 offset 29 Heartbeat length 0\n" +
+			"#3 offset 33 Data length 2\n" +
+			"    00000000  ff 00                                             |..|\n"},
+		{"test_3", PayloadJSON, "== s (39 bytes)\n" +
+			"#1 offset 0 Handshake length 25\n" +
+			"    {\n" +
+			"      \"sys\": {\n" +
+			"        \"platform\": \"go\"\n" +
+			"      }\n" +
+			"    }\n" +
+			"#2 offset 29 Heartbeat length 0\n" +
+			"#3 offset 33 Data length 2\n" +
+			"    00000000  ff 00                                             |..|\n"},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			i := NewInspector(&buf, table.payload, acceptor.MaxPacketSize)
+			i.Inspect("s", stream)
+			assert.Equal(t, table.want, buf.String())
+			assert.Equal(t, 0, i.Problems)
+		})
+	}
+}
+
+func TestInspectProblems(t *testing.T) {
+	data := encode(t, acceptor.Data, []byte("hello"))
+	tables := []struct {
+		name   string
+		stream []byte
+		max    int
+		want   string
+	}{
+		{"test_1", append(data, 0x09, 0x00, 0x00, 0x01, 0x00), acceptor.MaxPacketSize,
+			"!! offset 9: invalid header 09 00 00 01: wrong packet type\n"},
+		{"test_2", append(data, 0x04, 0x00), acceptor.MaxPacketSize,
+			"!! offset 9: truncated header, 2 of 4 bytes: 04 00\n"},
+		{"test_3", append(data, 0x04, 0x00, 0x00, 0x05, 'h', 'i'), acceptor.MaxPacketSize,
+			"!! offset 9: truncated Data frame, 2 of 5 bytes\n"},
+		{"test_4", data, 4,
+			"!! offset 0: Data length 5 exceeds 4\n"},
+		{"test_5", append(data, 0x09, 0x00, 0x00, 0x05), 4,
+			"!! offset 0: Data length 5 exceeds 4\n"},
+		{"test_6", append(data, 0x09, 0x01, 0x00, 0x00), 16,
+			"!! offset 9: Type(9) length 65536 exceeds 16\n"},
+		{"test_7", append(data, 0x04, 0x01, 0x00, 0x00), 16,
+			"!! offset 9: Data length 65536 exceeds 16\n"},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			i := NewInspector(&buf, PayloadNone, table.max)
+			i.Inspect("s", table.stream)
+			assert.Contains(t, buf.String(), table.want)
+			assert.Equal(t, 1, i.Problems)
+		})
+	}
+}
+
+func TestDecodeHex(t *testing.T) {
+	tables := []struct {
+		name string
+		in   string
+		out  []byte
+		err  bool
+	}{
+		{"test_1", "04 00 00 01 ff\n", []byte{0x04, 0x00, 0x00, 0x01, 0xff}, false},
+		{"test_2", "0x04,0x00,0x00,0x00", []byte{0x04, 0x00, 0x00, 0x00}, false},
+		{"test_3", "04:00:00:00", []byte{0x04, 0x00, 0x00, 0x00}, false},
+		{"test_4", "04000000AB", []byte{0x04, 0x00, 0x00, 0x00, 0xab}, false},
+		{"test_5", "04 0 00", nil, true},
+		{"test_6", "hello", nil, true},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			out, err := decodeHex(table.in)
+			if table.err {
+				assert.ErrorIs(t, err, ErrInvalidHex)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, table.out, out)
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	assert.Equal(t, FormatHex, detect([]byte("04 00 00 00\n")))
+	assert.Equal(t, FormatRaw, detect([]byte{0x04, 0x00, 0x00, 0x00}))
+	assert.Equal(t, FormatRaw, detect([]byte("\n")))
+	assert.Equal(t, FormatPcap, detect(newPcap(linkRaw).bytes()))
+}
+
+func TestInspectFormats(t *testing.T) {
+	var buf bytes.Buffer
+	i := NewInspector(&buf, PayloadText, acceptor.MaxPacketSize)
+	assert.NoError(t, inspect(i, "stdin", []byte("04 00 00 02 68 69"), FormatAuto))
+	assert.Equal(t, "== stdin (6 bytes)\n#1 offset 0 Data length 2\n    hi\n", buf.String())
+	assert.ErrorIs(t, inspect(i, "stdin", []byte("zz"), FormatHex), ErrInvalidHex)
+	assert.Error(t, inspect(i, "stdin", nil, "xml"))
+}
@@ -0,0 +1,136 @@
+// Command packet-inspect decodes the packets of captured traffic.
+//
+// It reads raw streams, hex dumps or the TCP payloads of pcap files, from
+// files or stdin, and prints the type, length and payload of every packet,
+// flagging invalid headers, lengths above -max and truncated trailing frames:
+//
+//	packet-inspect -payload json capture.pcap
+//	echo "04 00 00 02 68 69" | packet-inspect -payload text
+//
+// It exits with status 1 when something was flagged or couldn't be read.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"io"
+	"os"
+	"strings"
+)
+
+// Input formats.
+const (
+	FormatAuto = "auto"
+	FormatRaw  = "raw"
+	FormatHex  = "hex"
+	FormatPcap = "pcap"
+)
+
+var ErrInvalidHex = errors.New("packet-inspect: invalid hex")
+
+func main() {
+	format := flag.String("format", FormatAuto, "input format: auto, raw, hex or pcap")
+	payload := flag.String("payload", PayloadHex, "payload format: hex, text, json or none")
+	max := flag.Int("max", acceptor.MaxPacketSize, "flag the packets longer than this")
+	flag.Parse()
+	switch *payload {
+	case PayloadHex, PayloadText, PayloadJSON, PayloadNone:
+	default:
+		fmt.Fprintf(os.Stderr, "packet-inspect: unknown payload format %q\n", *payload)
+		os.Exit(2)
+	}
+
+	inputs := flag.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	i := NewInspector(os.Stdout, *payload, *max)
+	failed := false
+	for _, input := range inputs {
+		if err := inspectInput(i, input, *format); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", input, err)
+			failed = true
+		}
+	}
+	if failed || i.Problems > 0 {
+		os.Exit(1)
+	}
+}
+func inspectInput(i *Inspector, input, format string) error {
+	var (
+		data []byte
+		err  error
+	)
+	if input == "-" {
+		data, err = io.ReadAll(os.Stdin)
+		input = "stdin"
+	} else {
+		data, err = os.ReadFile(input)
+	}
+	if err != nil {
+		return err
+	}
+	return inspect(i, input, data, format)
+}
+
+// inspect prints the packets of data, the content of input in format.
+func inspect(i *Inspector, input string, data []byte, format string) error {
+	if format == FormatAuto {
+		format = detect(data)
+	}
+	switch format {
+	case FormatRaw:
+		i.Inspect(input, data)
+	case FormatHex:
+		raw, err := decodeHex(string(data))
+		if err != nil {
+			return err
+		}
+		i.Inspect(input, raw)
+	case FormatPcap:
+		streams, err := ReadPcap(data)
+		for _, s := range streams {
+			if s.Gaps > 0 {
+				i.Problems++
+				fmt.Fprintf(i.w, "!! %s %s: %d gaps in the capture\n", input, s.Name, s.Gaps)
+			}
+			i.Inspect(input+" "+s.Name, s.Data)
+		}
+		return err
+	default:
+		return fmt.Errorf("packet-inspect: unknown format %q", format)
+	}
+	return nil
+}
+
+// detect tells the format of data. A raw stream starts with a packet type,
+// which is not printable, so printable hex digits mean a hex dump.
+func detect(data []byte) string {
+	if isPcap(data) {
+		return FormatPcap
+	}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if _, err := decodeHex(string(data)); err == nil {
+			return FormatHex
+		}
+	}
+	return FormatRaw
+}
+
+// decodeHex decodes hex digits, ignoring whitespace, 0x prefixes and the
+// commas and colons separating bytes. Every field must hold whole bytes.
+func decodeHex(s string) ([]byte, error) {
+	s = strings.NewReplacer("0x", " ", "0X", " ", ",", " ", ":", " ").Replace(s)
+	var raw []byte
+	for _, field := range strings.Fields(s) {
+		b, err := hex.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidHex, field)
+		}
+		raw = append(raw, b...)
+	}
+	return raw, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+var (
+	ErrNotPcap          = errors.New("packet-inspect: not a pcap file")
+	ErrUnsupportedLink  = errors.New("packet-inspect: unsupported pcap link type")
+	ErrTruncatedCapture = errors.New("packet-inspect: truncated pcap record")
+)
+
+// Link types of the pcap files read.
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLinuxSLL = 113
+	linkIPv4     = 228
+	linkIPv6     = 229
+	linkSLL2     = 276
+)
+
+const (
+	protocolTCP  = 6
+	etherIPv4    = 0x0800
+	etherIPv6    = 0x86dd
+	etherVLAN    = 0x8100
+	tcpFlagSYN   = 0x02
+	pcapHeadSize = 24
+	recordSize   = 16
+)
+
+// Stream is one direction of a TCP connection of a capture.
+type Stream struct {
+	Name string
+	Data []byte
+	// Gaps counts the segments that came after missing ones.
+	Gaps    int
+	next    uint32
+	started bool
+}
+
+// isPcap tells if data starts with the magic number of a pcap file.
+func isPcap(data []byte) bool {
+	_, err := pcapOrder(data)
+	return err == nil
+}
+func pcapOrder(data []byte) (binary.ByteOrder, error) {
+	if len(data) < pcapHeadSize {
+		return nil, ErrNotPcap
+	}
+	switch binary.LittleEndian.Uint32(data) {
+	case 0xa1b2c3d4, 0xa1b23c4d:
+		return binary.LittleEndian, nil
+	}
+	switch binary.BigEndian.Uint32(data) {
+	case 0xa1b2c3d4, 0xa1b23c4d:
+		return binary.BigEndian, nil
+	}
+	return nil, ErrNotPcap
+}
+
+// ReadPcap reassembles the TCP payloads of a pcap file in streams, in the
+// order they first appear. Segments sent again are only kept once.
+func ReadPcap(data []byte) ([]*Stream, error) {
+	order, err := pcapOrder(data)
+	if err != nil {
+		return nil, err
+	}
+	link := order.Uint32(data[20:])
+	streams := map[string]*Stream{}
+	var ordered []*Stream
+	for offset := pcapHeadSize; offset < len(data); {
+		if len(data)-offset < recordSize {
+			return ordered, ErrTruncatedCapture
+		}
+		size := int(order.Uint32(data[offset+8:]))
+		offset += recordSize
+		if len(data)-offset < size {
+			return ordered, ErrTruncatedCapture
+		}
+		frame := data[offset : offset+size]
+		offset += size
+
+		ip, err := linkPayload(link, frame)
+		if err != nil {
+			return ordered, err
+		}
+		name, seq, syn, payload, ok := tcpSegment(ip)
+		if !ok {
+			continue
+		}
+		s := streams[name]
+		if s == nil {
+			s = &Stream{Name: name}
+			streams[name] = s
+		}
+		empty := len(s.Data) == 0
+		s.add(seq, syn, payload)
+		if empty && len(s.Data) > 0 {
+			ordered = append(ordered, s)
+		}
+	}
+	return ordered, nil
+}
+
+// add appends the part of a segment not seen yet.
+func (s *Stream) add(seq uint32, syn bool, payload []byte) {
+	if syn {
+		s.next, s.started = seq+1, true
+		return
+	}
+	if len(payload) == 0 {
+		return
+	}
+	if !s.started {
+		s.next, s.started = seq, true
+	}
+	switch d := int32(seq - s.next); {
+	case d > 0:
+		s.Gaps++
+		s.next = seq
+	case d < 0:
+		if -int(d) >= len(payload) {
+			return
+		}
+		payload = payload[-d:]
+	}
+	s.Data = append(s.Data, payload...)
+	s.next += uint32(len(payload))
+}
+
+// linkPayload returns the IP packet of a frame.
+func linkPayload(link uint32, frame []byte) ([]byte, error) {
+	switch link {
+	case linkNull:
+		if len(frame) < 4 {
+			return nil, nil
+		}
+		return frame[4:], nil
+	case linkEthernet:
+		if len(frame) < 14 {
+			return nil, nil
+		}
+		etherType, frame := binary.BigEndian.Uint16(frame[12:]), frame[14:]
+		for etherType == etherVLAN && len(frame) >= 4 {
+			etherType, frame = binary.BigEndian.Uint16(frame[2:]), frame[4:]
+		}
+		if etherType != etherIPv4 && etherType != etherIPv6 {
+			return nil, nil
+		}
+		return frame, nil
+	case linkRaw, linkIPv4, linkIPv6:
+		return frame, nil
+	case linkLinuxSLL:
+		if len(frame) < 16 {
+			return nil, nil
+		}
+		return frame[16:], nil
+	case linkSLL2:
+		if len(frame) < 20 {
+			return nil, nil
+		}
+		return frame[20:], nil
+	}
+	return nil, fmt.Errorf("%w %d", ErrUnsupportedLink, link)
+}
+
+// tcpSegment returns the stream name, sequence number, SYN flag and payload
+// of the TCP segment in ip. ok is false for anything else, fragments
+// included.
+func tcpSegment(ip []byte) (name string, seq uint32, syn bool, payload []byte, ok bool) {
+	if len(ip) < 1 {
+		return
+	}
+	var src, dst net.IP
+	var segment []byte
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 {
+			return
+		}
+		headLen := int(ip[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(ip[2:]))
+		fragment := binary.BigEndian.Uint16(ip[6:]) & 0x3fff
+		if ip[9] != protocolTCP || fragment != 0 || headLen < 20 || total < headLen || total > len(ip) {
+			return
+		}
+		src, dst, segment = net.IP(ip[12:16]), net.IP(ip[16:20]), ip[headLen:total]
+	case 6:
+		if len(ip) < 40 {
+			return
+		}
+		total := 40 + int(binary.BigEndian.Uint16(ip[4:]))
+		if ip[6] != protocolTCP || total > len(ip) {
+			return
+		}
+		src, dst, segment = net.IP(ip[8:24]), net.IP(ip[24:40]), ip[40:total]
+	default:
+		return
+	}
+	if len(segment) < 20 {
+		return
+	}
+	headLen := int(segment[12]>>4) * 4
+	if headLen < 20 || headLen > len(segment) {
+		return
+	}
+	name = fmt.Sprintf("%s -> %s",
+		net.JoinHostPort(src.String(), strconv.Itoa(int(binary.BigEndian.Uint16(segment)))),
+		net.JoinHostPort(dst.String(), strconv.Itoa(int(binary.BigEndian.Uint16(segment[2:])))))
+	return name, binary.BigEndian.Uint32(segment[4:]), segment[13]&tcpFlagSYN != 0, segment[headLen:], true
+}
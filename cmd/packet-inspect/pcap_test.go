@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/stretchr/testify/assert"
+)
+
+// pcap builds capture files, little endian with microseconds.
+type pcap struct {
+	buf  bytes.Buffer
+	link uint32
+}
+
+func newPcap(link uint32) *pcap {
+	p := &pcap{link: link}
+	header := make([]byte, pcapHeadSize)
+	binary.LittleEndian.PutUint32(header, 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], link)
+	p.buf.Write(header)
+	return p
+}
+func (p *pcap) bytes() []byte {
+	return p.buf.Bytes()
+}
+
+// segment adds a TCP segment from src to dst.
+func (p *pcap) segment(src, dst string, seq uint32, syn bool, payload []byte) *pcap {
+	srcAddr, _ := net.ResolveTCPAddr("tcp", src)
+	dstAddr, _ := net.ResolveTCPAddr("tcp", dst)
+	tcp := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp, uint16(srcAddr.Port))
+	binary.BigEndian.PutUint16(tcp[2:], uint16(dstAddr.Port))
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12] = 5 << 4
+	if syn {
+		tcp[13] = tcpFlagSYN
+	}
+	tcp = append(tcp, payload...)
+
+	var ip []byte
+	if v4 := srcAddr.IP.To4(); v4 != nil {
+		ip = make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+		ip[9] = protocolTCP
+		copy(ip[12:], v4)
+		copy(ip[16:], dstAddr.IP.To4())
+	} else {
+		ip = make([]byte, 40)
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(tcp)))
+		ip[6] = protocolTCP
+		copy(ip[8:], srcAddr.IP)
+		copy(ip[24:], dstAddr.IP)
+	}
+	frame := append(ip, tcp...)
+	if p.link == linkEthernet {
+		ether := make([]byte, 14)
+		binary.BigEndian.PutUint16(ether[12:], etherIPv4)
+		if ip[0]>>4 == 6 {
+			binary.BigEndian.PutUint16(ether[12:], etherIPv6)
+		}
+		frame = append(ether, frame...)
+	}
+
+	record := make([]byte, recordSize)
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(frame)))
+	p.buf.Write(record)
+	p.buf.Write(frame)
+	return p
+}
+
+func TestReadPcap(t *testing.T) {
+	hello := encode(t, acceptor.Data, []byte("hello"))
+	client, server := "10.0.0.1:5000", "10.0.0.2:3250"
+	capture := newPcap(linkEthernet).
+		segment(client, server, 99, true, nil).
+		segment(client, server, 100, false, hello[:3]).
+		segment(server, client, 7, false, encode(t, acceptor.Heartbeat, nil)).
+		// sent again, partly overlapping
+		segment(client, server, 100, false, hello[:3]).
+		segment(client, server, 101, false, hello[1:]).
+		segment(client, server, 109, false, encode(t, acceptor.Kick, nil))
+
+	streams, err := ReadPcap(capture.bytes())
+	assert.NoError(t, err)
+	assert.Len(t, streams, 2)
+	assert.Equal(t, "10.0.0.1:5000 -> 10.0.0.2:3250", streams[0].Name)
+	assert.Equal(t, append(hello, encode(t, acceptor.Kick, nil)...), streams[0].Data)
+	assert.Equal(t, 0, streams[0].Gaps)
+	assert.Equal(t, "10.0.0.2:3250 -> 10.0.0.1:5000", streams[1].Name)
+	assert.Equal(t, encode(t, acceptor.Heartbeat, nil), streams[1].Data)
+}
+
+func TestReadPcapIPv6Gap(t *testing.T) {
+	client, server := "[::1]:5000", "[::1]:3250"
+	capture := newPcap(linkRaw).
+		segment(client, server, 0, false, []byte{0x04, 0x00}).
+		segment(client, server, 10, false, []byte{0x03, 0x00, 0x00, 0x00})
+
+	streams, err := ReadPcap(capture.bytes())
+	assert.NoError(t, err)
+	assert.Len(t, streams, 1)
+	assert.Equal(t, "[::1]:5000 -> [::1]:3250", streams[0].Name)
+	assert.Equal(t, 1, streams[0].Gaps)
+	assert.Equal(t, []byte{0x04, 0x00, 0x03, 0x00, 0x00, 0x00}, streams[0].Data)
+}
+
+func TestReadPcapErrors(t *testing.T) {
+	_, err := ReadPcap([]byte("not a capture, not at all"))
+	assert.Equal(t, ErrNotPcap, err)
+
+	_, err = ReadPcap(newPcap(147).segment("10.0.0.1:1", "10.0.0.2:2", 0, false, []byte{1}).bytes())
+	assert.ErrorIs(t, err, ErrUnsupportedLink)
+
+	capture := newPcap(linkRaw).segment("10.0.0.1:1", "10.0.0.2:2", 0, false, []byte{1}).bytes()
+	_, err = ReadPcap(capture[:len(capture)-1])
+	assert.Equal(t, ErrTruncatedCapture, err)
+}
+
+func TestInspectPcap(t *testing.T) {
+	capture := newPcap(linkEthernet).
+		segment("10.0.0.1:5000", "10.0.0.2:3250", 0, false, []byte{0x04, 0x00, 0x00, 0x01, 0x01}).
+		segment("10.0.0.1:5000", "10.0.0.2:3250", 20, false, []byte{0x04, 0x00, 0x00, 0x09})
+	var buf bytes.Buffer
+	i := NewInspector(&buf, PayloadNone, acceptor.MaxPacketSize)
+	assert.NoError(t, inspect(i, "c.pcap", capture.bytes(), FormatAuto))
+	assert.Equal(t, "!! c.pcap 10.0.0.1:5000 -> 10.0.0.2:3250: 1 gaps in the capture\n"+
+		"== c.pcap 10.0.0.1:5000 -> 10.0.0.2:3250 (9 bytes)\n"+
+		"#1 offset 0 Data length 1\n"+
+		"!! offset 5: truncated Data frame, 0 of 9 bytes\n", buf.String())
+	assert.Equal(t, 2, i.Problems)
+}
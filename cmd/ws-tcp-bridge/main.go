@@ -0,0 +1,72 @@
+// Command ws-tcp-bridge lets WebSocket clients reach a backend that only
+// speaks the raw TCP framing:
+//
+//	ws-tcp-bridge -listen :3251 -backend 10.0.0.1:3250
+//
+// Every client gets its own backend connection, starting with a PROXY
+// protocol header carrying the client address unless -proxy-protocol is 0.
+// Behind a load balancer sending PROXY protocol itself, -trusted-proxies
+// lists its networks so the real client address is passed on.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/gotechbook/gotechbook-framework-acceptor/bridge"
+	"github.com/gotechbook/gotechbook-framework-acceptor/proxyproto"
+	"github.com/gotechbook/gotechbook-framework-acceptor/ws"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func main() {
+	config := bridge.NewDefaultConfig()
+	listen := flag.String("listen", ":3251", "address of the WebSocket acceptor")
+	flag.StringVar(&config.Backend, "backend", "", "address of the TCP backend")
+	flag.IntVar(&config.ProxyProtocol, "proxy-protocol", config.ProxyProtocol, "PROXY protocol version sent to the backend, 1 or 2, 0 for none")
+	flag.DurationVar(&config.DialTimeout, "dial-timeout", config.DialTimeout, "timeout of the backend connections")
+	cert := flag.String("cert", "", "certificate file, for wss")
+	key := flag.String("key", "", "key file, for wss")
+	trusted := flag.String("trusted-proxies", "", "comma separated networks of the proxies sending PROXY protocol to the bridge")
+	flag.Parse()
+
+	if config.Backend == "" {
+		fail("ws-tcp-bridge: -backend is required")
+	}
+	if config.ProxyProtocol < 0 || config.ProxyProtocol > 2 {
+		fail("ws-tcp-bridge: -proxy-protocol must be 0, 1 or 2")
+	}
+	if (*cert == "") != (*key == "") {
+		fail("ws-tcp-bridge: -cert and -key go together")
+	}
+	var a *ws.WS
+	if *cert != "" {
+		a = ws.NewWS(*listen, *cert, *key)
+	} else {
+		a = ws.NewWS(*listen)
+	}
+	if *trusted != "" {
+		proxy := proxyproto.NewDefaultConfig()
+		cidrs, err := proxyproto.ParseCIDRs(strings.Split(*trusted, ",")...)
+		if err != nil {
+			fail(err.Error())
+		}
+		proxy.TrustedCIDRs = cidrs
+		a.UseProxyProtocol(proxy)
+	}
+
+	b := bridge.NewBridge(a, config)
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		b.Stop()
+	}()
+	b.ListenAndServe()
+}
+func fail(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+	os.Exit(2)
+}
@@ -0,0 +1,28 @@
+package fault
+
+import acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+
+var _ acceptor.Acceptor = (*Acceptor)(nil)
+
+// Acceptor delivers the connections of an inner Acceptor wrapped in a Conn.
+type Acceptor struct {
+	*acceptor.WrapAcceptor
+}
+
+// NewAcceptor injects the faults of config into every connection of a. The
+// n-th connection accepted, counting from zero, is seeded with config.Seed+n.
+func NewAcceptor(a acceptor.Acceptor, config Config) *Acceptor {
+	return NewAcceptorFunc(a, func(n int, _ acceptor.Conn) Config {
+		c := config
+		c.Seed += int64(n)
+		return c
+	})
+}
+
+// NewAcceptorFunc injects into the n-th connection of a, counting from zero,
+// the faults configure returns for it. configure may be called concurrently.
+func NewAcceptorFunc(a acceptor.Acceptor, configure func(n int, conn acceptor.Conn) Config) *Acceptor {
+	return &Acceptor{acceptor.NewWrapAcceptor(a, func(n int, conn acceptor.Conn) (acceptor.Conn, error) {
+		return NewConn(conn, configure(n, conn)), nil
+	})}
+}
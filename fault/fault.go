@@ -0,0 +1,245 @@
+// Package fault injects network faults into connections, to test how code
+// copes with bad networks without network tooling.
+//
+// Faults are drawn from a random source seeded by Config.Seed, reads and
+// writes each having their own, so the same sequence of operations meets the
+// same faults and failures are reproducible.
+package fault
+
+import (
+	"context"
+	"errors"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var ErrReset = errors.New("fault: injected connection reset")
+
+var _ acceptor.Conn = (*Conn)(nil)
+
+var codec = acceptor.NewPacketCodec()
+
+// Config tells which faults to inject. The zero value injects none.
+type Config struct {
+	// Seed of the random source.
+	Seed int64
+	// Latency delays every read and write, plus a random extra of up to Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+	// Bandwidth limits the bytes per second in each direction, zero doesn't.
+	Bandwidth int
+	// FragmentSize splits writes in chunks of 1 to FragmentSize bytes. Only
+	// byte stream transports put the chunks back together.
+	FragmentSize int
+	// PartialWriteRate is the probability a write only writes part of its
+	// bytes and fails with io.ErrShortWrite.
+	PartialWriteRate float64
+	// CorruptRate is the probability a byte of a packet read or written is
+	// flipped.
+	CorruptRate float64
+	// ResetRate is the probability a read or write closes the connection and
+	// fails with ErrReset.
+	ResetRate float64
+	// StallRate is the probability a read or write first hangs for StallDuration.
+	StallRate     float64
+	StallDuration time.Duration
+}
+
+// Conn injects the faults of its config into the wrapped connection.
+type Conn struct {
+	acceptor.Conn
+	config    Config
+	read      *source
+	write     *source
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewConn(conn acceptor.Conn, config Config) *Conn {
+	return &Conn{
+		Conn:   conn,
+		config: config,
+		read:   newSource(config.Seed),
+		write:  newSource(^config.Seed),
+		done:   make(chan struct{}),
+	}
+}
+
+// Unwrap returns the wrapped connection.
+func (c *Conn) Unwrap() acceptor.Conn {
+	return c.Conn
+}
+func (c *Conn) GetNextMessage() (b []byte, err error) {
+	return c.GetNextMessageContext(context.Background())
+}
+func (c *Conn) GetNextMessageContext(ctx context.Context) (b []byte, err error) {
+	if err := c.inject(ctx, c.read); err != nil {
+		return nil, err
+	}
+	if b, err = c.Conn.GetNextMessageContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.delay(ctx, c.read, len(b)); err != nil {
+		return nil, err
+	}
+	return c.corrupt(c.read, b), nil
+}
+func (c *Conn) ReadPacket() (*acceptor.Packet, error) {
+	b, err := c.GetNextMessage()
+	if err != nil {
+		return nil, err
+	}
+	packets, err := codec.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	// a corrupted length no longer matches the message
+	if len(packets) != 1 || packets[0].Length != len(b)-acceptor.HeadLength {
+		return nil, acceptor.ErrInvalidHeader
+	}
+	return packets[0], nil
+}
+func (c *Conn) Read(b []byte) (int, error) {
+	ctx := context.Background()
+	if err := c.inject(ctx, c.read); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		if err := c.delay(ctx, c.read, n); err != nil {
+			return 0, err
+		}
+		copy(b, c.corrupt(c.read, b[:n]))
+	}
+	return n, err
+}
+
+// WritePacket encodes the packet and writes it with Write, so the packet
+// meets the faults of writes.
+func (c *Conn) WritePacket(typ acceptor.Type, data []byte) error {
+	b, err := codec.Encode(typ, data)
+	if err != nil {
+		return err
+	}
+	_, err = c.Write(b)
+	return err
+}
+func (c *Conn) Write(b []byte) (int, error) {
+	ctx := context.Background()
+	if err := c.inject(ctx, c.write); err != nil {
+		return 0, err
+	}
+	if err := c.delay(ctx, c.write, len(b)); err != nil {
+		return 0, err
+	}
+	b = c.corrupt(c.write, b)
+	size, short := len(b), false
+	if len(b) > 0 && c.write.chance(c.config.PartialWriteRate) {
+		size, short = c.write.intn(len(b)), true
+	}
+	n := 0
+	for n < size {
+		chunk := size - n
+		if c.config.FragmentSize > 0 {
+			if max := c.write.intn(c.config.FragmentSize) + 1; chunk > max {
+				chunk = max
+			}
+		}
+		m, err := c.Conn.Write(b[n : n+chunk])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	if short {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return c.Conn.Close()
+}
+
+// inject resets or stalls the connection, as drawn from s.
+func (c *Conn) inject(ctx context.Context, s *source) error {
+	if s.chance(c.config.ResetRate) {
+		c.Close()
+		return ErrReset
+	}
+	if s.chance(c.config.StallRate) {
+		return c.sleep(ctx, c.config.StallDuration)
+	}
+	return nil
+}
+
+// delay waits for the latency and for size bytes to go through the bandwidth.
+func (c *Conn) delay(ctx context.Context, s *source, size int) error {
+	d := c.config.Latency
+	if c.config.Jitter > 0 {
+		d += time.Duration(s.int63n(int64(c.config.Jitter) + 1))
+	}
+	if c.config.Bandwidth > 0 {
+		d += time.Duration(size) * time.Second / time.Duration(c.config.Bandwidth)
+	}
+	return c.sleep(ctx, d)
+}
+func (c *Conn) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return acceptor.ErrConnectionClosed
+	}
+}
+
+// corrupt returns b with a random byte flipped, as drawn from s. b itself is
+// left untouched.
+func (c *Conn) corrupt(s *source, b []byte) []byte {
+	if len(b) == 0 || !s.chance(c.config.CorruptRate) {
+		return b
+	}
+	b = append([]byte(nil), b...)
+	b[s.intn(len(b))] ^= byte(s.intn(255) + 1)
+	return b
+}
+
+// source is a random source safe for concurrent use.
+type source struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newSource(seed int64) *source {
+	return &source{rng: rand.New(rand.NewSource(seed))}
+}
+func (s *source) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Float64() < p
+}
+func (s *source) intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Intn(n)
+}
+func (s *source) int63n(n int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Int63n(n)
+}
@@ -0,0 +1,188 @@
+package fault
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/acceptortest"
+	"github.com/gotechbook/gotechbook-framework-acceptor/memory"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// pipe returns a client connection and the server connection wrapped with
+// config.
+func pipe(t *testing.T, config Config) (acceptor.Conn, *Conn) {
+	t.Helper()
+	m := memory.NewMemory("test")
+	a := NewAcceptor(m, config)
+	go a.ListenAndServe()
+	t.Cleanup(a.Stop)
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+	client, err := m.Dial()
+	assert.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	t.Cleanup(func() { conn.Close() })
+	return client, conn
+}
+
+// written returns what the client reads after the server wrote n packets.
+func written(t *testing.T, config Config, n int) []byte {
+	t.Helper()
+	client, conn := pipe(t, config)
+	for i := 0; i < n; i++ {
+		conn.WritePacket(acceptor.Data, bytes.Repeat([]byte{byte(i)}, 16))
+	}
+	conn.Close()
+	b, _ := io.ReadAll(client)
+	return b
+}
+
+func TestNoFaults(t *testing.T) {
+	client, conn := pipe(t, Config{})
+	assert.NoError(t, client.WritePacket(acceptor.Data, []byte{0x01}))
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, p.Data)
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x02}))
+	p, err = client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x02}, p.Data)
+	assert.Equal(t, acceptor.ErrWrongPacketType, conn.WritePacket(0x09, nil))
+}
+
+func TestDeterministic(t *testing.T) {
+	config := Config{Seed: 42, CorruptRate: 0.5, FragmentSize: 7, PartialWriteRate: 0.1}
+	first := written(t, config, 50)
+	assert.Equal(t, first, written(t, config, 50))
+	config.Seed = 43
+	assert.NotEqual(t, first, written(t, config, 50))
+}
+
+func TestSeedPerConnection(t *testing.T) {
+	config := Config{Seed: 42, CorruptRate: 0.5}
+	m := memory.NewMemory("test")
+	a := NewAcceptorFunc(m, func(n int, conn acceptor.Conn) Config {
+		c := config
+		c.Seed += int64(n)
+		assert.Equal(t, 0, n)
+		return c
+	})
+	go a.ListenAndServe()
+	defer a.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+	_, err := m.Dial()
+	assert.NoError(t, err)
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	assert.Equal(t, config, conn.config)
+}
+
+func TestCorrupt(t *testing.T) {
+	client, conn := pipe(t, Config{CorruptRate: 1})
+	data := bytes.Repeat([]byte{0xaa}, 64)
+	assert.NoError(t, client.WritePacket(acceptor.Data, data))
+	msg, err := conn.GetNextMessage()
+	assert.NoError(t, err)
+	want := append([]byte{acceptor.Data, 0x00, 0x00, 0x40}, data...)
+	diff := 0
+	for i := range msg {
+		if msg[i] != want[i] {
+			diff++
+		}
+	}
+	assert.Equal(t, 1, diff)
+
+	// the caller's buffer is left untouched
+	assert.NoError(t, conn.WritePacket(acceptor.Data, data))
+	assert.Equal(t, bytes.Repeat([]byte{0xaa}, 64), data)
+}
+
+func TestFragment(t *testing.T) {
+	client, conn := pipe(t, Config{FragmentSize: 3})
+	data := bytes.Repeat([]byte{0x01}, 100)
+	assert.NoError(t, conn.WritePacket(acceptor.Data, data))
+	// the stream puts the fragments back together
+	p, err := client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, data, p.Data)
+}
+
+func TestPartialWrite(t *testing.T) {
+	client, conn := pipe(t, Config{PartialWriteRate: 1})
+	n, err := conn.Write(make([]byte, 32))
+	assert.Equal(t, io.ErrShortWrite, err)
+	assert.Less(t, n, 32)
+	// there is nothing to cut short in an empty write
+	_, err = conn.Write(nil)
+	assert.NoError(t, err)
+	conn.Close()
+	b, _ := io.ReadAll(client)
+	assert.Len(t, b, n)
+}
+
+func TestReset(t *testing.T) {
+	client, conn := pipe(t, Config{ResetRate: 1})
+	_, err := conn.GetNextMessage()
+	assert.Equal(t, ErrReset, err)
+	_, err = client.GetNextMessage()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+}
+
+func TestLatency(t *testing.T) {
+	tables := []struct {
+		name    string
+		config  Config
+		size    int
+		minimum time.Duration
+	}{
+		{"test_1", Config{Latency: 20 * time.Millisecond}, 0, 20 * time.Millisecond},
+		{"test_2", Config{Latency: 10 * time.Millisecond, Jitter: 10 * time.Millisecond}, 0, 10 * time.Millisecond},
+		{"test_3", Config{Bandwidth: 100 * 1024}, 2048, 20 * time.Millisecond},
+		{"test_4", Config{StallRate: 1, StallDuration: 20 * time.Millisecond}, 0, 20 * time.Millisecond},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			client, conn := pipe(t, table.config)
+			start := time.Now()
+			assert.NoError(t, conn.WritePacket(acceptor.Data, make([]byte, table.size)))
+			assert.GreaterOrEqual(t, time.Since(start), table.minimum)
+			_, err := client.ReadPacket()
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCloseDuringStall(t *testing.T) {
+	_, conn := pipe(t, Config{StallRate: 1, StallDuration: time.Minute})
+	done := make(chan error)
+	go func() {
+		_, err := conn.GetNextMessage()
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	conn.Close()
+	assert.Equal(t, acceptor.ErrConnectionClosed, utils.ShouldEventuallyReceive(t, done, 100*time.Millisecond))
+}
+
+func TestConformance(t *testing.T) {
+	// without faults the wrapped connections behave as the inner ones
+	var last *memory.Memory
+	acceptortest.Run(t, acceptortest.Factory{
+		New: func() acceptor.Acceptor {
+			last = memory.NewMemory("test")
+			return NewAcceptor(last, Config{})
+		},
+		Dial: func(addr string) (acceptor.Conn, error) {
+			return last.Dial()
+		},
+		Stream: true,
+	})
+}
@@ -0,0 +1,161 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.2
+// 	protoc        (unknown)
+// source: acceptor.proto
+
+package grpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Packet struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type uint32 `protobuf:"varint,1,opt,name=type,proto3" json:"type,omitempty"`
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (x *Packet) Reset() {
+	*x = Packet{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_acceptor_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Packet) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet) ProtoMessage() {}
+
+func (x *Packet) ProtoReflect() protoreflect.Message {
+	mi := &file_acceptor_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet.ProtoReflect.Descriptor instead.
+func (*Packet) Descriptor() ([]byte, []int) {
+	return file_acceptor_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Packet) GetType() uint32 {
+	if x != nil {
+		return x.Type
+	}
+	return 0
+}
+
+func (x *Packet) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+var File_acceptor_proto protoreflect.FileDescriptor
+
+var file_acceptor_proto_rawDesc = []byte{
+	0x0a, 0x0e, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x12, 0x13, 0x67, 0x6f, 0x74, 0x65, 0x63, 0x68, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x61, 0x63, 0x63,
+	0x65, 0x70, 0x74, 0x6f, 0x72, 0x22, 0x30, 0x0a, 0x06, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x12,
+	0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x74,
+	0x79, 0x70, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x32, 0x53, 0x0a, 0x08, 0x41, 0x63, 0x63, 0x65, 0x70,
+	0x74, 0x6f, 0x72, 0x12, 0x47, 0x0a, 0x07, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x12, 0x1b,
+	0x2e, 0x67, 0x6f, 0x74, 0x65, 0x63, 0x68, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x61, 0x63, 0x63, 0x65,
+	0x70, 0x74, 0x6f, 0x72, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x1a, 0x1b, 0x2e, 0x67, 0x6f,
+	0x74, 0x65, 0x63, 0x68, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74, 0x6f,
+	0x72, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x28, 0x01, 0x30, 0x01, 0x42, 0x3a, 0x5a, 0x38,
+	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x67, 0x6f, 0x74, 0x65, 0x63,
+	0x68, 0x62, 0x6f, 0x6f, 0x6b, 0x2f, 0x67, 0x6f, 0x74, 0x65, 0x63, 0x68, 0x62, 0x6f, 0x6f, 0x6b,
+	0x2d, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x77, 0x6f, 0x72, 0x6b, 0x2d, 0x61, 0x63, 0x63, 0x65, 0x70,
+	0x74, 0x6f, 0x72, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_acceptor_proto_rawDescOnce sync.Once
+	file_acceptor_proto_rawDescData = file_acceptor_proto_rawDesc
+)
+
+func file_acceptor_proto_rawDescGZIP() []byte {
+	file_acceptor_proto_rawDescOnce.Do(func() {
+		file_acceptor_proto_rawDescData = protoimpl.X.CompressGZIP(file_acceptor_proto_rawDescData)
+	})
+	return file_acceptor_proto_rawDescData
+}
+
+var file_acceptor_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_acceptor_proto_goTypes = []any{
+	(*Packet)(nil), // 0: gotechbook.acceptor.Packet
+}
+var file_acceptor_proto_depIdxs = []int32{
+	0, // 0: gotechbook.acceptor.Acceptor.Connect:input_type -> gotechbook.acceptor.Packet
+	0, // 1: gotechbook.acceptor.Acceptor.Connect:output_type -> gotechbook.acceptor.Packet
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_acceptor_proto_init() }
+func file_acceptor_proto_init() {
+	if File_acceptor_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_acceptor_proto_msgTypes[0].Exporter = func(v any, i int) any {
+			switch v := v.(*Packet); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_acceptor_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_acceptor_proto_goTypes,
+		DependencyIndexes: file_acceptor_proto_depIdxs,
+		MessageInfos:      file_acceptor_proto_msgTypes,
+	}.Build()
+	File_acceptor_proto = out.File
+	file_acceptor_proto_rawDesc = nil
+	file_acceptor_proto_goTypes = nil
+	file_acceptor_proto_depIdxs = nil
+}
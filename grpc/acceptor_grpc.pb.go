@@ -0,0 +1,133 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package grpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// AcceptorClient is the client API for Acceptor service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AcceptorClient interface {
+	Connect(ctx context.Context, opts ...grpc.CallOption) (Acceptor_ConnectClient, error)
+}
+
+type acceptorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAcceptorClient(cc grpc.ClientConnInterface) AcceptorClient {
+	return &acceptorClient{cc}
+}
+
+func (c *acceptorClient) Connect(ctx context.Context, opts ...grpc.CallOption) (Acceptor_ConnectClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Acceptor_ServiceDesc.Streams[0], "/gotechbook.acceptor.Acceptor/Connect", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &acceptorConnectClient{stream}
+	return x, nil
+}
+
+type Acceptor_ConnectClient interface {
+	Send(*Packet) error
+	Recv() (*Packet, error)
+	grpc.ClientStream
+}
+
+type acceptorConnectClient struct {
+	grpc.ClientStream
+}
+
+func (x *acceptorConnectClient) Send(m *Packet) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *acceptorConnectClient) Recv() (*Packet, error) {
+	m := new(Packet)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// AcceptorServer is the server API for Acceptor service.
+// All implementations must embed UnimplementedAcceptorServer
+// for forward compatibility
+type AcceptorServer interface {
+	Connect(Acceptor_ConnectServer) error
+	mustEmbedUnimplementedAcceptorServer()
+}
+
+// UnimplementedAcceptorServer must be embedded to have forward compatible implementations.
+type UnimplementedAcceptorServer struct {
+}
+
+func (UnimplementedAcceptorServer) Connect(Acceptor_ConnectServer) error {
+	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
+}
+func (UnimplementedAcceptorServer) mustEmbedUnimplementedAcceptorServer() {}
+
+// UnsafeAcceptorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AcceptorServer will
+// result in compilation errors.
+type UnsafeAcceptorServer interface {
+	mustEmbedUnimplementedAcceptorServer()
+}
+
+func RegisterAcceptorServer(s grpc.ServiceRegistrar, srv AcceptorServer) {
+	s.RegisterService(&Acceptor_ServiceDesc, srv)
+}
+
+func _Acceptor_Connect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AcceptorServer).Connect(&acceptorConnectServer{stream})
+}
+
+type Acceptor_ConnectServer interface {
+	Send(*Packet) error
+	Recv() (*Packet, error)
+	grpc.ServerStream
+}
+
+type acceptorConnectServer struct {
+	grpc.ServerStream
+}
+
+func (x *acceptorConnectServer) Send(m *Packet) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *acceptorConnectServer) Recv() (*Packet, error) {
+	m := new(Packet)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Acceptor_ServiceDesc is the grpc.ServiceDesc for Acceptor service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Acceptor_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gotechbook.acceptor.Acceptor",
+	HandlerType: (*AcceptorServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Connect",
+			Handler:       _Acceptor_Connect_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "acceptor.proto",
+}
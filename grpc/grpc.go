@@ -0,0 +1,358 @@
+// Package grpc is an acceptor for clients speaking gRPC, such as bots.
+//
+// It serves the Acceptor service of acceptor.proto. Every Connect stream is a
+// connection, each message carries one packet.
+package grpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative acceptor.proto
+
+import (
+	"context"
+	"crypto/tls"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	logger "github.com/gotechbook/gotechbook-framework-logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var _ acceptor.Acceptor = (*GRPC)(nil)
+var _ acceptor.Conn = (*Conn)(nil)
+
+var codec = acceptor.NewPacketCodec()
+
+type GRPC struct {
+	addr     string
+	connChan chan acceptor.Conn
+	mu       sync.Mutex
+	listener net.Listener
+	server   *grpc.Server
+	certFile string
+	keyFile  string
+}
+
+func NewGRPC(addr string, certs ...string) *GRPC {
+	keyFile := ""
+	certFile := ""
+	if len(certs) != 2 && len(certs) != 0 {
+		panic(acceptor.ErrInvalidCertificates)
+	} else if len(certs) == 2 {
+		certFile = certs[0]
+		keyFile = certs[1]
+	}
+	return &GRPC{
+		addr:     addr,
+		connChan: make(chan acceptor.Conn),
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+}
+
+func (a *GRPC) GetAddr() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.listener != nil {
+		return a.listener.Addr().String()
+	}
+	return ""
+}
+func (a *GRPC) GetConnChan() chan acceptor.Conn {
+	return a.connChan
+}
+func (a *GRPC) Stop() {
+	a.mu.Lock()
+	server := a.server
+	a.mu.Unlock()
+	if server != nil {
+		server.Stop()
+	}
+}
+func (a *GRPC) ListenAndServe() {
+	var opts []grpc.ServerOption
+	if a.hasTLSCertificates() {
+		crt, err := tls.LoadX509KeyPair(a.certFile, a.keyFile)
+		if err != nil {
+			logger.Log.Fatalf("Failed to load x509: %s", err.Error())
+		}
+		opts = append(opts, grpc.Creds(credentials.NewServerTLSFromCert(&crt)))
+	}
+	listener, err := net.Listen("tcp", a.addr)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	server := grpc.NewServer(opts...)
+	RegisterAcceptorServer(server, &service{acceptor: a})
+	a.mu.Lock()
+	a.listener = listener
+	a.server = server
+	a.mu.Unlock()
+	if err := server.Serve(listener); err != nil {
+		logger.Log.Errorf("Failed to serve gRPC: %s", err.Error())
+	}
+}
+func (a *GRPC) hasTLSCertificates() bool {
+	return a.certFile != "" && a.keyFile != ""
+}
+
+type service struct {
+	UnimplementedAcceptorServer
+	acceptor *GRPC
+}
+
+// Connect hands the stream to the application and keeps it open until the
+// connection is closed.
+func (s *service) Connect(stream Acceptor_ConnectServer) error {
+	c := newConn(stream, s.acceptor.GetAddr())
+	select {
+	case s.acceptor.connChan <- c:
+	case <-stream.Context().Done():
+		c.Close()
+		return stream.Context().Err()
+	}
+	select {
+	case <-c.done:
+	case <-stream.Context().Done():
+		c.Close()
+	}
+	return nil
+}
+
+// Conn is a Connect stream. Reading runs in the background so reads can
+// honour deadlines and contexts without breaking the stream.
+type Conn struct {
+	stream   Acceptor_ConnectServer
+	md       metadata.MD
+	local    net.Addr
+	remote   net.Addr
+	messages chan []byte
+	err      error
+	buf      []byte
+	pending  []byte
+	writeMu  sync.Mutex
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+	deadlineSet   chan struct{}
+	done          chan struct{}
+	closeOnce     sync.Once
+}
+
+func newConn(stream Acceptor_ConnectServer, localAddr string) *Conn {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	c := &Conn{
+		stream:      stream,
+		md:          md,
+		local:       &net.TCPAddr{},
+		remote:      &net.TCPAddr{},
+		messages:    make(chan []byte),
+		deadlineSet: make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if addr, err := net.ResolveTCPAddr("tcp", localAddr); err == nil {
+		c.local = addr
+	}
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		c.remote = p.Addr
+	}
+	go c.receive()
+	return c
+}
+func (c *Conn) receive() {
+	defer close(c.messages)
+	for {
+		p, err := c.stream.Recv()
+		if err == nil && p.Type > 0xff {
+			err = acceptor.ErrWrongPacketType
+		}
+		if err == nil {
+			var b []byte
+			if b, err = codec.Encode(acceptor.Type(p.Type), p.Data); err == nil {
+				select {
+				case c.messages <- b:
+					continue
+				case <-c.done:
+					c.err = acceptor.ErrConnectionClosed
+					return
+				}
+			}
+		}
+		if err == io.EOF {
+			err = acceptor.ErrConnectionClosed
+		}
+		c.err = err
+		return
+	}
+}
+
+// Metadata returns the metadata the client sent with the stream.
+func (c *Conn) Metadata() metadata.MD {
+	return c.md
+}
+func (c *Conn) GetNextMessage() (b []byte, err error) {
+	return c.GetNextMessageContext(context.Background())
+}
+func (c *Conn) GetNextMessageContext(ctx context.Context) (b []byte, err error) {
+	for {
+		c.mu.Lock()
+		deadline, deadlineSet := c.readDeadline, c.deadlineSet
+		c.mu.Unlock()
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return nil, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+		b, retry, err := c.next(ctx, timeout, deadlineSet)
+		if timer != nil {
+			timer.Stop()
+		}
+		if !retry {
+			return b, err
+		}
+	}
+}
+
+// next waits for a message, retry tells the read deadline changed meanwhile.
+func (c *Conn) next(ctx context.Context, timeout <-chan time.Time, deadlineSet chan struct{}) (b []byte, retry bool, err error) {
+	select {
+	case b, ok := <-c.messages:
+		if !ok {
+			return nil, false, c.err
+		}
+		return b, false, nil
+	case <-c.done:
+		return nil, false, acceptor.ErrConnectionClosed
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	case <-timeout:
+		return nil, false, os.ErrDeadlineExceeded
+	case <-deadlineSet:
+		return nil, true, nil
+	}
+}
+func (c *Conn) ReadPacket() (*acceptor.Packet, error) {
+	b, err := c.GetNextMessage()
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < acceptor.HeadLength {
+		return nil, acceptor.ErrInvalidHeader
+	}
+	size, typ, err := acceptor.ParseHeader(b[:acceptor.HeadLength])
+	if err != nil {
+		return nil, err
+	}
+	return &acceptor.Packet{Type: typ, Length: size, Data: b[acceptor.HeadLength:]}, nil
+}
+func (c *Conn) WritePacket(typ acceptor.Type, data []byte) error {
+	if typ < acceptor.Handshake || typ > acceptor.Kick {
+		return acceptor.ErrWrongPacketType
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.send(typ, data)
+}
+func (c *Conn) send(typ acceptor.Type, data []byte) error {
+	select {
+	case <-c.done:
+		return acceptor.ErrConnectionClosed
+	default:
+	}
+	c.mu.Lock()
+	deadline := c.writeDeadline
+	c.mu.Unlock()
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return os.ErrDeadlineExceeded
+	}
+	return c.stream.Send(&Packet{Type: uint32(typ), Data: data})
+}
+
+// Read reads the packets of the stream as bytes in the TCP packet framing.
+func (c *Conn) Read(b []byte) (int, error) {
+	if len(c.buf) == 0 {
+		msg, err := c.GetNextMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.buf = msg
+	}
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// Write sends every complete packet of b, which is in the TCP packet framing.
+// The bytes of an incomplete packet are kept until the rest is written.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.pending = append(c.pending, b...)
+	for len(c.pending) >= acceptor.HeadLength {
+		size, typ, err := acceptor.ParseHeader(c.pending[:acceptor.HeadLength])
+		if err != nil {
+			c.pending = nil
+			return 0, err
+		}
+		if len(c.pending) < acceptor.HeadLength+size {
+			break
+		}
+		if err := c.send(typ, c.pending[acceptor.HeadLength:acceptor.HeadLength+size]); err != nil {
+			return 0, err
+		}
+		c.pending = c.pending[acceptor.HeadLength+size:]
+	}
+	c.pending = append([]byte(nil), c.pending...)
+	return len(b), nil
+}
+
+// CloseWrite ends the stream. gRPC can't half-close a stream from the server,
+// so reading stops as well.
+func (c *Conn) CloseWrite() error {
+	return c.Close()
+}
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
+func (c *Conn) LocalAddr() net.Addr {
+	return c.local
+}
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+func (c *Conn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	close(c.deadlineSet)
+	c.deadlineSet = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline fails writes once t passed. A write already blocked by
+// flow control isn't interrupted.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
@@ -0,0 +1,193 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+var grpcAcceptorTables = []struct {
+	name     string
+	addr     string
+	certs    []string
+	panicErr error
+}{
+	{"test_1", "127.0.0.1:0", []string{"../fixtures/server.crt", "../fixtures/server.key"}, nil},
+	{"test_2", "127.0.0.1:0", []string{}, nil},
+	{"test_3", "127.0.0.1:0", []string{"wqd"}, acceptor.ErrInvalidCertificates},
+	{"test_4", "127.0.0.1:0", []string{"wqd", "wqdqwd", "wqdqdqwd"}, acceptor.ErrInvalidCertificates},
+}
+
+func TestNewGRPC(t *testing.T) {
+	t.Parallel()
+	for _, table := range grpcAcceptorTables {
+		t.Run(table.name, func(t *testing.T) {
+			if table.panicErr != nil {
+				assert.PanicsWithValue(t, table.panicErr, func() {
+					NewGRPC(table.addr, table.certs...)
+				})
+				return
+			}
+			a := NewGRPC(table.addr, table.certs...)
+			assert.NotNil(t, a.GetConnChan())
+			assert.Equal(t, len(table.certs) == 2, a.hasTLSCertificates())
+			// returns nothing because not listening yet
+			assert.Equal(t, "", a.GetAddr())
+		})
+	}
+}
+
+func mustConnect(t *testing.T, a *GRPC, creds credentials.TransportCredentials, md metadata.MD) (Acceptor_ConnectClient, func()) {
+	t.Helper()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	cc, err := grpc.Dial(a.GetAddr(), grpc.WithTransportCredentials(creds))
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(context.Background(), md))
+	stream, err := NewAcceptorClient(cc).Connect(ctx)
+	assert.NoError(t, err)
+	return stream, func() {
+		cancel()
+		cc.Close()
+	}
+}
+
+func TestListenAndServe(t *testing.T) {
+	for _, tlsEnabled := range []bool{false, true} {
+		t.Run(map[bool]string{false: "insecure", true: "tls"}[tlsEnabled], func(t *testing.T) {
+			a := NewGRPC("127.0.0.1:0")
+			creds := insecure.NewCredentials()
+			if tlsEnabled {
+				a = NewGRPC("127.0.0.1:0", "../fixtures/server.crt", "../fixtures/server.key")
+				creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})
+			}
+			go a.ListenAndServe()
+			defer a.Stop()
+
+			stream, cleanup := mustConnect(t, a, creds, metadata.Pairs("x-client-version", "1.2.3"))
+			defer cleanup()
+			assert.NoError(t, stream.Send(&Packet{Type: acceptor.Data, Data: []byte{0x01}}))
+			conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(*Conn)
+			defer conn.Close()
+			assert.Equal(t, []string{"1.2.3"}, conn.Metadata().Get("x-client-version"))
+			assert.Equal(t, a.GetAddr(), conn.LocalAddr().String())
+			assert.Equal(t, "127.0.0.1", conn.RemoteAddr().(*net.TCPAddr).IP.String())
+
+			msg, err := conn.GetNextMessage()
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x01}, msg)
+
+			assert.NoError(t, conn.WritePacket(acceptor.Heartbeat, nil))
+			p, err := stream.Recv()
+			assert.NoError(t, err)
+			assert.Equal(t, uint32(acceptor.Heartbeat), p.Type)
+
+			// writes in the TCP framing are split into messages
+			_, err = conn.Write([]byte{0x04, 0x00, 0x00, 0x01, 0x02, 0x04, 0x00})
+			assert.NoError(t, err)
+			_, err = conn.Write([]byte{0x00, 0x01, 0x03})
+			assert.NoError(t, err)
+			for _, expected := range []byte{0x02, 0x03} {
+				p, err = stream.Recv()
+				assert.NoError(t, err)
+				assert.Equal(t, []byte{expected}, p.Data)
+			}
+
+			assert.Equal(t, acceptor.ErrWrongPacketType, conn.WritePacket(0x09, nil))
+		})
+	}
+}
+
+func TestReadDeadlineAndContext(t *testing.T) {
+	a := NewGRPC("127.0.0.1:0")
+	go a.ListenAndServe()
+	defer a.Stop()
+	stream, cleanup := mustConnect(t, a, insecure.NewCredentials(), nil)
+	defer cleanup()
+	assert.NoError(t, stream.Send(&Packet{Type: acceptor.Heartbeat}))
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(*Conn)
+	defer conn.Close()
+	_, err := conn.ReadPacket()
+	assert.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = conn.GetNextMessage()
+	netErr, ok := err.(net.Error)
+	assert.True(t, ok && netErr.Timeout())
+	conn.SetReadDeadline(time.Time{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = conn.GetNextMessageContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// nothing was lost by the interrupted reads
+	assert.NoError(t, stream.Send(&Packet{Type: acceptor.Data, Data: []byte{0x01}}))
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, p.Data)
+
+	assert.NoError(t, stream.CloseSend())
+	_, err = conn.GetNextMessage()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+}
+
+func TestClose(t *testing.T) {
+	a := NewGRPC("127.0.0.1:0")
+	go a.ListenAndServe()
+	defer a.Stop()
+	stream, cleanup := mustConnect(t, a, insecure.NewCredentials(), nil)
+	defer cleanup()
+	assert.NoError(t, stream.Send(&Packet{Type: acceptor.Heartbeat}))
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(*Conn)
+	conn.Close()
+	for i := 0; i < 50; i++ {
+		_, err := conn.GetNextMessage()
+		assert.Equal(t, acceptor.ErrConnectionClosed, err)
+		_, err = conn.ReadPacket()
+		assert.Equal(t, acceptor.ErrConnectionClosed, err)
+	}
+}
+
+func TestWrongPacketType(t *testing.T) {
+	a := NewGRPC("127.0.0.1:0")
+	go a.ListenAndServe()
+	defer a.Stop()
+	stream, cleanup := mustConnect(t, a, insecure.NewCredentials(), nil)
+	defer cleanup()
+	// the type doesn't fit in the header, it isn't read as Data
+	assert.NoError(t, stream.Send(&Packet{Type: 0x100 + acceptor.Data}))
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(*Conn)
+	defer conn.Close()
+	_, err := conn.GetNextMessage()
+	assert.Equal(t, acceptor.ErrWrongPacketType, err)
+}
+
+func TestSendKick(t *testing.T) {
+	a := NewGRPC("127.0.0.1:0")
+	go a.ListenAndServe()
+	defer a.Stop()
+	stream, cleanup := mustConnect(t, a, insecure.NewCredentials(), nil)
+	defer cleanup()
+	assert.NoError(t, stream.Send(&Packet{Type: acceptor.Heartbeat}))
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(*Conn)
+
+	assert.NoError(t, acceptor.SendKick(conn, &acceptor.KickReason{Code: acceptor.KickCodeKicked}))
+	p, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(acceptor.Kick), p.Type)
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
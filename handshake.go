@@ -0,0 +1,147 @@
+package acceptor
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const HandshakeCodeOK = 200
+
+var (
+	ErrHandshakeRequired = errors.New("handshake required before data")
+	ErrInvalidHandshake  = errors.New("invalid handshake payload")
+)
+
+var _ Acceptor = (*HandshakeAcceptor)(nil)
+
+// HandshakeClientData is the "sys" section of a client handshake.
+type HandshakeClientData struct {
+	Platform    string `json:"platform"`
+	LibVersion  string `json:"libVersion"`
+	BuildNumber string `json:"clientBuildNumber"`
+	Version     string `json:"clientVersion"`
+}
+
+// HandshakeData is the JSON payload of a Handshake packet.
+type HandshakeData struct {
+	Sys  HandshakeClientData    `json:"sys"`
+	User map[string]interface{} `json:"user,omitempty"`
+}
+
+// HandshakeAckData is the JSON payload of the HandshakeAck packet sent back to the client.
+type HandshakeAckData struct {
+	Code int             `json:"code"`
+	Sys  HandshakeAckSys `json:"sys"`
+}
+
+type HandshakeAckSys struct {
+	Heartbeat int               `json:"heartbeat"`
+	Dict      map[string]uint16 `json:"dict,omitempty"`
+}
+
+type HandshakeConfig struct {
+	// Timeout bounds how long a client may take to send its handshake. It
+	// sets the read deadline of the connection, which is cleared once the
+	// handshake ended. Leave it zero to keep a deadline set by the caller.
+	Timeout time.Duration
+	// Heartbeat is the interval advertised to the client in the ack.
+	Heartbeat time.Duration
+	// Dict is the route dictionary advertised to the client in the ack.
+	Dict map[string]uint16
+	// Validate, when set, can refuse a handshake by returning an error.
+	Validate func(*HandshakeData) error
+	// OnFailure, when set, is called by HandshakeAcceptor with the connections
+	// whose handshake failed, before closing them.
+	OnFailure func(conn Conn, err error)
+}
+
+func NewDefaultHandshakeConfig() HandshakeConfig {
+	return HandshakeConfig{
+		Timeout:   5 * time.Second,
+		Heartbeat: 30 * time.Second,
+	}
+}
+
+// HandshakeAcceptor wraps an Acceptor and only delivers connections whose
+// handshake succeeded. Connections are delivered as *HandshakeConn.
+type HandshakeAcceptor struct {
+	*WrapAcceptor
+}
+
+func NewHandshakeAcceptor(a Acceptor, config HandshakeConfig) *HandshakeAcceptor {
+	return &HandshakeAcceptor{NewWrapAcceptor(a, func(_ int, conn Conn) (Conn, error) {
+		data, err := ServerHandshake(conn, config)
+		if err != nil {
+			if config.OnFailure != nil {
+				config.OnFailure(conn, err)
+			}
+			return nil, err
+		}
+		return &HandshakeConn{Conn: conn, data: data}, nil
+	})}
+}
+
+// ServerHandshake runs the server side of the handshake on conn: it waits for a
+// Handshake packet, validates it and answers with a HandshakeAck. Heartbeats
+// received before the handshake are ignored, any other packet is an error.
+//
+// With a Timeout, the read deadline of conn is set for the handshake and
+// cleared once it ended: Conn can't tell the deadline set before, so it is
+// lost. Without a Timeout, the read deadline of conn is left as it is.
+func ServerHandshake(conn Conn, config HandshakeConfig) (*HandshakeData, error) {
+	if config.Timeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(config.Timeout)); err != nil {
+			return nil, err
+		}
+		defer conn.SetReadDeadline(time.Time{})
+	}
+	p, err := conn.ReadPacket()
+	for err == nil && p.Type == Heartbeat {
+		p, err = conn.ReadPacket()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.Type != Handshake {
+		return nil, ErrHandshakeRequired
+	}
+
+	data := &HandshakeData{}
+	if err := json.Unmarshal(p.Data, data); err != nil {
+		return nil, ErrInvalidHandshake
+	}
+	if config.Validate != nil {
+		if err := config.Validate(data); err != nil {
+			return nil, err
+		}
+	}
+	ack, err := json.Marshal(&HandshakeAckData{
+		Code: HandshakeCodeOK,
+		Sys: HandshakeAckSys{
+			Heartbeat: int(config.Heartbeat / time.Second),
+			Dict:      config.Dict,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.WritePacket(HandshakeAck, ack); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// HandshakeConn is a Conn whose handshake has completed.
+type HandshakeConn struct {
+	Conn
+	data *HandshakeData
+}
+
+// Unwrap returns the wrapped connection.
+func (c *HandshakeConn) Unwrap() Conn {
+	return c.Conn
+}
+func (c *HandshakeConn) HandshakeData() *HandshakeData {
+	return c.data
+}
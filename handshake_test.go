@@ -0,0 +1,198 @@
+package acceptor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pipeConn is a minimal framed Conn over one end of a net.Pipe.
+type pipeConn struct {
+	net.Conn
+}
+
+func newPipeConns() (*pipeConn, *pipeConn) {
+	server, client := net.Pipe()
+	return &pipeConn{server}, &pipeConn{client}
+}
+
+func (c *pipeConn) GetNextMessage() ([]byte, error) {
+	header := make([]byte, HeadLength)
+	if _, err := io.ReadFull(c.Conn, header); err != nil {
+		return nil, err
+	}
+	size, _, err := ParseHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(c.Conn, body); err != nil {
+		return nil, err
+	}
+	return append(header, body...), nil
+}
+func (c *pipeConn) GetNextMessageContext(ctx context.Context) ([]byte, error) {
+	return c.GetNextMessage()
+}
+func (c *pipeConn) ReadPacket() (*Packet, error) {
+	b, err := c.GetNextMessage()
+	if err != nil {
+		return nil, err
+	}
+	return &Packet{Type: Type(b[0]), Length: len(b) - HeadLength, Data: b[HeadLength:]}, nil
+}
+func (c *pipeConn) WritePacket(typ Type, data []byte) error {
+	b, err := NewPacketCodec().Encode(typ, data)
+	if err != nil {
+		return err
+	}
+	_, err = c.Conn.Write(b)
+	return err
+}
+
+type chanAcceptor struct {
+	connChan chan Conn
+	stopChan chan struct{}
+}
+
+func newChanAcceptor() *chanAcceptor {
+	return &chanAcceptor{connChan: make(chan Conn), stopChan: make(chan struct{})}
+}
+
+func (a *chanAcceptor) ListenAndServe()        { <-a.stopChan }
+func (a *chanAcceptor) Stop()                  { close(a.stopChan) }
+func (a *chanAcceptor) GetAddr() string        { return "chan" }
+func (a *chanAcceptor) GetConnChan() chan Conn { return a.connChan }
+
+var handshakePayload = []byte(`{"sys":{"platform":"android","libVersion":"1.0.0","clientVersion":"2.1"},"user":{"id":"a"}}`)
+
+var handshakeTables = map[string]struct {
+	packets  []*Packet
+	validate func(*HandshakeData) error
+	err      error
+}{
+	"test_handshake":                {[]*Packet{{Type: Handshake, Data: handshakePayload}}, nil, nil},
+	"test_heartbeat_then_handshake": {[]*Packet{{Type: Heartbeat}, {Type: Handshake, Data: handshakePayload}}, nil, nil},
+	"test_data_before_handshake":    {[]*Packet{{Type: Data, Data: []byte{0x01}}}, nil, ErrHandshakeRequired},
+	"test_invalid_payload":          {[]*Packet{{Type: Handshake, Data: []byte("{")}}, nil, ErrInvalidHandshake},
+	"test_validate_error":           {[]*Packet{{Type: Handshake, Data: handshakePayload}}, func(*HandshakeData) error { return io.EOF }, io.EOF},
+}
+
+func TestHandshake(t *testing.T) {
+	t.Parallel()
+	for name, table := range handshakeTables {
+		t.Run(name, func(t *testing.T) {
+			server, client := newPipeConns()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				for _, p := range table.packets {
+					if client.WritePacket(p.Type, p.Data) != nil {
+						return
+					}
+				}
+			}()
+
+			config := NewDefaultHandshakeConfig()
+			config.Dict = map[string]uint16{"room.join": 1}
+			config.Validate = table.validate
+			ackChan := make(chan *Packet, 1)
+			if table.err == nil {
+				go func() {
+					p, _ := client.ReadPacket()
+					ackChan <- p
+				}()
+			}
+
+			data, err := ServerHandshake(server, config)
+			if table.err != nil {
+				assert.Equal(t, table.err, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "android", data.Sys.Platform)
+			assert.Equal(t, "2.1", data.Sys.Version)
+
+			ack := <-ackChan
+			assert.Equal(t, Type(HandshakeAck), ack.Type)
+			ackData := &HandshakeAckData{}
+			assert.NoError(t, json.Unmarshal(ack.Data, ackData))
+			assert.Equal(t, HandshakeCodeOK, ackData.Code)
+			assert.Equal(t, 30, ackData.Sys.Heartbeat)
+			assert.Equal(t, config.Dict, ackData.Sys.Dict)
+		})
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	t.Parallel()
+	server, client := newPipeConns()
+	defer server.Close()
+	defer client.Close()
+
+	config := NewDefaultHandshakeConfig()
+	config.Timeout = 10 * time.Millisecond
+	_, err := ServerHandshake(server, config)
+	var netErr net.Error
+	assert.True(t, errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func TestHandshakeCallerDeadline(t *testing.T) {
+	t.Parallel()
+	server, client := newPipeConns()
+	defer server.Close()
+	defer client.Close()
+
+	// without a timeout, the deadline of the caller bounds the handshake
+	config := NewDefaultHandshakeConfig()
+	config.Timeout = 0
+	server.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err := ServerHandshake(server, config)
+	var netErr net.Error
+	assert.True(t, errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func TestHandshakeAcceptor(t *testing.T) {
+	t.Parallel()
+	inner := newChanAcceptor()
+	failures := make(chan error, 1)
+	config := NewDefaultHandshakeConfig()
+	config.OnFailure = func(conn Conn, err error) {
+		failures <- err
+	}
+	h := NewHandshakeAcceptor(inner, config)
+	go h.ListenAndServe()
+	defer h.Stop()
+	assert.Equal(t, "chan", h.GetAddr())
+
+	rejected, rejectedClient := newPipeConns()
+	inner.connChan <- rejected
+	assert.NoError(t, rejectedClient.WritePacket(Data, []byte{0x01}))
+	_, err := rejectedClient.ReadPacket()
+	assert.Error(t, err)
+	assert.Equal(t, ErrHandshakeRequired, <-failures)
+
+	server, client := newPipeConns()
+	defer client.Close()
+	inner.connChan <- server
+	assert.NoError(t, client.WritePacket(Handshake, handshakePayload))
+	ack, err := client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, Type(HandshakeAck), ack.Type)
+
+	select {
+	case conn := <-h.GetConnChan():
+		hc, ok := conn.(*HandshakeConn)
+		assert.True(t, ok)
+		assert.Equal(t, "android", hc.HandshakeData().Sys.Platform)
+	case <-time.After(time.Second):
+		t.Fatal("connection was not delivered")
+	}
+}
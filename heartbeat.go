@@ -0,0 +1,257 @@
+package acceptor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrHeartbeatTimeout = errors.New("heartbeat timeout")
+
+var (
+	_ Acceptor = (*HeartbeatAcceptor)(nil)
+	_ Conn     = (*HeartbeatConn)(nil)
+)
+
+type HeartbeatConfig struct {
+	// Interval is how often the server sends a heartbeat, zero disables
+	// sending heartbeats and liveness tracking.
+	Interval time.Duration
+	// MaxMissed is how many intervals may pass without any packet from the
+	// client before it is kicked, zero never kicks.
+	MaxMissed int
+}
+
+func NewDefaultHeartbeatConfig() HeartbeatConfig {
+	return HeartbeatConfig{
+		Interval:  30 * time.Second,
+		MaxMissed: 3,
+	}
+}
+
+// HeartbeatAcceptor wraps an Acceptor and delivers its connections as *HeartbeatConn.
+type HeartbeatAcceptor struct {
+	*WrapAcceptor
+}
+
+func NewHeartbeatAcceptor(a Acceptor, config HeartbeatConfig) *HeartbeatAcceptor {
+	return &HeartbeatAcceptor{NewWrapAcceptor(a, func(_ int, conn Conn) (Conn, error) {
+		return NewHeartbeatConn(conn, config), nil
+	})}
+}
+
+// HeartbeatConn answers client heartbeats, sends server heartbeats and kicks
+// the client when it stops sending packets. Heartbeat packets are never
+// returned to the caller.
+//
+// The connection is read by a background goroutine, so it must only be read
+// through GetNextMessage, GetNextMessageContext or ReadPacket.
+type HeartbeatConn struct {
+	Conn
+	config    HeartbeatConfig
+	messages  chan []byte
+	err       error
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu           sync.Mutex
+	lastSeen     time.Time
+	delivering   bool
+	awaiting     bool
+	expired      bool
+	readDeadline time.Time
+	deadlineSet  chan struct{}
+}
+
+func NewHeartbeatConn(conn Conn, config HeartbeatConfig) *HeartbeatConn {
+	c := &HeartbeatConn{
+		Conn:        conn,
+		config:      config,
+		messages:    make(chan []byte),
+		done:        make(chan struct{}),
+		lastSeen:    time.Now(),
+		deadlineSet: make(chan struct{}),
+	}
+	go c.read()
+	if config.Interval > 0 {
+		go c.tick()
+	}
+	return c
+}
+
+// Unwrap returns the wrapped connection.
+func (c *HeartbeatConn) Unwrap() Conn {
+	return c.Conn
+}
+func (c *HeartbeatConn) GetNextMessage() (b []byte, err error) {
+	return c.GetNextMessageContext(context.Background())
+}
+func (c *HeartbeatConn) GetNextMessageContext(ctx context.Context) (b []byte, err error) {
+	for {
+		c.mu.Lock()
+		deadline, deadlineSet := c.readDeadline, c.deadlineSet
+		c.mu.Unlock()
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+		b, retry, err := c.next(ctx, timeout, deadlineSet)
+		if timer != nil {
+			timer.Stop()
+		}
+		if !retry {
+			return b, err
+		}
+	}
+}
+
+// next waits for a message, retry tells the read deadline changed meanwhile.
+func (c *HeartbeatConn) next(ctx context.Context, timeout <-chan time.Time, deadlineSet chan struct{}) (b []byte, retry bool, err error) {
+	select {
+	case b, ok := <-c.messages:
+		if !ok {
+			return nil, false, c.err
+		}
+		return b, false, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	case <-timeout:
+		return nil, false, os.ErrDeadlineExceeded
+	case <-deadlineSet:
+		return nil, true, nil
+	}
+}
+func (c *HeartbeatConn) ReadPacket() (*Packet, error) {
+	b, err := c.GetNextMessage()
+	if err != nil {
+		return nil, err
+	}
+	return &Packet{Type: Type(b[0]), Length: len(b) - HeadLength, Data: b[HeadLength:]}, nil
+}
+func (c *HeartbeatConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// SetReadDeadline also applies to the reads already waiting.
+func (c *HeartbeatConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	close(c.deadlineSet)
+	c.deadlineSet = make(chan struct{})
+	return nil
+}
+func (c *HeartbeatConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return c.Conn.Close()
+}
+func (c *HeartbeatConn) read() {
+	defer close(c.messages)
+	for {
+		b, err := c.Conn.GetNextMessage()
+		if err != nil {
+			if c.isExpired() {
+				// the kick was flushed, or the client is gone
+				c.Close()
+				err = ErrHeartbeatTimeout
+			}
+			c.err = err
+			return
+		}
+		if c.isExpired() {
+			// the client was kicked, drain it until it closes
+			continue
+		}
+		if c.seen(Type(b[0])) {
+			c.Conn.WritePacket(Heartbeat, nil)
+		}
+		if Type(b[0]) == Heartbeat {
+			continue
+		}
+		c.setDelivering(true)
+		select {
+		case c.messages <- b:
+		case <-c.done:
+			c.err = ErrConnectionClosed
+			return
+		}
+		c.setDelivering(false)
+	}
+}
+
+// seen records activity from the client and reports whether a heartbeat must
+// be answered. A client heartbeat received while the server waits for the
+// answer to its own heartbeat is taken as that answer.
+func (c *HeartbeatConn) seen(typ Type) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastSeen = time.Now()
+	if typ != Heartbeat {
+		return false
+	}
+	reply := !c.awaiting
+	c.awaiting = false
+	return reply
+}
+func (c *HeartbeatConn) setDelivering(delivering bool) {
+	c.mu.Lock()
+	c.delivering = delivering
+	c.mu.Unlock()
+}
+func (c *HeartbeatConn) tick() {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+		if c.expire() {
+			c.kick()
+			return
+		}
+		c.mu.Lock()
+		c.awaiting = true
+		c.mu.Unlock()
+		if err := c.Conn.WritePacket(Heartbeat, nil); err != nil {
+			return
+		}
+	}
+}
+
+// kick sends the heartbeat timeout kick like SendKick, except that the client
+// is drained by the background reader: a read from the timer goroutine would
+// take the messages of the application.
+func (c *HeartbeatConn) kick() {
+	flushing, err := writeKick(c.Conn, &KickReason{Code: KickCodeHeartbeatTimeout, Message: ErrHeartbeatTimeout.Error()})
+	if err != nil || !flushing {
+		c.Close()
+		return
+	}
+	c.Conn.SetReadDeadline(time.Now().Add(KickFlushTimeout))
+}
+func (c *HeartbeatConn) isExpired() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expired
+}
+
+// expire marks the connection as expired when the client missed too many
+// intervals. A client is never expired while a packet of it waits to be read.
+func (c *HeartbeatConn) expire() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.config.MaxMissed <= 0 || c.delivering {
+		return false
+	}
+	c.expired = time.Since(c.lastSeen) > c.config.Interval*time.Duration(c.config.MaxMissed)
+	return c.expired
+}
@@ -0,0 +1,148 @@
+package acceptor
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeatConnReplyAndFilter(t *testing.T) {
+	t.Parallel()
+	server, client := newPipeConns()
+	defer client.Close()
+	c := NewHeartbeatConn(server, HeartbeatConfig{})
+	defer c.Close()
+
+	go func() {
+		client.WritePacket(Heartbeat, nil)
+		client.WritePacket(Data, []byte{0x01})
+	}()
+
+	reply, err := client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, Type(Heartbeat), reply.Type)
+
+	p, err := c.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, &Packet{Type: Data, Length: 1, Data: []byte{0x01}}, p)
+}
+
+func TestHeartbeatConnKick(t *testing.T) {
+	t.Parallel()
+	server, client := newPipeConns()
+	defer client.Close()
+	c := NewHeartbeatConn(server, HeartbeatConfig{Interval: 10 * time.Millisecond, MaxMissed: 2})
+	defer c.Close()
+
+	packets := make(chan *Packet, 10)
+	go func() {
+		defer close(packets)
+		for {
+			p, err := client.ReadPacket()
+			if err != nil {
+				return
+			}
+			packets <- p
+		}
+	}()
+
+	_, err := c.ReadPacket()
+	assert.Equal(t, ErrHeartbeatTimeout, err)
+
+	var received []*Packet
+	for p := range packets {
+		received = append(received, p)
+	}
+	assert.Equal(t, Type(Heartbeat), received[0].Type)
+	kick := received[len(received)-1]
+	assert.Equal(t, Type(Kick), kick.Type)
+	reason, err := ParseKick(kick.Data)
+	assert.NoError(t, err)
+	assert.Equal(t, KickCodeHeartbeatTimeout, reason.Code)
+}
+
+func TestHeartbeatConnAnswerIsNotEchoed(t *testing.T) {
+	t.Parallel()
+	server, client := newPipeConns()
+	defer client.Close()
+	c := NewHeartbeatConn(server, HeartbeatConfig{Interval: 20 * time.Millisecond})
+	defer c.Close()
+
+	p, err := client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, Type(Heartbeat), p.Type)
+	assert.NoError(t, client.WritePacket(Heartbeat, nil))
+
+	// the next packet must be the following server heartbeat, not an echo
+	client.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = client.ReadPacket()
+	assert.Error(t, err)
+	client.SetReadDeadline(time.Time{})
+	p, err = client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, Type(Heartbeat), p.Type)
+}
+
+func TestHeartbeatConnContextAndDeadline(t *testing.T) {
+	t.Parallel()
+	server, client := newPipeConns()
+	defer client.Close()
+	c := NewHeartbeatConn(server, HeartbeatConfig{})
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.GetNextMessageContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = c.GetNextMessage()
+	assert.Error(t, err)
+	c.SetReadDeadline(time.Time{})
+
+	go client.WritePacket(Data, []byte{0x02})
+	b, err := c.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{Data, 0x00, 0x00, 0x01, 0x02}, b)
+}
+
+func TestHeartbeatConnDeadlineDuringRead(t *testing.T) {
+	t.Parallel()
+	server, client := newPipeConns()
+	defer client.Close()
+	c := NewHeartbeatConn(server, HeartbeatConfig{})
+	defer c.Close()
+
+	// the deadline is set while the read already waits
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	}()
+	_, err := c.GetNextMessage()
+	assert.Equal(t, os.ErrDeadlineExceeded, err)
+}
+
+func TestHeartbeatAcceptor(t *testing.T) {
+	t.Parallel()
+	inner := newChanAcceptor()
+	h := NewHeartbeatAcceptor(inner, NewDefaultHeartbeatConfig())
+	go h.ListenAndServe()
+	defer h.Stop()
+
+	server, client := newPipeConns()
+	defer client.Close()
+	inner.connChan <- server
+
+	select {
+	case conn := <-h.GetConnChan():
+		hc, ok := conn.(*HeartbeatConn)
+		assert.True(t, ok)
+		assert.Equal(t, server, hc.Unwrap())
+		hc.Close()
+	case <-time.After(time.Second):
+		t.Fatal("connection was not delivered")
+	}
+}
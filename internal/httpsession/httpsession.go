@@ -0,0 +1,188 @@
+// Package httpsession holds what the sessions of the HTTP acceptors, long
+// polling and Server-Sent Events, have in common: a byte stream whose
+// upstream bytes arrive in request bodies, the deadlines of a net.Conn and
+// the way a session ends.
+package httpsession
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Session is the shared part of a session, the acceptors embed it and add
+// the downstream. Its fields are guarded by Mu.
+type Session struct {
+	Mu sync.Mutex
+	// Upstream holds the bytes received and not read yet.
+	Upstream bytes.Buffer
+
+	ReadDeadline  time.Time
+	WriteDeadline time.Time
+	// WriteClosed ends the downstream, RemoteClosed tells the client ended
+	// the session and Closed that the application did.
+	WriteClosed  bool
+	RemoteClosed bool
+	Closed       bool
+	// Dead is set and Die closed once the session ended, Err tells why.
+	Dead bool
+	Err  error
+	Die  chan struct{}
+
+	local   net.Addr
+	remote  net.Addr
+	wake    chan struct{}
+	onClose func()
+}
+
+// New returns a session, onClose is called once it ended.
+func New(local, remote net.Addr, onClose func()) *Session {
+	return &Session{
+		Die:     make(chan struct{}),
+		local:   local,
+		remote:  remote,
+		wake:    make(chan struct{}),
+		onClose: onClose,
+	}
+}
+
+// SignalLocked wakes up everything waiting for a change of the session.
+func (s *Session) SignalLocked() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// WaitLocked releases the lock until the session changes, the deadline
+// passes or cancel is closed.
+func (s *Session) WaitLocked(deadline time.Time, cancel <-chan struct{}) error {
+	wake := s.wake
+	s.Mu.Unlock()
+	defer s.Mu.Lock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-wake:
+	case <-cancel:
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+func (s *Session) Read(b []byte) (int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	for {
+		if s.Closed {
+			return 0, net.ErrClosed
+		}
+		if s.Upstream.Len() > 0 {
+			return s.Upstream.Read(b)
+		}
+		if s.RemoteClosed {
+			return 0, io.EOF
+		}
+		if s.Err != nil {
+			return 0, s.Err
+		}
+		if err := s.WaitLocked(s.ReadDeadline, nil); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// CloseWrite ends the downstream once what was written so far is delivered.
+func (s *Session) CloseWrite() error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.WriteClosed = true
+	s.SignalLocked()
+	return nil
+}
+func (s *Session) Close() error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	if s.Closed {
+		return net.ErrClosed
+	}
+	s.Closed = true
+	s.WriteClosed = true
+	s.KillLocked(net.ErrClosed)
+	return nil
+}
+func (s *Session) LocalAddr() net.Addr {
+	return s.local
+}
+func (s *Session) RemoteAddr() net.Addr {
+	return s.remote
+}
+func (s *Session) SetDeadline(t time.Time) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.ReadDeadline = t
+	s.WriteDeadline = t
+	s.SignalLocked()
+	return nil
+}
+func (s *Session) SetReadDeadline(t time.Time) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.ReadDeadline = t
+	s.SignalLocked()
+	return nil
+}
+func (s *Session) SetWriteDeadline(t time.Time) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.WriteDeadline = t
+	s.SignalLocked()
+	return nil
+}
+
+// Kill ends the session with err unless it already ended.
+func (s *Session) Kill(err error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.KillLocked(err)
+}
+func (s *Session) KillLocked(err error) {
+	if s.Dead {
+		return
+	}
+	s.Dead = true
+	if s.Err == nil {
+		s.Err = err
+	}
+	close(s.Die)
+	s.SignalLocked()
+	if s.onClose != nil {
+		go s.onClose()
+	}
+}
+
+// LocalAddr returns the address r was received on.
+func LocalAddr(r *http.Request) net.Addr {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
+
+// RemoteAddr returns the address r was sent from.
+func RemoteAddr(r *http.Request) net.Addr {
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
@@ -0,0 +1,127 @@
+package acceptor
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// Kick codes sent in KickReason.Code. Applications may use their own codes
+// above KickCodeApplication.
+const (
+	KickCodeUnknown          = 0
+	KickCodeKicked           = 1
+	KickCodeServerShutdown   = 2
+	KickCodeHeartbeatTimeout = 3
+	KickCodeDuplicateSession = 4
+	KickCodeProtocolError    = 5
+	KickCodeApplication      = 1000
+)
+
+// KickFlushTimeout bounds how long SendKick waits for the client to close
+// the connection after the kick was written.
+const KickFlushTimeout = 2 * time.Second
+
+// KickReason is the payload of a Kick packet. It is encoded as a JSON object:
+//
+//	{"code": 3, "message": "heartbeat timeout", "retryAfter": 30}
+//
+// where retryAfter is a number of seconds and is omitted when zero. A Kick
+// packet with an empty payload is a kick without reason.
+type KickReason struct {
+	Code       int
+	Message    string
+	RetryAfter time.Duration
+}
+
+type kickPayload struct {
+	Code       int    `json:"code"`
+	Message    string `json:"message,omitempty"`
+	RetryAfter int64  `json:"retryAfter,omitempty"`
+}
+
+func (r *KickReason) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&kickPayload{
+		Code:       r.Code,
+		Message:    r.Message,
+		RetryAfter: int64(math.Ceil(r.RetryAfter.Seconds())),
+	})
+}
+func (r *KickReason) UnmarshalJSON(data []byte) error {
+	p := &kickPayload{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return err
+	}
+	r.Code = p.Code
+	r.Message = p.Message
+	r.RetryAfter = time.Duration(p.RetryAfter) * time.Second
+	return nil
+}
+
+// ParseKick decodes the payload of a Kick packet received by a client.
+func ParseKick(data []byte) (*KickReason, error) {
+	r := &KickReason{}
+	if len(data) == 0 {
+		return r, nil
+	}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// closeWriter is implemented by connections that can shut down their
+// writing side while still reading.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+type unwrapper interface {
+	Unwrap() Conn
+}
+
+// SendKick writes a Kick packet carrying reason and closes conn. The packet is
+// flushed first: the writing side is shut down and SendKick waits up to
+// KickFlushTimeout for the client to close its side.
+func SendKick(conn Conn, reason *KickReason) error {
+	defer conn.Close()
+	flushing, err := writeKick(conn, reason)
+	if err != nil || !flushing {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(KickFlushTimeout))
+	for {
+		if _, err := conn.GetNextMessage(); err != nil {
+			return nil
+		}
+	}
+}
+
+// writeKick writes a Kick packet carrying reason and shuts down the writing
+// side of conn, or of the connection it wraps. It reports whether the kick is
+// being flushed, which is the case once the writing side is shut down.
+func writeKick(conn Conn, reason *KickReason) (bool, error) {
+	var payload []byte
+	if reason != nil {
+		var err error
+		if payload, err = json.Marshal(reason); err != nil {
+			return false, err
+		}
+	}
+	if err := conn.WritePacket(Kick, payload); err != nil {
+		return false, err
+	}
+	for {
+		if cw, ok := conn.(closeWriter); ok {
+			if err := cw.CloseWrite(); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+		u, ok := conn.(unwrapper)
+		if !ok {
+			return false, nil
+		}
+		conn = u.Unwrap()
+	}
+}
@@ -0,0 +1,75 @@
+package acceptor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var kickTables = map[string]struct {
+	data   []byte
+	reason *KickReason
+	err    bool
+}{
+	"test_empty_payload": {nil, &KickReason{}, false},
+	"test_reason":        {[]byte(`{"code":3,"message":"heartbeat timeout"}`), &KickReason{Code: KickCodeHeartbeatTimeout, Message: "heartbeat timeout"}, false},
+	"test_retry_after":   {[]byte(`{"code":2,"retryAfter":30}`), &KickReason{Code: KickCodeServerShutdown, RetryAfter: 30 * time.Second}, false},
+	"test_invalid":       {[]byte(`{"code":`), nil, true},
+}
+
+func TestParseKick(t *testing.T) {
+	t.Parallel()
+	for name, table := range kickTables {
+		t.Run(name, func(t *testing.T) {
+			reason, err := ParseKick(table.data)
+			if table.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, table.reason, reason)
+		})
+	}
+}
+
+type closeWriteConn struct {
+	*pipeConn
+	closedWrite bool
+}
+
+func (c *closeWriteConn) CloseWrite() error {
+	c.closedWrite = true
+	return c.pipeConn.Close()
+}
+
+type unwrapConn struct {
+	Conn
+}
+
+func (c *unwrapConn) Unwrap() Conn {
+	return c.Conn
+}
+
+func TestSendKick(t *testing.T) {
+	t.Parallel()
+	server, client := newPipeConns()
+	defer client.Close()
+	inner := &closeWriteConn{pipeConn: server}
+	reason := &KickReason{Code: KickCodeDuplicateSession, Message: "logged in elsewhere", RetryAfter: 1500 * time.Millisecond}
+
+	done := make(chan error)
+	go func() {
+		done <- SendKick(&unwrapConn{inner}, reason)
+	}()
+
+	p, err := client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, Type(Kick), p.Type)
+	parsed, err := ParseKick(p.Data)
+	assert.NoError(t, err)
+	assert.Equal(t, &KickReason{Code: KickCodeDuplicateSession, Message: "logged in elsewhere", RetryAfter: 2 * time.Second}, parsed)
+
+	assert.NoError(t, <-done)
+	assert.True(t, inner.closedWrite)
+}
@@ -0,0 +1,359 @@
+// Package longpoll is an HTTP long-polling acceptor for clients behind
+// networks or proxies that block WebSocket upgrades.
+//
+// A session is opened with a POST to the endpoint without a session id, the
+// response body is {"sid": "...", "pollTimeout": seconds}. Then, using the
+// TCP packet framing:
+//
+//   - POST ?sid=<id>&seq=<n> sends upstream bytes. seq starts at 0 and is
+//     incremented for every POST, bodies are applied in seq order and a
+//     retried POST is ignored.
+//   - GET ?sid=<id>&ack=<n> long-polls downstream bytes. The response carries
+//     the batch sequence number in the X-Poll-Seq header and ack must be the
+//     last sequence number received, 0 at first. A batch that isn't
+//     acknowledged is sent again. 204 means the poll timed out, 410 that the
+//     server closed the downstream.
+//   - DELETE ?sid=<id> closes the session.
+//
+// Sessions that neither poll nor post for SessionTimeout are closed.
+package longpoll
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/internal/httpsession"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	logger "github.com/gotechbook/gotechbook-framework-logger"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SeqHeader is the response header holding the sequence number of a batch.
+const SeqHeader = "X-Poll-Seq"
+
+var _ acceptor.Acceptor = (*LongPoll)(nil)
+var _ acceptor.Conn = (*Conn)(nil)
+
+type Config struct {
+	// Path is the endpoint of the sessions.
+	Path string
+	// PollTimeout is how long a GET is held open when there is nothing to send.
+	PollTimeout time.Duration
+	// SessionTimeout closes sessions the client abandoned.
+	SessionTimeout time.Duration
+	// MaxPostSize limits the body of an upstream POST.
+	MaxPostSize int64
+	// MaxBufferSize is the number of downstream bytes buffered before writes block.
+	MaxBufferSize int
+	// MaxPendingPosts is how many POSTs may be held back waiting for an
+	// earlier one.
+	MaxPendingPosts int
+	// MaxUpstreamSize is the number of upstream bytes buffered until the
+	// application reads them, further POSTs get 429 and can be retried.
+	MaxUpstreamSize int
+	// MaxSessions bounds the number of sessions, new ones get 503 once it is
+	// reached. Zero means no limit.
+	MaxSessions int
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		Path:            "/poll",
+		PollTimeout:     25 * time.Second,
+		SessionTimeout:  60 * time.Second,
+		MaxPostSize:     1 << 20,
+		MaxBufferSize:   1 << 20,
+		MaxPendingPosts: 16,
+		MaxUpstreamSize: 1 << 20,
+		MaxSessions:     4096,
+	}
+}
+
+// withDefaults replaces the fields of config the acceptor can't run with by
+// their default value.
+func (config Config) withDefaults() Config {
+	defaults := NewDefaultConfig()
+	if config.Path == "" {
+		config.Path = defaults.Path
+	}
+	if config.PollTimeout <= 0 {
+		config.PollTimeout = defaults.PollTimeout
+	}
+	if config.SessionTimeout <= 0 {
+		config.SessionTimeout = defaults.SessionTimeout
+	}
+	if config.MaxPostSize <= 0 {
+		config.MaxPostSize = defaults.MaxPostSize
+	}
+	if config.MaxBufferSize <= 0 {
+		config.MaxBufferSize = defaults.MaxBufferSize
+	}
+	if config.MaxPendingPosts <= 0 {
+		config.MaxPendingPosts = defaults.MaxPendingPosts
+	}
+	if config.MaxUpstreamSize <= 0 {
+		config.MaxUpstreamSize = defaults.MaxUpstreamSize
+	}
+	return config
+}
+
+type LongPoll struct {
+	addr     string
+	config   Config
+	connChan chan acceptor.Conn
+	listener net.Listener
+	certFile string
+	keyFile  string
+	mu       sync.Mutex
+	sessions map[string]*session
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewLongPoll listens on addr, the zero fields of config take their default
+// value.
+func NewLongPoll(addr string, config Config, certs ...string) *LongPoll {
+	keyFile := ""
+	certFile := ""
+	if len(certs) != 2 && len(certs) != 0 {
+		panic(acceptor.ErrInvalidCertificates)
+	} else if len(certs) == 2 {
+		certFile = certs[0]
+		keyFile = certs[1]
+	}
+	return &LongPoll{
+		addr:     addr,
+		config:   config.withDefaults(),
+		connChan: make(chan acceptor.Conn),
+		certFile: certFile,
+		keyFile:  keyFile,
+		sessions: make(map[string]*session),
+		stopChan: make(chan struct{}),
+	}
+}
+
+func (a *LongPoll) GetAddr() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.listener != nil {
+		return a.listener.Addr().String()
+	}
+	return ""
+}
+func (a *LongPoll) GetConnChan() chan acceptor.Conn {
+	return a.connChan
+}
+func (a *LongPoll) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stopChan)
+		a.mu.Lock()
+		listener := a.listener
+		sessions := a.sessions
+		a.sessions = make(map[string]*session)
+		a.mu.Unlock()
+		if listener != nil {
+			if err := listener.Close(); err != nil {
+				logger.Log.Errorf("Failed to stop: %s", err.Error())
+			}
+		}
+		for _, s := range sessions {
+			s.Kill(acceptor.ErrConnectionClosed)
+		}
+	})
+}
+func (a *LongPoll) ListenAndServe() {
+	if a.hasTLSCertificates() {
+		a.ListenAndServeTLS(a.certFile, a.keyFile)
+		return
+	}
+	listener, err := net.Listen("tcp", a.addr)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.serve(listener)
+}
+func (a *LongPoll) ListenAndServeTLS(cert, key string) {
+	crt, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		logger.Log.Fatalf("Failed to load x509: %s", err.Error())
+	}
+	tlsCfg := &tls.Config{Certificates: []tls.Certificate{crt}}
+	listener, err := tls.Listen("tcp", a.addr, tlsCfg)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.serve(listener)
+}
+func (a *LongPoll) serve(listener net.Listener) {
+	a.mu.Lock()
+	a.listener = listener
+	a.mu.Unlock()
+	defer a.Stop()
+	go a.expire()
+	http.Serve(listener, a)
+}
+func (a *LongPoll) hasTLSCertificates() bool {
+	return a.certFile != "" && a.keyFile != ""
+}
+
+// expire closes the sessions abandoned by their client.
+func (a *LongPoll) expire() {
+	ticker := time.NewTicker(a.config.SessionTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			a.mu.Lock()
+			var idle []*session
+			for _, s := range a.sessions {
+				if s.idle(now) {
+					idle = append(idle, s)
+				}
+			}
+			a.mu.Unlock()
+			for _, s := range idle {
+				s.Kill(ErrSessionTimeout)
+			}
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+
+func (a *LongPoll) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != a.config.Path {
+		http.NotFound(w, r)
+		return
+	}
+	sid := r.URL.Query().Get("sid")
+	if r.Method == http.MethodPost && sid == "" {
+		a.open(w, r)
+		return
+	}
+	a.mu.Lock()
+	s, ok := a.sessions[sid]
+	a.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		a.post(w, r, s)
+	case http.MethodGet:
+		a.poll(w, r, s)
+	case http.MethodDelete:
+		s.disconnect()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// open creates a session and hands its connection to the application.
+func (a *LongPoll) open(w http.ResponseWriter, r *http.Request) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		logger.Log.Errorf("Failed to generate session id: %s", err.Error())
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	sid := hex.EncodeToString(id)
+	var s *session
+	s = newSession(sid, a.config, httpsession.LocalAddr(r), httpsession.RemoteAddr(r), func() {
+		a.mu.Lock()
+		if a.sessions[sid] == s {
+			delete(a.sessions, sid)
+		}
+		a.mu.Unlock()
+	})
+	a.mu.Lock()
+	if a.config.MaxSessions > 0 && len(a.sessions) >= a.config.MaxSessions {
+		a.mu.Unlock()
+		http.Error(w, "too many sessions", http.StatusServiceUnavailable)
+		return
+	}
+	a.sessions[sid] = s
+	a.mu.Unlock()
+	go func() {
+		select {
+		case a.connChan <- &Conn{Conn: tcp.NewConn(s), sid: sid}:
+		case <-s.Die:
+		}
+	}()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sid":         sid,
+		"pollTimeout": int(a.config.PollTimeout / time.Second),
+	})
+}
+func (a *LongPoll) post(w http.ResponseWriter, r *http.Request, s *session) {
+	seq, err := strconv.ParseUint(r.URL.Query().Get("seq"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid seq", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, a.config.MaxPostSize))
+	if err != nil {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	switch err := s.post(seq, body); {
+	case errors.Is(err, errOutOfWindow):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errUpstreamFull):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case err != nil:
+		http.Error(w, "session closed", http.StatusGone)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+func (a *LongPoll) poll(w http.ResponseWriter, r *http.Request, s *session) {
+	var ack uint64
+	if v := r.URL.Query().Get("ack"); v != "" {
+		var err error
+		if ack, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, "invalid ack", http.StatusBadRequest)
+			return
+		}
+	}
+	batch, seq, err := s.poll(ack, r.Context().Done())
+	if err != nil {
+		http.Error(w, "session closed", http.StatusGone)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if batch == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(SeqHeader, strconv.FormatUint(seq, 10))
+	w.Write(batch)
+}
+
+// Conn is a long-polling session using the TCP packet framing.
+type Conn struct {
+	acceptor.Conn
+	sid string
+}
+
+// SessionID returns the id of the session.
+func (c *Conn) SessionID() string {
+	return c.sid
+}
+
+// Unwrap returns the framed connection.
+func (c *Conn) Unwrap() acceptor.Conn {
+	return c.Conn
+}
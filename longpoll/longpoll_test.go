@@ -0,0 +1,235 @@
+package longpoll
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var longPollAcceptorTables = []struct {
+	name     string
+	addr     string
+	certs    []string
+	panicErr error
+}{
+	{"test_1", "127.0.0.1:0", []string{"../fixtures/server.crt", "../fixtures/server.key"}, nil},
+	{"test_2", "127.0.0.1:0", []string{}, nil},
+	{"test_3", "127.0.0.1:0", []string{"wqd"}, acceptor.ErrInvalidCertificates},
+	{"test_4", "127.0.0.1:0", []string{"wqd", "wqdqwd", "wqdqdqwd"}, acceptor.ErrInvalidCertificates},
+}
+
+func TestNewLongPoll(t *testing.T) {
+	t.Parallel()
+	for _, table := range longPollAcceptorTables {
+		t.Run(table.name, func(t *testing.T) {
+			if table.panicErr != nil {
+				assert.PanicsWithValue(t, table.panicErr, func() {
+					NewLongPoll(table.addr, NewDefaultConfig(), table.certs...)
+				})
+				return
+			}
+			a := NewLongPoll(table.addr, NewDefaultConfig(), table.certs...)
+			assert.NotNil(t, a.GetConnChan())
+			assert.Equal(t, len(table.certs) == 2, a.hasTLSCertificates())
+			// returns nothing because not listening yet
+			assert.Equal(t, "", a.GetAddr())
+		})
+	}
+}
+
+type testClient struct {
+	t   *testing.T
+	url string
+	sid string
+}
+
+func listen(t *testing.T, config Config) (*LongPoll, *testClient) {
+	t.Helper()
+	a := NewLongPoll("127.0.0.1:0", config)
+	go a.ListenAndServe()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	c := &testClient{t: t, url: fmt.Sprintf("http://%s%s", a.GetAddr(), a.config.Path)}
+	res, err := http.Post(c.url, "", nil)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	var body struct {
+		Sid string `json:"sid"`
+	}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	assert.NotEmpty(t, body.Sid)
+	c.sid = body.Sid
+	return a, c
+}
+
+func (c *testClient) do(method, query string, body []byte) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, fmt.Sprintf("%s?sid=%s%s", c.url, c.sid, query), bytes.NewReader(body))
+	assert.NoError(c.t, err)
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(c.t, err)
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	assert.NoError(c.t, err)
+	return res, b
+}
+
+func TestListenAndServe(t *testing.T) {
+	config := NewDefaultConfig()
+	config.PollTimeout = 50 * time.Millisecond
+	a, client := listen(t, config)
+	defer a.Stop()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	assert.Equal(t, client.sid, conn.SessionID())
+
+	// posts are applied in order whatever order they arrive in
+	res, _ := client.do(http.MethodPost, "&seq=1", []byte{0x04, 0x00, 0x00, 0x01, 0x02})
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res, _ = client.do(http.MethodPost, "&seq=0", []byte{0x04, 0x00, 0x00, 0x01, 0x01})
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res, _ = client.do(http.MethodPost, "&seq=0", []byte{0x04, 0x00, 0x00, 0x01, 0x01})
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res, _ = client.do(http.MethodPost, "&seq=100", []byte{0x04, 0x00, 0x00, 0x01, 0x03})
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+	for _, expected := range []byte{0x01, 0x02} {
+		p, err := conn.ReadPacket()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{expected}, p.Data)
+	}
+
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x05}))
+	res, body := client.do(http.MethodGet, "&ack=0", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "1", res.Header.Get(SeqHeader))
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x05}, body)
+	// the batch is sent again until it is acknowledged
+	res, body = client.do(http.MethodGet, "&ack=0", nil)
+	assert.Equal(t, "1", res.Header.Get(SeqHeader))
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x05}, body)
+	res, _ = client.do(http.MethodGet, "&ack=1", nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	res, _ = client.do(http.MethodDelete, "", nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	_, err := conn.GetNextMessage()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+	res, _ = client.do(http.MethodGet, "", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestPollWaitsForData(t *testing.T) {
+	a, client := listen(t, NewDefaultConfig())
+	defer a.Stop()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		conn.WritePacket(acceptor.Heartbeat, nil)
+	}()
+	res, body := client.do(http.MethodGet, "", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []byte{0x03, 0x00, 0x00, 0x00}, body)
+}
+
+func TestSendKick(t *testing.T) {
+	a, client := listen(t, NewDefaultConfig())
+	defer a.Stop()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+
+	done := make(chan error)
+	go func() {
+		done <- acceptor.SendKick(conn, &acceptor.KickReason{Code: acceptor.KickCodeServerShutdown})
+	}()
+	res, body := client.do(http.MethodGet, "", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, byte(acceptor.Kick), body[0])
+	res, _ = client.do(http.MethodGet, "&ack=1", nil)
+	assert.Equal(t, http.StatusGone, res.StatusCode)
+	client.do(http.MethodDelete, "", nil)
+	assert.NoError(t, <-done)
+}
+
+func TestSessionTimeout(t *testing.T) {
+	config := NewDefaultConfig()
+	config.SessionTimeout = 50 * time.Millisecond
+	a, client := listen(t, config)
+	defer a.Stop()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+
+	_, err := conn.GetNextMessage()
+	assert.Equal(t, ErrSessionTimeout, err)
+	res, _ := client.do(http.MethodGet, "", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestZeroConfig(t *testing.T) {
+	a, client := listen(t, Config{})
+	defer a.Stop()
+	expected := NewDefaultConfig()
+	expected.MaxSessions = 0
+	assert.Equal(t, expected, a.config)
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+
+	res, _ := client.do(http.MethodPost, "&seq=0", []byte{0x04, 0x00, 0x00, 0x01, 0x01})
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, p.Data)
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x02}))
+	res, body := client.do(http.MethodGet, "", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x02}, body)
+}
+
+func TestMaxSessions(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MaxSessions = 1
+	a, client := listen(t, config)
+	defer a.Stop()
+	utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond)
+
+	res, err := http.Post(client.url, "", nil)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	// ending a session makes room for another one
+	client.do(http.MethodDelete, "", nil)
+	utils.ShouldEventuallyReturn(t, func() int {
+		res, err := http.Post(client.url, "", nil)
+		assert.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}, http.StatusOK, 10*time.Millisecond, 100*time.Millisecond)
+}
+
+func TestMaxUpstreamSize(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MaxUpstreamSize = 8
+	a, client := listen(t, config)
+	defer a.Stop()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+
+	res, _ := client.do(http.MethodPost, "&seq=0", []byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x02})
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res, _ = client.do(http.MethodPost, "&seq=1", []byte{0x04, 0x00, 0x00, 0x01, 0x03})
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x02}, p.Data)
+	// the refused post can be retried once the application read
+	res, _ = client.do(http.MethodPost, "&seq=1", []byte{0x04, 0x00, 0x00, 0x01, 0x03})
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	p, err = conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x03}, p.Data)
+}
@@ -0,0 +1,173 @@
+package longpoll
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gotechbook/gotechbook-framework-acceptor/internal/httpsession"
+	"io"
+	"net"
+	"time"
+)
+
+var (
+	ErrSessionTimeout = errors.New("longpoll: session timed out")
+	errOutOfWindow    = errors.New("longpoll: post out of window")
+	errUpstreamFull   = errors.New("longpoll: upstream buffer full")
+)
+
+// session is a byte stream carried by HTTP requests. Upstream bytes arrive
+// in numbered POST bodies and are applied in order, downstream bytes are
+// handed out in numbered batches to long-poll GETs and kept until the client
+// acknowledges them with its next poll.
+type session struct {
+	*httpsession.Session
+	id     string
+	config Config
+
+	nextSeq   uint64
+	early     map[uint64][]byte
+	earlySize int
+
+	out        bytes.Buffer
+	batch      []byte
+	batchSeq   uint64
+	pollID     uint64
+	polls      int
+	lastActive time.Time
+}
+
+func newSession(id string, config Config, local, remote net.Addr, onClose func()) *session {
+	return &session{
+		Session:    httpsession.New(local, remote, onClose),
+		id:         id,
+		config:     config,
+		early:      make(map[uint64][]byte),
+		lastActive: time.Now(),
+	}
+}
+
+// Write queues b for the next poll. It blocks while more than MaxBufferSize
+// bytes are waiting to be polled.
+func (s *session) Write(b []byte) (int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	for {
+		if s.Closed || s.WriteClosed {
+			return 0, net.ErrClosed
+		}
+		if s.Err != nil {
+			return 0, s.Err
+		}
+		if s.out.Len() < s.config.MaxBufferSize {
+			s.out.Write(b)
+			s.SignalLocked()
+			return len(b), nil
+		}
+		if err := s.WaitLocked(s.WriteDeadline, nil); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// post applies the body of upstream POST seq. Posts arriving ahead of their
+// turn are held back until the missing ones arrive, duplicates are ignored.
+// A post is refused while MaxUpstreamSize bytes are waiting to be read.
+func (s *session) post(seq uint64, body []byte) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.lastActive = time.Now()
+	if s.Dead || s.RemoteClosed {
+		return net.ErrClosed
+	}
+	if seq < s.nextSeq {
+		return nil
+	}
+	if seq >= s.nextSeq+uint64(s.config.MaxPendingPosts) {
+		return errOutOfWindow
+	}
+	if _, ok := s.early[seq]; ok {
+		return nil
+	}
+	if buffered := s.Upstream.Len() + s.earlySize; buffered > 0 && buffered+len(body) > s.config.MaxUpstreamSize {
+		return errUpstreamFull
+	}
+	s.early[seq] = body
+	s.earlySize += len(body)
+	for {
+		b, ok := s.early[s.nextSeq]
+		if !ok {
+			break
+		}
+		delete(s.early, s.nextSeq)
+		s.earlySize -= len(b)
+		s.Upstream.Write(b)
+		s.nextSeq++
+	}
+	s.SignalLocked()
+	return nil
+}
+
+// poll waits for downstream bytes. ack is the sequence number of the last
+// batch the client received, a batch that wasn't acknowledged is sent again.
+// It returns the batch and its sequence number, a nil batch when the poll
+// timed out or was superseded by a newer one, or net.ErrClosed once the
+// downstream ended.
+func (s *session) poll(ack uint64, cancel <-chan struct{}) ([]byte, uint64, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.pollID++
+	id := s.pollID
+	s.polls++
+	defer func() {
+		s.polls--
+		s.lastActive = time.Now()
+	}()
+	s.SignalLocked()
+	if s.batch != nil && ack == s.batchSeq {
+		s.batch = nil
+	}
+	deadline := time.Now().Add(s.config.PollTimeout)
+	for {
+		if s.pollID != id {
+			return nil, 0, nil
+		}
+		if s.batch != nil {
+			return s.batch, s.batchSeq, nil
+		}
+		if s.out.Len() > 0 {
+			s.batch = append([]byte(nil), s.out.Bytes()...)
+			s.batchSeq++
+			s.out.Reset()
+			s.SignalLocked()
+			return s.batch, s.batchSeq, nil
+		}
+		if s.WriteClosed || s.Dead {
+			return nil, 0, net.ErrClosed
+		}
+		if err := s.WaitLocked(deadline, cancel); err != nil {
+			return nil, 0, nil
+		}
+		select {
+		case <-cancel:
+			return nil, 0, nil
+		default:
+		}
+	}
+}
+
+// disconnect is called when the client ends the session.
+func (s *session) disconnect() {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.RemoteClosed = true
+	s.WriteClosed = true
+	s.KillLocked(io.EOF)
+}
+
+// idle reports whether the client neither polled nor posted for longer than
+// the session timeout.
+func (s *session) idle(now time.Time) bool {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return s.polls == 0 && now.Sub(s.lastActive) > s.config.SessionTimeout
+}
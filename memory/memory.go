@@ -0,0 +1,102 @@
+// Package memory is an in-process acceptor for tests. Clients connect with
+// Dial instead of the network, so tests need no ports and run fast, while
+// both ends are real connections with the TCP packet framing and deadlines.
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	"sync"
+)
+
+var ErrNotListening = errors.New("memory: acceptor is not listening")
+
+var _ acceptor.Acceptor = (*Memory)(nil)
+
+type Memory struct {
+	addr     string
+	connChan chan acceptor.Conn
+	mu       sync.Mutex
+	running  bool
+	stopChan chan struct{}
+	dialed   int
+}
+
+func NewMemory(addr string) *Memory {
+	return &Memory{
+		addr:     addr,
+		connChan: make(chan acceptor.Conn),
+	}
+}
+
+func (a *Memory) GetAddr() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.running {
+		return a.addr
+	}
+	return ""
+}
+func (a *Memory) GetConnChan() chan acceptor.Conn {
+	return a.connChan
+}
+func (a *Memory) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.running {
+		return
+	}
+	a.running = false
+	close(a.stopChan)
+}
+
+// ListenAndServe accepts connections until Stop is called.
+func (a *Memory) ListenAndServe() {
+	a.mu.Lock()
+	if a.running {
+		a.mu.Unlock()
+		return
+	}
+	stopChan := make(chan struct{})
+	a.stopChan = stopChan
+	a.running = true
+	a.mu.Unlock()
+	<-stopChan
+}
+
+// Dial connects to the acceptor and returns the client end of the connection.
+// Like with a network listener it returns without waiting for the server end
+// to be received from GetConnChan.
+func (a *Memory) Dial() (acceptor.Conn, error) {
+	return a.DialContext(context.Background())
+}
+
+// DialContext works like Dial but fails with ctx.Err() if ctx is done.
+func (a *Memory) DialContext(ctx context.Context) (acceptor.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	if !a.running {
+		a.mu.Unlock()
+		return nil, ErrNotListening
+	}
+	a.dialed++
+	remote := Addr(fmt.Sprintf("%s#%d", a.addr, a.dialed))
+	stopChan := a.stopChan
+	a.mu.Unlock()
+
+	client, server := Pipe(remote, Addr(a.addr))
+	serverConn := tcp.NewConn(server)
+	go func() {
+		select {
+		case a.connChan <- serverConn:
+		case <-stopChan:
+			serverConn.Close()
+		}
+	}()
+	return tcp.NewConn(client), nil
+}
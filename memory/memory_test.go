@@ -0,0 +1,183 @@
+package memory
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/acceptortest"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func listen(t *testing.T) *Memory {
+	t.Helper()
+	a := NewMemory("test")
+	go a.ListenAndServe()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+	return a
+}
+
+func TestNewMemory(t *testing.T) {
+	a := NewMemory("test")
+	assert.NotNil(t, a.GetConnChan())
+	// returns nothing because not listening yet
+	assert.Equal(t, "", a.GetAddr())
+	_, err := a.Dial()
+	assert.Equal(t, ErrNotListening, err)
+}
+
+func TestDial(t *testing.T) {
+	a := listen(t)
+	defer a.Stop()
+	client, err := a.Dial()
+	assert.NoError(t, err)
+	defer client.Close()
+	// writes don't wait for the server
+	assert.NoError(t, client.WritePacket(acceptor.Data, []byte{0x01}))
+	assert.NoError(t, client.WritePacket(acceptor.Heartbeat, nil))
+
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(acceptor.Conn)
+	defer conn.Close()
+	assert.Equal(t, Addr("test"), conn.LocalAddr())
+	assert.Equal(t, client.LocalAddr(), conn.RemoteAddr())
+	assert.Equal(t, "memory", conn.RemoteAddr().Network())
+
+	msg, err := conn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x01}, msg)
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.Type(acceptor.Heartbeat), p.Type)
+
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x02}))
+	p, err = client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x02}, p.Data)
+
+	assert.Equal(t, acceptor.ErrWrongPacketType, conn.WritePacket(0x09, nil))
+}
+
+func TestDialContext(t *testing.T) {
+	a := listen(t)
+	defer a.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := a.DialContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestStop(t *testing.T) {
+	a := listen(t)
+	client, err := a.Dial()
+	assert.NoError(t, err)
+	a.Stop()
+	assert.Equal(t, "", a.GetAddr())
+	_, err = a.Dial()
+	assert.Equal(t, ErrNotListening, err)
+	// the connection nobody received is closed
+	_, err = client.GetNextMessage()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+}
+
+func TestDeadlines(t *testing.T) {
+	a := listen(t)
+	defer a.Stop()
+	client, err := a.Dial()
+	assert.NoError(t, err)
+	defer client.Close()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(acceptor.Conn)
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = conn.GetNextMessage()
+	netErr, ok := err.(net.Error)
+	assert.True(t, ok && netErr.Timeout())
+	conn.SetReadDeadline(time.Time{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = conn.GetNextMessageContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// a deadline set while blocked applies right away
+	done := make(chan error)
+	go func() {
+		_, err := conn.GetNextMessage()
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	conn.SetReadDeadline(time.Now())
+	netErr, ok = (<-done).(net.Error)
+	assert.True(t, ok && netErr.Timeout())
+	conn.SetReadDeadline(time.Time{})
+
+	// writes block once the buffer is full
+	client.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = client.Write(make([]byte, MaxBuffered+1))
+	netErr, ok = err.(net.Error)
+	assert.True(t, ok && netErr.Timeout())
+}
+
+func TestClose(t *testing.T) {
+	a := listen(t)
+	defer a.Stop()
+	client, err := a.Dial()
+	assert.NoError(t, err)
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(acceptor.Conn)
+	defer conn.Close()
+
+	assert.NoError(t, client.WritePacket(acceptor.Data, []byte{0x01}))
+	assert.NoError(t, client.Close())
+	// what was written before closing is still read
+	_, err = conn.GetNextMessage()
+	assert.NoError(t, err)
+	_, err = conn.GetNextMessage()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+	assert.Equal(t, io.ErrClosedPipe, conn.WritePacket(acceptor.Data, nil))
+	_, err = client.Read(make([]byte, 1))
+	assert.Equal(t, io.ErrClosedPipe, err)
+}
+
+func TestSendKick(t *testing.T) {
+	a := listen(t)
+	defer a.Stop()
+	client, err := a.Dial()
+	assert.NoError(t, err)
+	defer client.Close()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(acceptor.Conn)
+	// unread data on the server side must not prevent the kick from arriving
+	assert.NoError(t, client.WritePacket(acceptor.Data, []byte{0x01}))
+
+	done := make(chan error)
+	go func() {
+		done <- acceptor.SendKick(conn, &acceptor.KickReason{Code: acceptor.KickCodeKicked})
+	}()
+	p, err := client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.Type(acceptor.Kick), p.Type)
+	_, err = client.ReadPacket()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+	client.Close()
+	assert.NoError(t, <-done)
+}
+
+func TestConformance(t *testing.T) {
+	// the factory dials the last acceptor it created, addresses are only names
+	var last *Memory
+	acceptortest.Run(t, acceptortest.Factory{
+		New: func() acceptor.Acceptor {
+			last = NewMemory("test")
+			return last
+		},
+		Dial: func(addr string) (acceptor.Conn, error) {
+			return last.Dial()
+		},
+		Stream: true,
+	})
+}
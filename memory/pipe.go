@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// MaxBuffered is how many bytes a pipe direction holds before writes block.
+const MaxBuffered = 1 << 20
+
+// Addr is the address of an in-memory connection.
+type Addr string
+
+func (a Addr) Network() string {
+	return "memory"
+}
+func (a Addr) String() string {
+	return string(a)
+}
+
+// buffer is one direction of a pipe. Every change, deadlines included, closes
+// wake so blocked readers and writers look again.
+type buffer struct {
+	writeMu       sync.Mutex // keeps writes larger than the free space whole
+	mu            sync.Mutex
+	data          []byte
+	eof           bool // the writing end is closed
+	closed        bool // the reading end is closed
+	readDeadline  time.Time
+	writeDeadline time.Time
+	wake          chan struct{}
+}
+
+func newBuffer() *buffer {
+	return &buffer{wake: make(chan struct{})}
+}
+
+// signalLocked wakes every waiter, b.mu must be held.
+func (b *buffer) signalLocked() {
+	close(b.wake)
+	b.wake = make(chan struct{})
+}
+
+// waitLocked releases b.mu until something changes or deadline passes. It
+// returns os.ErrDeadlineExceeded in the latter case, with b.mu held again.
+func (b *buffer) waitLocked(deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	wake := b.wake
+	b.mu.Unlock()
+	defer b.mu.Lock()
+	select {
+	case <-wake:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+}
+func (b *buffer) read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		switch {
+		case b.closed:
+			return 0, io.ErrClosedPipe
+		case len(b.data) > 0:
+			n := copy(p, b.data)
+			b.data = b.data[n:]
+			b.signalLocked()
+			return n, nil
+		case b.eof:
+			return 0, io.EOF
+		}
+		if err := b.waitLocked(b.readDeadline); err != nil {
+			return 0, err
+		}
+	}
+}
+func (b *buffer) write(p []byte) (int, error) {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for {
+		if b.eof || b.closed {
+			return n, io.ErrClosedPipe
+		}
+		if !b.writeDeadline.IsZero() && !time.Now().Before(b.writeDeadline) {
+			return n, os.ErrDeadlineExceeded
+		}
+		if free := MaxBuffered - len(b.data); free > 0 {
+			m := len(p) - n
+			if m > free {
+				m = free
+			}
+			b.data = append(b.data, p[n:n+m]...)
+			n += m
+			b.signalLocked()
+			if n == len(p) {
+				return n, nil
+			}
+		}
+		if err := b.waitLocked(b.writeDeadline); err != nil {
+			return n, err
+		}
+	}
+}
+func (b *buffer) update(f func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f()
+	b.signalLocked()
+}
+
+// pipeConn is one end of an in-memory, buffered, full duplex connection.
+// Unlike net.Pipe writes don't wait for the peer to read and the writing
+// side can be closed on its own.
+type pipeConn struct {
+	in     *buffer
+	out    *buffer
+	local  net.Addr
+	remote net.Addr
+}
+
+// Pipe returns the two ends of an in-memory connection.
+func Pipe(a, b net.Addr) (net.Conn, net.Conn) {
+	ab, ba := newBuffer(), newBuffer()
+	return &pipeConn{in: ba, out: ab, local: a, remote: b},
+		&pipeConn{in: ab, out: ba, local: b, remote: a}
+}
+func (c *pipeConn) Read(b []byte) (int, error) {
+	return c.in.read(b)
+}
+func (c *pipeConn) Write(b []byte) (int, error) {
+	return c.out.write(b)
+}
+
+// CloseWrite makes the peer read io.EOF once it read what was written.
+func (c *pipeConn) CloseWrite() error {
+	c.out.update(func() { c.out.eof = true })
+	return nil
+}
+func (c *pipeConn) Close() error {
+	c.in.update(func() {
+		c.in.closed = true
+		c.in.data = nil
+	})
+	return c.CloseWrite()
+}
+func (c *pipeConn) LocalAddr() net.Addr {
+	return c.local
+}
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.in.update(func() { c.in.readDeadline = t })
+	return nil
+}
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.out.update(func() { c.out.writeDeadline = t })
+	return nil
+}
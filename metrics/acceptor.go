@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"context"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"sync"
+	"time"
+)
+
+var _ acceptor.Conn = (*Conn)(nil)
+var _ acceptor.Acceptor = (*Acceptor)(nil)
+
+// Conn reports the traffic of the wrapped connection.
+type Conn struct {
+	acceptor.Conn
+	labels    Labels
+	reporter  Reporter
+	accepted  time.Time
+	closeOnce sync.Once
+
+	mu     sync.Mutex
+	header []byte // header of the packet being written by Write
+	body   int    // bytes of the packet being written by Write left
+	lost   bool   // Write wrote something else than packets
+}
+
+func NewConn(conn acceptor.Conn, l Labels, reporter Reporter) *Conn {
+	return &Conn{Conn: conn, labels: l, reporter: reporter}
+}
+
+// Unwrap returns the wrapped connection.
+func (c *Conn) Unwrap() acceptor.Conn {
+	return c.Conn
+}
+func (c *Conn) Labels() Labels {
+	return c.labels
+}
+func (c *Conn) GetNextMessage() (b []byte, err error) {
+	b, err = c.Conn.GetNextMessage()
+	c.received(b, err)
+	return b, err
+}
+func (c *Conn) GetNextMessageContext(ctx context.Context) (b []byte, err error) {
+	b, err = c.Conn.GetNextMessageContext(ctx)
+	c.received(b, err)
+	return b, err
+}
+func (c *Conn) ReadPacket() (*acceptor.Packet, error) {
+	p, err := c.Conn.ReadPacket()
+	if err != nil {
+		c.decodeError(err)
+		return nil, err
+	}
+	c.reporter.PacketReceived(c.labels, p.Type)
+	c.reporter.BytesReceived(c.labels, acceptor.HeadLength+len(p.Data))
+	return p, nil
+}
+
+// Read reports the bytes read only, the packets are those of the stream
+// being read.
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.reporter.BytesReceived(c.labels, n)
+	}
+	return n, err
+}
+func (c *Conn) WritePacket(typ acceptor.Type, data []byte) error {
+	start := time.Now()
+	err := c.Conn.WritePacket(typ, data)
+	c.reporter.WriteLatency(c.labels, time.Since(start))
+	if err == nil {
+		c.reporter.PacketSent(c.labels, typ)
+		c.reporter.BytesSent(c.labels, acceptor.HeadLength+len(data))
+	}
+	return err
+}
+
+// Write reports the packets whose header is written, b may hold several
+// packets or parts of them.
+func (c *Conn) Write(b []byte) (int, error) {
+	start := time.Now()
+	n, err := c.Conn.Write(b)
+	c.reporter.WriteLatency(c.labels, time.Since(start))
+	if n > 0 {
+		c.reporter.BytesSent(c.labels, n)
+		c.sent(b[:n])
+	}
+	return n, err
+}
+func (c *Conn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.reporter.ConnectionClosed(c.labels)
+	})
+	return err
+}
+func (c *Conn) received(b []byte, err error) {
+	if err != nil {
+		c.decodeError(err)
+		return
+	}
+	if len(b) > 0 {
+		c.reporter.PacketReceived(c.labels, acceptor.Type(b[0]))
+	}
+	c.reporter.BytesReceived(c.labels, len(b))
+}
+func (c *Conn) decodeError(err error) {
+	if kind := DecodeErrorKind(err); kind != "" {
+		c.reporter.DecodeError(c.labels, kind)
+	}
+}
+
+// sent follows the packets of the stream written by Write.
+func (c *Conn) sent(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(b) > 0 && !c.lost {
+		if c.body > 0 {
+			n := min(c.body, len(b))
+			c.body -= n
+			b = b[n:]
+			continue
+		}
+		n := min(acceptor.HeadLength-len(c.header), len(b))
+		c.header = append(c.header, b[:n]...)
+		b = b[n:]
+		if len(c.header) < acceptor.HeadLength {
+			return
+		}
+		size, typ, err := acceptor.ParseHeader(c.header)
+		c.header = c.header[:0]
+		if err != nil {
+			c.lost = true
+			return
+		}
+		c.reporter.PacketSent(c.labels, typ)
+		c.body = size
+	}
+}
+
+// Acceptor delivers the connections of an inner Acceptor wrapped in a Conn.
+type Acceptor struct {
+	*acceptor.WrapAcceptor
+	acceptor  acceptor.Acceptor
+	transport string
+	reporter  Reporter
+}
+
+// NewAcceptor reports the measures of a, labelled with transport and the
+// address of a, to reporter. A nil reporter is Noop.
+func NewAcceptor(a acceptor.Acceptor, transport string, reporter Reporter) *Acceptor {
+	if reporter == nil {
+		reporter = Noop{}
+	}
+	m := &Acceptor{
+		acceptor:  a,
+		transport: transport,
+		reporter:  reporter,
+	}
+	m.WrapAcceptor = acceptor.NewWrapAcceptor(a, func(_ int, conn acceptor.Conn) (acceptor.Conn, error) {
+		l := m.labels()
+		reporter.ConnectionAccepted(l)
+		c := NewConn(conn, l, reporter)
+		c.accepted = time.Now()
+		return c, nil
+	})
+	m.OnDeliver = func(conn acceptor.Conn) {
+		c := conn.(*Conn)
+		reporter.ConnWait(c.labels, time.Since(c.accepted))
+	}
+	m.OnDrop = func(conn acceptor.Conn) {
+		reporter.ConnectionRejected(conn.(*Conn).labels, ReasonStopped)
+	}
+	return m
+}
+
+// HandshakeFailure reports a failed handshake, it is meant for the OnFailure
+// of the HandshakeConfig of an acceptor.HandshakeAcceptor wrapping a.
+func (a *Acceptor) HandshakeFailure(conn acceptor.Conn, err error) {
+	l := a.labels()
+	if c, ok := conn.(*Conn); ok {
+		l = c.labels
+	}
+	a.reporter.HandshakeFailed(l, HandshakeErrorKind(err))
+	a.reporter.ConnectionRejected(l, ReasonHandshake)
+}
+func (a *Acceptor) labels() Labels {
+	return Labels{Transport: a.transport, Address: a.acceptor.GetAddr()}
+}
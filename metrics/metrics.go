@@ -0,0 +1,124 @@
+// Package metrics instruments acceptors and their connections.
+//
+// What is measured goes to a Reporter: the prometheus package holds one
+// implementation, Noop, which drops everything, is the default.
+//
+//	reporter, err := prometheus.NewReporter(prometheus.NewDefaultConfig())
+//	m := metrics.NewAcceptor(tcp.NewTCP(":3250"), "tcp", reporter)
+//	config := acceptor.NewDefaultHandshakeConfig()
+//	config.OnFailure = m.HandshakeFailure
+//	a := acceptor.NewHandshakeAcceptor(m, config)
+package metrics
+
+import (
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"net"
+	"time"
+)
+
+// Labels tell the acceptor a measure comes from.
+type Labels struct {
+	Transport string
+	Address   string
+}
+
+// Reporter receives the measures of the instrumented acceptors. Its methods
+// are called concurrently, from the connections' goroutines.
+type Reporter interface {
+	// ConnectionAccepted counts a connection accepted, then active until
+	// ConnectionClosed.
+	ConnectionAccepted(l Labels)
+	ConnectionClosed(l Labels)
+	// ConnectionRejected counts a connection closed before being delivered.
+	ConnectionRejected(l Labels, reason string)
+	HandshakeFailed(l Labels, kind string)
+	// PacketReceived and PacketSent count packets, BytesReceived and
+	// BytesSent all the bytes, packet headers included.
+	PacketReceived(l Labels, typ acceptor.Type)
+	PacketSent(l Labels, typ acceptor.Type)
+	BytesReceived(l Labels, n int)
+	BytesSent(l Labels, n int)
+	DecodeError(l Labels, kind string)
+	// ConnWait observes how long an accepted connection waited in the
+	// connection channel.
+	ConnWait(l Labels, d time.Duration)
+	// WriteLatency observes the duration of a write.
+	WriteLatency(l Labels, d time.Duration)
+}
+
+var _ Reporter = Noop{}
+
+// Noop is a Reporter dropping everything.
+type Noop struct{}
+
+func (Noop) ConnectionAccepted(Labels)            {}
+func (Noop) ConnectionClosed(Labels)              {}
+func (Noop) ConnectionRejected(Labels, string)    {}
+func (Noop) HandshakeFailed(Labels, string)       {}
+func (Noop) PacketReceived(Labels, acceptor.Type) {}
+func (Noop) PacketSent(Labels, acceptor.Type)     {}
+func (Noop) BytesReceived(Labels, int)            {}
+func (Noop) BytesSent(Labels, int)                {}
+func (Noop) DecodeError(Labels, string)           {}
+func (Noop) ConnWait(Labels, time.Duration)       {}
+func (Noop) WriteLatency(Labels, time.Duration)   {}
+
+// Rejection reasons.
+const (
+	ReasonStopped   = "stopped"
+	ReasonHandshake = "handshake"
+)
+
+// TypeName is the label of a packet type.
+func TypeName(typ acceptor.Type) string {
+	switch typ {
+	case acceptor.Handshake:
+		return "handshake"
+	case acceptor.HandshakeAck:
+		return "handshake_ack"
+	case acceptor.Heartbeat:
+		return "heartbeat"
+	case acceptor.Data:
+		return "data"
+	case acceptor.Kick:
+		return "kick"
+	}
+	return "unknown"
+}
+
+// DecodeErrorKind is the label of a decoding error, empty for errors that
+// don't come from decoding.
+func DecodeErrorKind(err error) string {
+	switch err {
+	case acceptor.ErrInvalidHeader:
+		return "invalid_header"
+	case acceptor.ErrWrongPacketType:
+		return "wrong_packet_type"
+	case acceptor.ErrPacketSizeExceed:
+		return "packet_size_exceed"
+	case acceptor.ErrReceivedMsgSmallerThanExpected:
+		return "message_too_small"
+	case acceptor.ErrReceivedMsgBiggerThanExpected:
+		return "message_too_big"
+	}
+	return ""
+}
+
+// HandshakeErrorKind is the label of a handshake error.
+func HandshakeErrorKind(err error) string {
+	if kind := DecodeErrorKind(err); kind != "" {
+		return kind
+	}
+	switch err {
+	case acceptor.ErrHandshakeRequired:
+		return "handshake_required"
+	case acceptor.ErrInvalidHandshake:
+		return "invalid_handshake"
+	case acceptor.ErrConnectionClosed:
+		return "closed"
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return "timeout"
+	}
+	return "other"
+}
@@ -0,0 +1,197 @@
+package metrics
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/acceptortest"
+	"github.com/gotechbook/gotechbook-framework-acceptor/memory"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// counter is a Reporter counting what it receives by name.
+type counter struct {
+	mu     sync.Mutex
+	counts map[string]int
+	labels []Labels
+}
+
+func newCounter() *counter {
+	return &counter{counts: map[string]int{}}
+}
+
+func (c *counter) add(l Labels, name string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[name] += n
+	c.labels = append(c.labels, l)
+}
+func (c *counter) get(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[name]
+}
+func (c *counter) ConnectionAccepted(l Labels) { c.add(l, "accepted", 1) }
+func (c *counter) ConnectionClosed(l Labels)   { c.add(l, "closed", 1) }
+func (c *counter) ConnectionRejected(l Labels, reason string) {
+	c.add(l, "rejected "+reason, 1)
+}
+func (c *counter) HandshakeFailed(l Labels, kind string) { c.add(l, "handshake "+kind, 1) }
+func (c *counter) PacketReceived(l Labels, typ acceptor.Type) {
+	c.add(l, "received "+TypeName(typ), 1)
+}
+func (c *counter) PacketSent(l Labels, typ acceptor.Type) { c.add(l, "sent "+TypeName(typ), 1) }
+func (c *counter) BytesReceived(l Labels, n int)          { c.add(l, "received bytes", n) }
+func (c *counter) BytesSent(l Labels, n int)              { c.add(l, "sent bytes", n) }
+func (c *counter) DecodeError(l Labels, kind string)      { c.add(l, "decode "+kind, 1) }
+func (c *counter) ConnWait(l Labels, d time.Duration)     { c.add(l, "wait", 1) }
+func (c *counter) WriteLatency(l Labels, d time.Duration) { c.add(l, "write", 1) }
+
+func listen(t *testing.T, reporter Reporter) (*memory.Memory, *Acceptor) {
+	t.Helper()
+	m := memory.NewMemory("test")
+	a := NewAcceptor(m, "memory", reporter)
+	go a.ListenAndServe()
+	t.Cleanup(a.Stop)
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+	return m, a
+}
+
+func TestAcceptor(t *testing.T) {
+	c := newCounter()
+	m, a := listen(t, c)
+	client, err := m.Dial()
+	assert.NoError(t, err)
+	defer client.Close()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	assert.Equal(t, Labels{Transport: "memory", Address: "test"}, conn.Labels())
+	assert.Equal(t, 1, c.get("accepted"))
+	assert.Equal(t, 1, c.get("wait"))
+
+	assert.NoError(t, client.WritePacket(acceptor.Heartbeat, nil))
+	assert.NoError(t, client.WritePacket(acceptor.Data, []byte("ping")))
+	_, err = conn.ReadPacket()
+	assert.NoError(t, err)
+	_, err = conn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c.get("received heartbeat"))
+	assert.Equal(t, 1, c.get("received data"))
+	assert.Equal(t, 12, c.get("received bytes"))
+
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte("pong")))
+	// packets written in parts are counted once
+	_, err = conn.Write([]byte{acceptor.Heartbeat, 0x00, 0x00, 0x00, acceptor.Data, 0x00})
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte{0x00, 0x02, 0x01})
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte{0x02, acceptor.Kick, 0x00, 0x00, 0x00})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, c.get("sent data"))
+	assert.Equal(t, 1, c.get("sent heartbeat"))
+	assert.Equal(t, 1, c.get("sent kick"))
+	assert.Equal(t, 22, c.get("sent bytes"))
+	assert.Equal(t, 4, c.get("write"))
+
+	_, err = client.Write([]byte{0x09, 0x00, 0x00, 0x00})
+	assert.NoError(t, err)
+	_, err = conn.GetNextMessage()
+	assert.Equal(t, acceptor.ErrWrongPacketType, err)
+	assert.Equal(t, 1, c.get("decode wrong_packet_type"))
+
+	assert.NoError(t, conn.Close())
+	conn.Close()
+	assert.Equal(t, 1, c.get("closed"))
+	for _, l := range c.labels {
+		assert.Equal(t, Labels{Transport: "memory", Address: "test"}, l)
+	}
+}
+
+func TestAcceptorStop(t *testing.T) {
+	c := newCounter()
+	m, a := listen(t, c)
+	client, err := m.Dial()
+	assert.NoError(t, err)
+	defer client.Close()
+	utils.ShouldEventuallyReturn(t, func() int {
+		return c.get("accepted")
+	}, 1, time.Millisecond, 100*time.Millisecond)
+	a.Stop()
+	utils.ShouldEventuallyReturn(t, func() int {
+		return c.get("closed")
+	}, 1, time.Millisecond, 100*time.Millisecond)
+	assert.Equal(t, 1, c.get("rejected stopped"))
+}
+
+func TestHandshakeFailure(t *testing.T) {
+	c := newCounter()
+	m := memory.NewMemory("test")
+	a := NewAcceptor(m, "memory", c)
+	config := acceptor.NewDefaultHandshakeConfig()
+	config.OnFailure = a.HandshakeFailure
+	h := acceptor.NewHandshakeAcceptor(a, config)
+	go h.ListenAndServe()
+	defer h.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return h.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+
+	client, err := m.Dial()
+	assert.NoError(t, err)
+	defer client.Close()
+	assert.NoError(t, client.WritePacket(acceptor.Data, []byte{0x01}))
+	_, err = client.ReadPacket()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+	assert.Equal(t, 1, c.get("handshake handshake_required"))
+	assert.Equal(t, 1, c.get("rejected handshake"))
+	utils.ShouldEventuallyReturn(t, func() int {
+		return c.get("closed")
+	}, 1, time.Millisecond, 100*time.Millisecond)
+}
+
+func TestErrorKinds(t *testing.T) {
+	tables := []struct {
+		name      string
+		err       error
+		decode    string
+		handshake string
+	}{
+		{"test_1", acceptor.ErrInvalidHeader, "invalid_header", "invalid_header"},
+		{"test_2", acceptor.ErrReceivedMsgBiggerThanExpected, "message_too_big", "message_too_big"},
+		{"test_3", acceptor.ErrInvalidHandshake, "", "invalid_handshake"},
+		{"test_4", acceptor.ErrConnectionClosed, "", "closed"},
+		{"test_5", &timeoutError{}, "", "timeout"},
+		{"test_6", errors.New("banned"), "", "other"},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			assert.Equal(t, table.decode, DecodeErrorKind(table.err))
+			assert.Equal(t, table.handshake, HandshakeErrorKind(table.err))
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (*timeoutError) Error() string   { return "timeout" }
+func (*timeoutError) Timeout() bool   { return true }
+func (*timeoutError) Temporary() bool { return true }
+
+func TestConformance(t *testing.T) {
+	var last *memory.Memory
+	acceptortest.Run(t, acceptortest.Factory{
+		New: func() acceptor.Acceptor {
+			last = memory.NewMemory("test")
+			return NewAcceptor(last, "memory", nil)
+		},
+		Dial: func(addr string) (acceptor.Conn, error) {
+			return last.Dial()
+		},
+		Stream: true,
+	})
+}
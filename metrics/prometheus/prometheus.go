@@ -0,0 +1,134 @@
+// Package prometheus reports the measures of the metrics package as
+// Prometheus metrics, labelled with the transport and the address of the
+// acceptor:
+//
+//	connections_active                 gauge
+//	connections_accepted_total         counter
+//	connections_rejected_total         counter, by reason
+//	handshake_failures_total           counter, by kind
+//	received_packets_total             counter, by type
+//	sent_packets_total                 counter, by type
+//	received_bytes_total               counter
+//	sent_bytes_total                   counter
+//	decode_errors_total                counter, by kind
+//	conn_chan_wait_seconds             histogram
+//	write_duration_seconds             histogram
+package prometheus
+
+import (
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/metrics"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+var _ metrics.Reporter = (*Reporter)(nil)
+
+type Config struct {
+	// Namespace prefixes the names of the metrics.
+	Namespace string
+	// Registerer registers the metrics.
+	Registerer prom.Registerer
+	// WaitBuckets and WriteBuckets are the buckets, in seconds, of the
+	// conn_chan_wait_seconds and write_duration_seconds histograms.
+	WaitBuckets  []float64
+	WriteBuckets []float64
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		Namespace:    "acceptor",
+		Registerer:   prom.DefaultRegisterer,
+		WaitBuckets:  prom.ExponentialBuckets(0.0001, 4, 10),  // 100µs to 26s
+		WriteBuckets: prom.ExponentialBuckets(0.00001, 4, 10), // 10µs to 2.6s
+	}
+}
+
+// Reporter is a metrics.Reporter updating Prometheus metrics.
+type Reporter struct {
+	active            *prom.GaugeVec
+	accepted          *prom.CounterVec
+	rejected          *prom.CounterVec
+	handshakeFailures *prom.CounterVec
+	receivedPackets   *prom.CounterVec
+	sentPackets       *prom.CounterVec
+	receivedBytes     *prom.CounterVec
+	sentBytes         *prom.CounterVec
+	decodeErrors      *prom.CounterVec
+	connWait          *prom.HistogramVec
+	writeDuration     *prom.HistogramVec
+}
+
+// NewReporter registers the metrics with config.Registerer. It fails when one
+// of them is already registered.
+func NewReporter(config Config) (*Reporter, error) {
+	labels := func(names ...string) []string {
+		return append([]string{"transport", "address"}, names...)
+	}
+	counter := func(name, help string, names ...string) *prom.CounterVec {
+		return prom.NewCounterVec(prom.CounterOpts{Namespace: config.Namespace, Name: name, Help: help}, labels(names...))
+	}
+	histogram := func(name, help string, buckets []float64) *prom.HistogramVec {
+		return prom.NewHistogramVec(prom.HistogramOpts{Namespace: config.Namespace, Name: name, Help: help, Buckets: buckets}, labels())
+	}
+	r := &Reporter{
+		active:            prom.NewGaugeVec(prom.GaugeOpts{Namespace: config.Namespace, Name: "connections_active", Help: "Connections open."}, labels()),
+		accepted:          counter("connections_accepted_total", "Connections accepted."),
+		rejected:          counter("connections_rejected_total", "Connections closed before being delivered.", "reason"),
+		handshakeFailures: counter("handshake_failures_total", "Handshakes failed.", "kind"),
+		receivedPackets:   counter("received_packets_total", "Packets received.", "type"),
+		sentPackets:       counter("sent_packets_total", "Packets sent.", "type"),
+		receivedBytes:     counter("received_bytes_total", "Bytes received."),
+		sentBytes:         counter("sent_bytes_total", "Bytes sent."),
+		decodeErrors:      counter("decode_errors_total", "Invalid packets received.", "kind"),
+		connWait:          histogram("conn_chan_wait_seconds", "Time accepted connections waited to be taken from the connection channel.", config.WaitBuckets),
+		writeDuration:     histogram("write_duration_seconds", "Duration of the writes.", config.WriteBuckets),
+	}
+	collectors := []prom.Collector{
+		r.active, r.accepted, r.rejected, r.handshakeFailures, r.receivedPackets, r.sentPackets,
+		r.receivedBytes, r.sentBytes, r.decodeErrors, r.connWait, r.writeDuration,
+	}
+	for n, c := range collectors {
+		if err := config.Registerer.Register(c); err != nil {
+			for _, registered := range collectors[:n] {
+				config.Registerer.Unregister(registered)
+			}
+			return nil, err
+		}
+	}
+	return r, nil
+}
+func (r *Reporter) ConnectionAccepted(l metrics.Labels) {
+	r.accepted.WithLabelValues(l.Transport, l.Address).Inc()
+	r.active.WithLabelValues(l.Transport, l.Address).Inc()
+}
+func (r *Reporter) ConnectionClosed(l metrics.Labels) {
+	r.active.WithLabelValues(l.Transport, l.Address).Dec()
+}
+func (r *Reporter) ConnectionRejected(l metrics.Labels, reason string) {
+	r.rejected.WithLabelValues(l.Transport, l.Address, reason).Inc()
+}
+func (r *Reporter) HandshakeFailed(l metrics.Labels, kind string) {
+	r.handshakeFailures.WithLabelValues(l.Transport, l.Address, kind).Inc()
+}
+func (r *Reporter) PacketReceived(l metrics.Labels, typ acceptor.Type) {
+	r.receivedPackets.WithLabelValues(l.Transport, l.Address, metrics.TypeName(typ)).Inc()
+}
+func (r *Reporter) PacketSent(l metrics.Labels, typ acceptor.Type) {
+	r.sentPackets.WithLabelValues(l.Transport, l.Address, metrics.TypeName(typ)).Inc()
+}
+func (r *Reporter) BytesReceived(l metrics.Labels, n int) {
+	r.receivedBytes.WithLabelValues(l.Transport, l.Address).Add(float64(n))
+}
+func (r *Reporter) BytesSent(l metrics.Labels, n int) {
+	r.sentBytes.WithLabelValues(l.Transport, l.Address).Add(float64(n))
+}
+func (r *Reporter) DecodeError(l metrics.Labels, kind string) {
+	r.decodeErrors.WithLabelValues(l.Transport, l.Address, kind).Inc()
+}
+func (r *Reporter) ConnWait(l metrics.Labels, d time.Duration) {
+	r.connWait.WithLabelValues(l.Transport, l.Address).Observe(d.Seconds())
+}
+func (r *Reporter) WriteLatency(l metrics.Labels, d time.Duration) {
+	r.writeDuration.WithLabelValues(l.Transport, l.Address).Observe(d.Seconds())
+}
@@ -0,0 +1,87 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/memory"
+	"github.com/gotechbook/gotechbook-framework-acceptor/metrics"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newReporter(t *testing.T) (*Reporter, *prom.Registry) {
+	t.Helper()
+	registry := prom.NewRegistry()
+	config := NewDefaultConfig()
+	config.Registerer = registry
+	r, err := NewReporter(config)
+	assert.NoError(t, err)
+	return r, registry
+}
+
+func TestNewReporter(t *testing.T) {
+	_, registry := newReporter(t)
+	config := NewDefaultConfig()
+	config.Registerer = registry
+	_, err := NewReporter(config)
+	assert.Error(t, err)
+
+	// another namespace doesn't collide
+	config.Namespace = "other"
+	_, err = NewReporter(config)
+	assert.NoError(t, err)
+}
+
+func TestReporter(t *testing.T) {
+	r, registry := newReporter(t)
+	m := memory.NewMemory("test")
+	a := metrics.NewAcceptor(m, "memory", r)
+	go a.ListenAndServe()
+	defer a.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+
+	client, err := m.Dial()
+	assert.NoError(t, err)
+	defer client.Close()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(acceptor.Conn)
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.active.WithLabelValues("memory", "test")))
+
+	assert.NoError(t, client.WritePacket(acceptor.Data, []byte("ping")))
+	_, err = conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.NoError(t, conn.WritePacket(acceptor.Heartbeat, nil))
+	_, err = client.Write([]byte{0x09, 0x00, 0x00, 0x00})
+	assert.NoError(t, err)
+	_, err = conn.ReadPacket()
+	assert.Error(t, err)
+	conn.Close()
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(r.active.WithLabelValues("memory", "test")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.accepted.WithLabelValues("memory", "test")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.receivedPackets.WithLabelValues("memory", "test", "data")))
+	assert.Equal(t, 8.0, testutil.ToFloat64(r.receivedBytes.WithLabelValues("memory", "test")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.sentPackets.WithLabelValues("memory", "test", "heartbeat")))
+	assert.Equal(t, 4.0, testutil.ToFloat64(r.sentBytes.WithLabelValues("memory", "test")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.decodeErrors.WithLabelValues("memory", "test", "wrong_packet_type")))
+	assert.Equal(t, 1, testutil.CollectAndCount(r.connWait))
+	assert.Equal(t, 1, testutil.CollectAndCount(r.writeDuration))
+
+	count, err := testutil.GatherAndCount(registry, "acceptor_connections_accepted_total", "acceptor_conn_chan_wait_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestRejections(t *testing.T) {
+	r, _ := newReporter(t)
+	l := metrics.Labels{Transport: "tcp", Address: "127.0.0.1:3250"}
+	r.ConnectionRejected(l, metrics.ReasonHandshake)
+	r.HandshakeFailed(l, "timeout")
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.rejected.WithLabelValues("tcp", "127.0.0.1:3250", "handshake")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.handshakeFailures.WithLabelValues("tcp", "127.0.0.1:3250", "timeout")))
+}
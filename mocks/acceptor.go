@@ -1,6 +1,7 @@
 package mocks
 
 import (
+	context "context"
 	gomock "github.com/golang/mock/gomock"
 	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
 	net "net"
@@ -135,6 +136,21 @@ func (mr *MockConnMockRecorder) GetNextMessage() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNextMessage", reflect.TypeOf((*MockConn)(nil).GetNextMessage))
 }
 
+// GetNextMessageContext mocks base method.
+func (m *MockConn) GetNextMessageContext(ctx context.Context) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNextMessageContext", ctx)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNextMessageContext indicates an expected call of GetNextMessageContext.
+func (mr *MockConnMockRecorder) GetNextMessageContext(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNextMessageContext", reflect.TypeOf((*MockConn)(nil).GetNextMessageContext), ctx)
+}
+
 // LocalAddr mocks base method.
 func (m *MockConn) LocalAddr() net.Addr {
 	m.ctrl.T.Helper()
@@ -164,6 +180,21 @@ func (mr *MockConnMockRecorder) Read(b interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockConn)(nil).Read), b)
 }
 
+// ReadPacket mocks base method.
+func (m *MockConn) ReadPacket() (*acceptor.Packet, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadPacket")
+	ret0, _ := ret[0].(*acceptor.Packet)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadPacket indicates an expected call of ReadPacket.
+func (mr *MockConnMockRecorder) ReadPacket() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadPacket", reflect.TypeOf((*MockConn)(nil).ReadPacket))
+}
+
 // RemoteAddr mocks base method.
 func (m *MockConn) RemoteAddr() net.Addr {
 	m.ctrl.T.Helper()
@@ -235,6 +266,20 @@ func (mr *MockConnMockRecorder) Write(b interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockConn)(nil).Write), b)
 }
 
+// WritePacket mocks base method.
+func (m *MockConn) WritePacket(typ acceptor.Type, data []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WritePacket", typ, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WritePacket indicates an expected call of WritePacket.
+func (mr *MockConnMockRecorder) WritePacket(typ, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WritePacket", reflect.TypeOf((*MockConn)(nil).WritePacket), typ, data)
+}
+
 // MockCodec is a mock of Codec interface.
 type MockCodec struct {
 	ctrl     *gomock.Controller
@@ -274,7 +319,7 @@ func (mr *MockCodecMockRecorder) Decode(data interface{}) *gomock.Call {
 }
 
 // Encode mocks base method.
-func (m *MockCodec) Encode(typType, data []byte) ([]byte, error) {
+func (m *MockCodec) Encode(typType acceptor.Type, data []byte) ([]byte, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Encode", typType, data)
 	ret0, _ := ret[0].([]byte)
@@ -0,0 +1,276 @@
+// Package mux serves raw TCP, TLS and WebSocket clients on a single port.
+//
+// The first bytes of every connection decide where it goes: a TLS record
+// starts a handshake after which the decrypted bytes are looked at again,
+// an HTTP request is handed to a ws acceptor and a valid packet header
+// makes it a raw TCP connection. All connections arrive on one GetConnChan.
+package mux
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	"github.com/gotechbook/gotechbook-framework-acceptor/ws"
+	logger "github.com/gotechbook/gotechbook-framework-logger"
+	"net"
+	"sync"
+	"time"
+)
+
+// PeekTimeout bounds how long a new connection may take to send the bytes
+// telling its protocol, TLS handshake included.
+const PeekTimeout = 5 * time.Second
+
+// tlsRecordHandshake is the first byte of a TLS ClientHello.
+const tlsRecordHandshake = 0x16
+
+var errUnknownProtocol = errors.New("mux: unknown protocol")
+
+var _ acceptor.Acceptor = (*Mux)(nil)
+
+type Mux struct {
+	addr     string
+	connChan chan acceptor.Conn
+	mu       sync.Mutex
+	listener net.Listener
+	running  bool
+	http     *chanListener
+	ws       *ws.WS
+	tlsCfg   *tls.Config
+	certFile string
+	keyFile  string
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+func NewMux(addr string, certs ...string) *Mux {
+	keyFile := ""
+	certFile := ""
+	if len(certs) != 2 && len(certs) != 0 {
+		panic(acceptor.ErrInvalidCertificates)
+	} else if len(certs) == 2 {
+		certFile = certs[0]
+		keyFile = certs[1]
+	}
+	return &Mux{
+		addr:     addr,
+		connChan: make(chan acceptor.Conn),
+		running:  false,
+		certFile: certFile,
+		keyFile:  keyFile,
+		stopChan: make(chan struct{}),
+	}
+}
+
+func (a *Mux) GetAddr() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.listener != nil {
+		return a.listener.Addr().String()
+	}
+	return ""
+}
+func (a *Mux) GetConnChan() chan acceptor.Conn {
+	return a.connChan
+}
+func (a *Mux) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.running {
+		return
+	}
+	a.running = false
+	a.stopOnce.Do(func() {
+		close(a.stopChan)
+	})
+	a.listener.Close()
+	a.ws.Stop()
+}
+func (a *Mux) ListenAndServe() {
+	if a.hasTLSCertificates() {
+		crt, err := tls.LoadX509KeyPair(a.certFile, a.keyFile)
+		if err != nil {
+			logger.Log.Fatalf("Failed to load x509: %s", err.Error())
+		}
+		a.tlsCfg = &tls.Config{
+			Certificates: []tls.Certificate{crt},
+			NextProtos:   []string{"h2", "http/1.1"},
+		}
+	}
+	listener, err := net.Listen("tcp", a.addr)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	// HTTP connections go to a ws acceptor serving the connections pushed to it
+	a.mu.Lock()
+	a.listener = listener
+	a.http = newChanListener(listener.Addr())
+	a.ws = ws.NewWS(a.addr)
+	a.running = true
+	a.mu.Unlock()
+	go a.ws.Serve(a.http)
+	go a.forward()
+	a.serve()
+}
+
+// forward delivers the connections of the ws acceptor until the mux stops.
+func (a *Mux) forward() {
+	for {
+		select {
+		case c := <-a.ws.GetConnChan():
+			select {
+			case a.connChan <- c:
+			case <-a.stopChan:
+				c.Close()
+				return
+			}
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+func (a *Mux) hasTLSCertificates() bool {
+	return a.certFile != "" && a.keyFile != ""
+}
+func (a *Mux) isRunning() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.running
+}
+func (a *Mux) serve() {
+	defer a.Stop()
+	for a.isRunning() {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			if a.isRunning() {
+				logger.Log.Errorf("Failed to accept TCP connection: %s", err.Error())
+			}
+			continue
+		}
+		go a.dispatch(conn)
+	}
+}
+
+// dispatch finds out the protocol of conn and hands it to its acceptor.
+func (a *Mux) dispatch(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(PeekTimeout))
+	c := newPeekedConn(conn)
+	first, err := c.r.Peek(1)
+	if err == nil && first[0] == tlsRecordHandshake {
+		c, err = a.handshake(c)
+	}
+	if err == nil && c != nil {
+		err = a.route(c)
+	}
+	if err != nil {
+		logger.Log.Debugf("Failed to dispatch connection from %s: %s", conn.RemoteAddr(), err.Error())
+		conn.Close()
+	}
+}
+
+// handshake terminates TLS and returns the decrypted connection, or nil when
+// it was handed over already.
+func (a *Mux) handshake(c *peekedConn) (*peekedConn, error) {
+	if a.tlsCfg == nil {
+		return nil, errUnknownProtocol
+	}
+	tlsConn := tls.Server(c, a.tlsCfg)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	if tlsConn.ConnectionState().NegotiatedProtocol == "h2" {
+		// the HTTP server only speaks HTTP/2 on a *tls.Conn
+		tlsConn.SetDeadline(time.Time{})
+		return nil, a.http.push(tlsConn)
+	}
+	return newPeekedConn(tlsConn), nil
+}
+
+// route hands HTTP requests to the ws acceptor and packets to the tcp framing.
+func (a *Mux) route(c *peekedConn) error {
+	first, err := c.r.Peek(1)
+	if err != nil {
+		return err
+	}
+	// packet types are control characters, HTTP methods are upper case letters
+	if first[0] >= 'A' && first[0] <= 'Z' {
+		c.SetDeadline(time.Time{})
+		return a.http.push(c)
+	}
+	header, err := c.r.Peek(acceptor.HeadLength)
+	if err != nil {
+		return err
+	}
+	if _, _, err := acceptor.ParseHeader(header); err != nil {
+		return errUnknownProtocol
+	}
+	c.SetDeadline(time.Time{})
+	select {
+	case a.connChan <- tcp.NewConn(c):
+		return nil
+	case <-a.stopChan:
+		return net.ErrClosed
+	}
+}
+
+// peekedConn is a connection whose first bytes were peeked.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func newPeekedConn(conn net.Conn) *peekedConn {
+	return &peekedConn{Conn: conn, r: bufio.NewReader(conn)}
+}
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+func (c *peekedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// chanListener is a net.Listener accepting the connections pushed to it.
+type chanListener struct {
+	addr      net.Addr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newChanListener(addr net.Addr) *chanListener {
+	return &chanListener{
+		addr:   addr,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+func (l *chanListener) push(conn net.Conn) error {
+	select {
+	case l.conns <- conn:
+		return nil
+	case <-l.closed:
+		return net.ErrClosed
+	}
+}
+func (l *chanListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+func (l *chanListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+func (l *chanListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,152 @@
+package mux
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/ws"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var muxAcceptorTables = []struct {
+	name     string
+	addr     string
+	certs    []string
+	panicErr error
+}{
+	{"test_1", "127.0.0.1:0", []string{"../fixtures/server.crt", "../fixtures/server.key"}, nil},
+	{"test_2", "127.0.0.1:0", []string{}, nil},
+	{"test_3", "127.0.0.1:0", []string{"wqd"}, acceptor.ErrInvalidCertificates},
+	{"test_4", "127.0.0.1:0", []string{"wqd", "wqdqwd", "wqdqdqwd"}, acceptor.ErrInvalidCertificates},
+}
+
+func TestNewMux(t *testing.T) {
+	t.Parallel()
+	for _, table := range muxAcceptorTables {
+		t.Run(table.name, func(t *testing.T) {
+			if table.panicErr != nil {
+				assert.PanicsWithValue(t, table.panicErr, func() {
+					NewMux(table.addr, table.certs...)
+				})
+				return
+			}
+			a := NewMux(table.addr, table.certs...)
+			assert.NotNil(t, a.GetConnChan())
+			assert.Equal(t, len(table.certs) == 2, a.hasTLSCertificates())
+			// returns nothing because not listening yet
+			assert.Equal(t, "", a.GetAddr())
+		})
+	}
+}
+
+func listen(t *testing.T, certs ...string) *Mux {
+	t.Helper()
+	a := NewMux("127.0.0.1:0", certs...)
+	go a.ListenAndServe()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	return a
+}
+
+func TestRawTCP(t *testing.T) {
+	for _, tlsEnabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("tls_%v", tlsEnabled), func(t *testing.T) {
+			a := listen(t, "../fixtures/server.crt", "../fixtures/server.key")
+			defer a.Stop()
+
+			var client net.Conn
+			var err error
+			if tlsEnabled {
+				client, err = tls.Dial("tcp", a.GetAddr(), &tls.Config{InsecureSkipVerify: true})
+			} else {
+				client, err = net.Dial("tcp", a.GetAddr())
+			}
+			assert.NoError(t, err)
+			defer client.Close()
+			_, err = client.Write([]byte{0x04, 0x00, 0x00, 0x01, 0x01})
+			assert.NoError(t, err)
+
+			conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(acceptor.Conn)
+			defer conn.Close()
+			msg, err := conn.GetNextMessage()
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x01}, msg)
+
+			assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x02}))
+			b := make([]byte, 5)
+			_, err = io.ReadFull(client, b)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x02}, b)
+		})
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	for _, scheme := range []string{"ws", "wss"} {
+		t.Run(scheme, func(t *testing.T) {
+			a := listen(t, "../fixtures/server.crt", "../fixtures/server.key")
+			defer a.Stop()
+
+			dialer := websocket.Dialer{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+			client, _, err := dialer.Dial(fmt.Sprintf("%s://%s", scheme, a.GetAddr()), nil)
+			assert.NoError(t, err)
+			defer client.Close()
+			assert.NoError(t, client.WriteMessage(websocket.BinaryMessage, []byte{0x03, 0x00, 0x00, 0x00}))
+
+			conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(*ws.Conn)
+			defer conn.Close()
+			p, err := conn.ReadPacket()
+			assert.NoError(t, err)
+			assert.Equal(t, acceptor.Type(acceptor.Heartbeat), p.Type)
+		})
+	}
+}
+
+func TestUnknownProtocol(t *testing.T) {
+	tables := []struct {
+		name  string
+		certs []string
+		write []byte
+	}{
+		{"garbage", nil, []byte{0x00, 0x01, 0x02, 0x03}},
+		{"invalid_header", nil, []byte{0x09, 0x00, 0x00, 0x00}},
+		{"tls_without_certificates", nil, []byte{0x16, 0x03, 0x01, 0x00, 0x05}},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			a := listen(t, table.certs...)
+			defer a.Stop()
+			client, err := net.Dial("tcp", a.GetAddr())
+			assert.NoError(t, err)
+			defer client.Close()
+			client.Write(table.write)
+
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			_, err = client.Read(make([]byte, 1))
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+}
+
+func TestStop(t *testing.T) {
+	a := listen(t)
+	a.Stop()
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	// the ws acceptor and the goroutine forwarding its connections are gone
+	assert.Equal(t, net.ErrClosed, a.http.push(server))
+	select {
+	case a.ws.GetConnChan() <- nil:
+		t.Fatal("ws connections still forwarded")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -2,7 +2,6 @@ package acceptor
 
 import (
 	"bytes"
-	"errors"
 )
 
 type PacketCodec struct{}
@@ -15,6 +14,10 @@ func (c *PacketCodec) forward(buf *bytes.Buffer) (int, Type, error) {
 	header := buf.Next(HeadLength)
 	return ParseHeader(header)
 }
+
+// Decode returns the whole packets at the start of data, a trailing
+// incomplete packet is left out. On an invalid header it returns the packets
+// before it along with the error.
 func (c *PacketCodec) Decode(data []byte) ([]*Packet, error) {
 	buf := bytes.NewBuffer(nil)
 	buf.Write(data)
@@ -45,7 +48,7 @@ func (c *PacketCodec) Decode(data []byte) ([]*Packet, error) {
 
 		size, typ, err = c.forward(buf)
 		if err != nil {
-			return nil, err
+			return packets, err
 		}
 	}
 
@@ -53,10 +56,10 @@ func (c *PacketCodec) Decode(data []byte) ([]*Packet, error) {
 }
 func (c *PacketCodec) Encode(typ Type, data []byte) ([]byte, error) {
 	if typ < Handshake || typ > Kick {
-		return nil, errors.New("wrong packet type")
+		return nil, ErrWrongPacketType
 	}
 	if len(data) > MaxPacketSize {
-		return nil, errors.New("codec: packet size exceed")
+		return nil, ErrPacketSizeExceed
 	}
 	p := &Packet{Type: typ, Length: len(data)}
 	buf := make([]byte, p.Length+HeadLength)
@@ -76,11 +79,7 @@ func ParseHeader(header []byte) (int, Type, error) {
 	if typ < Handshake || typ > Kick {
 		return 0, 0x00, ErrWrongPacketType
 	}
-	size := BytesToInt(header[1:])
-	if size > MaxPacketSize {
-		return 0, 0x00, ErrPacketSizeExceed
-	}
-	return size, Type(typ), nil
+	return BytesToInt(header[1:]), Type(typ), nil
 }
 func BytesToInt(b []byte) int {
 	result := 0
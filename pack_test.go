@@ -33,6 +33,9 @@ var decodeTables = map[string]struct {
 	"test_error_on_forward": {invalidHeader, nil, ErrWrongPacketType},
 	"test_forward":          {handshakeHeaderPacket, []*Packet{{Handshake, 1, []byte{0x01}}}, nil},
 	"test_forward_many":     {append(handshakeHeaderPacket, handshakeHeaderPacket...), []*Packet{{Handshake, 1, []byte{0x01}}, {Handshake, 1, []byte{0x01}}}, nil},
+	"test_error_after_many": {append(handshakeHeaderPacket, invalidHeader...), []*Packet{{Handshake, 1, []byte{0x01}}}, ErrWrongPacketType},
+	"test_incomplete":       {append(handshakeHeaderPacket, Data, 0x00, 0x00, 0x02, 0x01), []*Packet{{Handshake, 1, []byte{0x01}}}, nil},
+	"test_empty":            {[]byte{}, nil, nil},
 }
 
 func TestNewPacketCodec(t *testing.T) {
@@ -107,3 +110,106 @@ func TestEncode(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeDecodeMaxPacketSize(t *testing.T) {
+	codec := NewPacketCodec()
+	data := make([]byte, MaxPacketSize)
+	data[len(data)-1] = 0x01
+	b, err := codec.Encode(Data, data)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{Data, 0xff, 0xff, 0xff}, b[:HeadLength])
+	packets, err := codec.Decode(b)
+	assert.NoError(t, err)
+	if assert.Len(t, packets, 1) {
+		assert.Equal(t, MaxPacketSize, packets[0].Length)
+		assert.True(t, bytes.Equal(data, packets[0].Data))
+	}
+
+	_, err = codec.Encode(Data, make([]byte, MaxPacketSize+1))
+	assert.Equal(t, ErrPacketSizeExceed, err)
+}
+
+func FuzzParseHeader(f *testing.F) {
+	for _, table := range forwardTables {
+		f.Add(table.buf)
+	}
+	f.Add([]byte{Data, 0xff, 0xff, 0xff})
+	f.Add([]byte{Data, 0x00, 0x00})
+	f.Fuzz(func(t *testing.T, header []byte) {
+		size, typ, err := ParseHeader(header)
+		if len(header) != HeadLength {
+			assert.Equal(t, ErrInvalidHeader, err)
+			return
+		}
+		if err != nil {
+			return
+		}
+		assert.True(t, typ >= Handshake && typ <= Kick)
+		assert.True(t, size >= 0 && size <= MaxPacketSize)
+		// the header encodes back to itself
+		assert.Equal(t, header[0], byte(typ))
+		assert.Equal(t, header[1:], IntToBytes(size))
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, table := range decodeTables {
+		f.Add(table.data)
+	}
+	f.Add(append(handshakeHeaderPacket, Data, 0x00, 0x00))
+	f.Add(append(handshakeHeaderPacket, invalidHeader...))
+	f.Add([]byte{Data, 0x00, 0x00, 0x05, 0x01})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		input := append([]byte(nil), data...)
+		packets, err := NewPacketCodec().Decode(data)
+		assert.True(t, bytes.Equal(input, data), "the input must be left untouched")
+
+		// the packets encode back to the start of data
+		var encoded []byte
+		for _, p := range packets {
+			assert.Equal(t, p.Length, len(p.Data))
+			b, err := NewPacketCodec().Encode(p.Type, p.Data)
+			assert.NoError(t, err)
+			encoded = append(encoded, b...)
+		}
+		assert.True(t, bytes.HasPrefix(data, encoded))
+		rest := data[len(encoded):]
+		if err != nil {
+			// decoding stopped at the invalid header right after them
+			assert.True(t, len(rest) >= HeadLength)
+			_, _, headerErr := ParseHeader(rest[:HeadLength])
+			assert.Equal(t, headerErr, err)
+			return
+		}
+		// what is left is at most one incomplete packet
+		if len(rest) >= HeadLength {
+			size, _, err := ParseHeader(rest[:HeadLength])
+			assert.NoError(t, err)
+			assert.Less(t, len(rest), HeadLength+size)
+		}
+	})
+}
+
+func FuzzEncodeDecode(f *testing.F) {
+	f.Add(byte(Handshake), []byte(`{"sys":{"platform":"go"}}`))
+	f.Add(byte(Heartbeat), []byte{})
+	f.Add(byte(Data), []byte{0x00, 0x01, 0x02})
+	f.Add(byte(0x00), []byte{0x01})
+	f.Add(byte(0x06), []byte{0x01})
+	f.Fuzz(func(t *testing.T, typ byte, data []byte) {
+		codec := NewPacketCodec()
+		encoded, err := codec.Encode(Type(typ), data)
+		if typ < Handshake || typ > Kick {
+			assert.Equal(t, ErrWrongPacketType, err)
+			return
+		}
+		assert.NoError(t, err)
+		packets, err := codec.Decode(encoded)
+		assert.NoError(t, err)
+		if assert.Len(t, packets, 1) {
+			assert.Equal(t, Type(typ), packets[0].Type)
+			assert.Equal(t, len(data), packets[0].Length)
+			assert.True(t, bytes.Equal(data, packets[0].Data))
+		}
+	})
+}
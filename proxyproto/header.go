@@ -0,0 +1,436 @@
+// Package proxyproto implements the PROXY protocol v1 and v2 used by load
+// balancers to pass on the address of the client they forward a connection
+// for, see https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMissingHeader   = errors.New("proxyproto: missing header")
+	ErrInvalidHeader   = errors.New("proxyproto: invalid header")
+	ErrInvalidChecksum = errors.New("proxyproto: invalid checksum")
+)
+
+// signature starts every v2 header.
+var signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	v1Prefix    = "PROXY "
+	v1MaxLength = 107
+)
+
+type Command byte
+
+const (
+	// Local is a connection made by the proxy itself, health checks for
+	// instance, the addresses are those of the connection.
+	Local Command = 0x0
+	// Proxy is a connection forwarded for a client.
+	Proxy Command = 0x1
+)
+
+// TLV types of v2 headers.
+const (
+	TypeALPN      byte = 0x01
+	TypeAuthority byte = 0x02
+	TypeCRC32C    byte = 0x03
+	TypeNoop      byte = 0x04
+	TypeUniqueID  byte = 0x05
+	TypeSSL       byte = 0x20
+	TypeNetNS     byte = 0x30
+
+	// sub-types of TypeSSL
+	TypeSSLVersion byte = 0x21
+	TypeSSLCN      byte = 0x22
+	TypeSSLCipher  byte = 0x23
+	TypeSSLSigAlg  byte = 0x24
+	TypeSSLKeyAlg  byte = 0x25
+)
+
+// SSL client flags.
+const (
+	ClientSSL      = 0x01
+	ClientCertConn = 0x02
+	ClientCertSess = 0x04
+)
+
+// TLV is a type-length-value extension of a v2 header.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// Header is a PROXY protocol header.
+type Header struct {
+	Version     int
+	Command     Command
+	Source      net.Addr
+	Destination net.Addr
+	TLVs        []TLV
+}
+
+// SSLInfo is the content of a TypeSSL TLV.
+type SSLInfo struct {
+	Client byte
+	// Verify is zero when the client presented a certificate that was
+	// verified successfully.
+	Verify uint32
+	TLVs   []TLV
+}
+
+// TLV returns the value of the first TLV of type typ.
+func (h *Header) TLV(typ byte) ([]byte, bool) {
+	return findTLV(h.TLVs, typ)
+}
+
+// UniqueID returns the unique id the proxy gave the connection.
+func (h *Header) UniqueID() []byte {
+	v, _ := h.TLV(TypeUniqueID)
+	return v
+}
+
+// Authority returns the host name the client asked for, usually with SNI.
+func (h *Header) Authority() string {
+	v, _ := h.TLV(TypeAuthority)
+	return string(v)
+}
+
+// SSL returns the TLS details of the client connection, nil if there are none.
+func (h *Header) SSL() (*SSLInfo, error) {
+	v, ok := h.TLV(TypeSSL)
+	if !ok {
+		return nil, nil
+	}
+	if len(v) < 5 {
+		return nil, ErrInvalidHeader
+	}
+	tlvs, err := parseTLVs(v[5:])
+	if err != nil {
+		return nil, err
+	}
+	return &SSLInfo{Client: v[0], Verify: binary.BigEndian.Uint32(v[1:5]), TLVs: tlvs}, nil
+}
+
+// Version returns the TLS version of the client connection.
+func (s *SSLInfo) Version() string {
+	v, _ := findTLV(s.TLVs, TypeSSLVersion)
+	return string(v)
+}
+
+// CommonName returns the common name of the client certificate.
+func (s *SSLInfo) CommonName() string {
+	v, _ := findTLV(s.TLVs, TypeSSLCN)
+	return string(v)
+}
+
+func findTLV(tlvs []TLV, typ byte) ([]byte, bool) {
+	for _, tlv := range tlvs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ReadHeader reads a v1 or v2 header from r. It returns ErrMissingHeader,
+// without consuming anything, when r doesn't start with a header.
+func ReadHeader(r *bufio.Reader) (*Header, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch b[0] {
+	case signature[0]:
+		if b, err = r.Peek(len(signature)); err != nil || !bytes.Equal(b, signature) {
+			return nil, ErrMissingHeader
+		}
+		return readV2(r)
+	case v1Prefix[0]:
+		if b, err = r.Peek(len(v1Prefix)); err != nil || string(b) != v1Prefix {
+			return nil, ErrMissingHeader
+		}
+		return readV1(r)
+	}
+	return nil, ErrMissingHeader
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+		if len(line) >= v1MaxLength {
+			return nil, ErrInvalidHeader
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidHeader
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	h := &Header{Version: 1, Command: Proxy}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		// the receiver must ignore the rest of the line
+		h.Command = Local
+		return h, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidHeader
+	}
+	src, err := parseV1Addr(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseV1Addr(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+	h.Source, h.Destination = src, dst
+	return h, nil
+}
+func parseV1Addr(proto, ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil || (proto == "TCP4") != (addr.To4() != nil) {
+		return nil, ErrInvalidHeader
+	}
+	if proto == "TCP4" {
+		addr = addr.To4()
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || (len(port) > 1 && port[0] == '0') {
+		return nil, ErrInvalidHeader
+	}
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
+
+// address families and transport protocols of v2 headers
+const (
+	familyUnspec = 0x0
+	familyInet   = 0x1
+	familyInet6  = 0x2
+	familyUnix   = 0x3
+
+	transportStream = 0x1
+	transportDgram  = 0x2
+)
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	if fixed[12]>>4 != 2 {
+		return nil, ErrInvalidHeader
+	}
+	h := &Header{Version: 2, Command: Command(fixed[12] & 0x0f)}
+	if h.Command != Local && h.Command != Proxy {
+		return nil, ErrInvalidHeader
+	}
+	family, transport := fixed[13]>>4, fixed[13]&0x0f
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	var addrLen int
+	switch family {
+	case familyUnspec:
+	case familyInet:
+		addrLen = 12
+	case familyInet6:
+		addrLen = 36
+	case familyUnix:
+		addrLen = 216
+	default:
+		return nil, ErrInvalidHeader
+	}
+	if len(payload) < addrLen {
+		return nil, ErrInvalidHeader
+	}
+	if h.Command == Proxy {
+		h.Source, h.Destination = parseV2Addrs(family, transport, payload[:addrLen])
+	}
+	tlvs, err := parseTLVs(payload[addrLen:])
+	if err != nil {
+		return nil, err
+	}
+	h.TLVs = tlvs
+	if _, ok := h.TLV(TypeCRC32C); ok {
+		if !validChecksum(fixed, payload, addrLen) {
+			return nil, ErrInvalidChecksum
+		}
+	}
+	return h, nil
+}
+func parseV2Addrs(family, transport byte, b []byte) (net.Addr, net.Addr) {
+	switch family {
+	case familyInet, familyInet6:
+		size := net.IPv4len
+		if family == familyInet6 {
+			size = net.IPv6len
+		}
+		srcIP, dstIP := net.IP(b[:size]), net.IP(b[size:2*size])
+		srcPort := int(binary.BigEndian.Uint16(b[2*size:]))
+		dstPort := int(binary.BigEndian.Uint16(b[2*size+2:]))
+		if transport == transportDgram {
+			return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}
+		}
+		return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}
+	case familyUnix:
+		network := "unix"
+		if transport == transportDgram {
+			network = "unixgram"
+		}
+		return &net.UnixAddr{Net: network, Name: unixPath(b[:108])}, &net.UnixAddr{Net: network, Name: unixPath(b[108:])}
+	}
+	return nil, nil
+}
+func unixPath(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+func parseTLVs(b []byte) ([]TLV, error) {
+	var tlvs []TLV
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return nil, ErrInvalidHeader
+		}
+		size := int(binary.BigEndian.Uint16(b[1:3]))
+		if len(b) < 3+size {
+			return nil, ErrInvalidHeader
+		}
+		tlvs = append(tlvs, TLV{Type: b[0], Value: b[3 : 3+size]})
+		b = b[3+size:]
+	}
+	return tlvs, nil
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// validChecksum checks the CRC32c of the header, computed with the value of
+// the TypeCRC32C TLV zeroed.
+func validChecksum(fixed, payload []byte, addrLen int) bool {
+	header := append(append([]byte(nil), fixed...), payload...)
+	for i := len(fixed) + addrLen; i+3 <= len(header); {
+		size := int(binary.BigEndian.Uint16(header[i+1 : i+3]))
+		if header[i] == TypeCRC32C {
+			if size != 4 {
+				return false
+			}
+			expected := binary.BigEndian.Uint32(header[i+3 : i+7])
+			copy(header[i+3:i+7], []byte{0, 0, 0, 0})
+			return crc32.Checksum(header, castagnoli) == expected
+		}
+		i += 3 + size
+	}
+	return false
+}
+
+// Format encodes the header in its version.
+func (h *Header) Format() ([]byte, error) {
+	switch h.Version {
+	case 1:
+		return h.formatV1()
+	case 2:
+		return h.formatV2()
+	}
+	return nil, ErrInvalidHeader
+}
+func (h *Header) formatV1() ([]byte, error) {
+	src, srcOK := h.Source.(*net.TCPAddr)
+	dst, dstOK := h.Destination.(*net.TCPAddr)
+	if h.Command == Local || !srcOK || !dstOK {
+		return []byte("PROXY UNKNOWN\r\n"), nil
+	}
+	proto := "TCP4"
+	if src.IP.To4() == nil {
+		proto = "TCP6"
+	}
+	if (dst.IP.To4() == nil) != (proto == "TCP6") {
+		return nil, ErrInvalidHeader
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, src.IP, dst.IP, src.Port, dst.Port)), nil
+}
+func (h *Header) formatV2() ([]byte, error) {
+	var family, transport byte
+	var addrs []byte
+	if h.Command == Proxy {
+		var err error
+		if family, transport, addrs, err = formatV2Addrs(h.Source, h.Destination); err != nil {
+			return nil, err
+		}
+	}
+	payload := addrs
+	for _, tlv := range h.TLVs {
+		if len(tlv.Value) > 0xffff {
+			return nil, ErrInvalidHeader
+		}
+		payload = append(payload, tlv.Type, byte(len(tlv.Value)>>8), byte(len(tlv.Value)))
+		payload = append(payload, tlv.Value...)
+	}
+	if len(payload) > 0xffff {
+		return nil, ErrInvalidHeader
+	}
+	b := append([]byte(nil), signature...)
+	b = append(b, 0x20|byte(h.Command), family<<4|transport, byte(len(payload)>>8), byte(len(payload)))
+	return append(b, payload...), nil
+}
+func formatV2Addrs(src, dst net.Addr) (byte, byte, []byte, error) {
+	switch src := src.(type) {
+	case *net.TCPAddr:
+		if dst, ok := dst.(*net.TCPAddr); ok {
+			family, b, err := formatIPs(src.IP, dst.IP, src.Port, dst.Port)
+			return family, transportStream, b, err
+		}
+	case *net.UDPAddr:
+		if dst, ok := dst.(*net.UDPAddr); ok {
+			family, b, err := formatIPs(src.IP, dst.IP, src.Port, dst.Port)
+			return family, transportDgram, b, err
+		}
+	case *net.UnixAddr:
+		if dst, ok := dst.(*net.UnixAddr); ok && len(src.Name) <= 108 && len(dst.Name) <= 108 {
+			transport := byte(transportStream)
+			if src.Net == "unixgram" {
+				transport = transportDgram
+			}
+			b := make([]byte, 216)
+			copy(b, src.Name)
+			copy(b[108:], dst.Name)
+			return familyUnix, transport, b, nil
+		}
+	}
+	return 0, 0, nil, ErrInvalidHeader
+}
+func formatIPs(src, dst net.IP, srcPort, dstPort int) (byte, []byte, error) {
+	family := byte(familyInet)
+	if src.To4() != nil && dst.To4() != nil {
+		src, dst = src.To4(), dst.To4()
+	} else {
+		family = familyInet6
+		src, dst = src.To16(), dst.To16()
+	}
+	if src == nil || dst == nil {
+		return 0, nil, ErrInvalidHeader
+	}
+	b := append(append([]byte(nil), src...), dst...)
+	b = append(b, byte(srcPort>>8), byte(srcPort), byte(dstPort>>8), byte(dstPort))
+	return family, b, nil
+}
@@ -0,0 +1,184 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func read(b []byte) (*Header, error) {
+	return ReadHeader(bufio.NewReader(bytes.NewReader(b)))
+}
+
+func TestReadHeaderV1(t *testing.T) {
+	tables := []struct {
+		name string
+		data string
+		src  string
+		dst  string
+		cmd  Command
+		err  error
+	}{
+		{"test_1", "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n", "192.168.0.1:56324", "192.168.0.11:443", Proxy, nil},
+		{"test_2", "PROXY TCP6 ::1 ::2 1 2\r\n", "[::1]:1", "[::2]:2", Proxy, nil},
+		{"test_3", "PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n", "", "", Local, nil},
+		{"test_4", "PROXY UNKNOWN\r\n", "", "", Local, nil},
+		{"test_5", "PROXY TCP4 ::1 ::2 1 2\r\n", "", "", 0, ErrInvalidHeader},
+		{"test_6", "PROXY TCP4 1.1.1.1 2.2.2.2 1 65536\r\n", "", "", 0, ErrInvalidHeader},
+		{"test_7", "PROXY TCP4 1.1.1.1 2.2.2.2 01 2\r\n", "", "", 0, ErrInvalidHeader},
+		{"test_8", "PROXY TCP4 1.1.1.1 2.2.2.2 1 2\n", "", "", 0, ErrInvalidHeader},
+		{"test_9", "PROXY TCP4 1.1.1.1 2.2.2.2 1\r\n", "", "", 0, ErrInvalidHeader},
+		{"test_10", "PROXY UDP4 1.1.1.1 2.2.2.2 1 2\r\n", "", "", 0, ErrInvalidHeader},
+		{"test_11", "PROXY " + string(bytes.Repeat([]byte{'a'}, 120)) + "\r\n", "", "", 0, ErrInvalidHeader},
+		{"test_12", "PROXY TCP4 1.1.1.1", "", "", 0, io.EOF},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			h, err := read([]byte(table.data))
+			assert.Equal(t, table.err, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, 1, h.Version)
+			assert.Equal(t, table.cmd, h.Command)
+			if table.src != "" {
+				assert.Equal(t, table.src, h.Source.String())
+				assert.Equal(t, table.dst, h.Destination.String())
+			} else {
+				assert.Nil(t, h.Source)
+			}
+		})
+	}
+}
+
+func TestReadHeaderMissing(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x04, 0x00, 0x00, 0x01, 0x01},
+		[]byte("GET / HTTP/1.1\r\n"),
+		[]byte("PROXZ TCP4"),
+		[]byte("\r\n\r\nQUIT"),
+	} {
+		r := bufio.NewReader(bytes.NewReader(data))
+		_, err := ReadHeader(r)
+		assert.Equal(t, ErrMissingHeader, err)
+		// nothing was consumed
+		b, _ := io.ReadAll(r)
+		assert.Equal(t, data, b)
+	}
+}
+
+func TestFormatAndReadHeaderV2(t *testing.T) {
+	ssl := []byte{ClientSSL | ClientCertConn, 0, 0, 0, 0}
+	ssl = append(ssl, TypeSSLVersion, 0, 7)
+	ssl = append(ssl, "TLSv1.3"...)
+	ssl = append(ssl, TypeSSLCN, 0, 6)
+	ssl = append(ssl, "client"...)
+	tables := []struct {
+		name string
+		h    *Header
+	}{
+		{"test_1", &Header{Version: 2, Command: Proxy,
+			Source:      &net.TCPAddr{IP: net.ParseIP("10.0.0.1").To4(), Port: 1000},
+			Destination: &net.TCPAddr{IP: net.ParseIP("10.0.0.2").To4(), Port: 443},
+			TLVs:        []TLV{{TypeUniqueID, []byte("abc")}, {TypeSSL, ssl}, {TypeAuthority, []byte("example.com")}},
+		}},
+		{"test_2", &Header{Version: 2, Command: Proxy,
+			Source:      &net.TCPAddr{IP: net.ParseIP("::1"), Port: 1000},
+			Destination: &net.TCPAddr{IP: net.ParseIP("::2"), Port: 443},
+		}},
+		{"test_3", &Header{Version: 2, Command: Proxy,
+			Source:      &net.UDPAddr{IP: net.ParseIP("10.0.0.1").To4(), Port: 1000},
+			Destination: &net.UDPAddr{IP: net.ParseIP("10.0.0.2").To4(), Port: 53},
+		}},
+		{"test_4", &Header{Version: 2, Command: Proxy,
+			Source:      &net.UnixAddr{Net: "unix", Name: "/tmp/a.sock"},
+			Destination: &net.UnixAddr{Net: "unix", Name: "/tmp/b.sock"},
+		}},
+		{"test_5", &Header{Version: 2, Command: Local}},
+		{"test_6", &Header{Version: 1, Command: Proxy,
+			Source:      &net.TCPAddr{IP: net.ParseIP("10.0.0.1").To4(), Port: 1000},
+			Destination: &net.TCPAddr{IP: net.ParseIP("10.0.0.2").To4(), Port: 443},
+		}},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			b, err := table.h.Format()
+			assert.NoError(t, err)
+			h, err := read(b)
+			assert.NoError(t, err)
+			assert.Equal(t, table.h, h)
+		})
+	}
+
+	h, err := read(mustFormat(t, tables[0].h))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("abc"), h.UniqueID())
+	assert.Equal(t, "example.com", h.Authority())
+	info, err := h.SSL()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(ClientSSL|ClientCertConn), info.Client)
+	assert.Equal(t, uint32(0), info.Verify)
+	assert.Equal(t, "TLSv1.3", info.Version())
+	assert.Equal(t, "client", info.CommonName())
+}
+
+func mustFormat(t *testing.T, h *Header) []byte {
+	t.Helper()
+	b, err := h.Format()
+	assert.NoError(t, err)
+	return b
+}
+
+func TestReadHeaderV2Checksum(t *testing.T) {
+	h := &Header{Version: 2, Command: Proxy,
+		Source:      &net.TCPAddr{IP: net.ParseIP("10.0.0.1").To4(), Port: 1000},
+		Destination: &net.TCPAddr{IP: net.ParseIP("10.0.0.2").To4(), Port: 443},
+		TLVs:        []TLV{{TypeCRC32C, []byte{0, 0, 0, 0}}},
+	}
+	b := mustFormat(t, h)
+	sum := crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli))
+	binary.BigEndian.PutUint32(b[len(b)-4:], sum)
+	_, err := read(b)
+	assert.NoError(t, err)
+
+	b[len(b)-1]++
+	_, err = read(b)
+	assert.Equal(t, ErrInvalidChecksum, err)
+}
+
+func TestReadHeaderV2Invalid(t *testing.T) {
+	valid := mustFormat(t, &Header{Version: 2, Command: Proxy,
+		Source:      &net.TCPAddr{IP: net.ParseIP("10.0.0.1").To4(), Port: 1000},
+		Destination: &net.TCPAddr{IP: net.ParseIP("10.0.0.2").To4(), Port: 443},
+	})
+	modify := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), valid...))
+	}
+	tables := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"version", modify(func(b []byte) []byte { b[12] = 0x11; return b }), ErrInvalidHeader},
+		{"command", modify(func(b []byte) []byte { b[12] = 0x22; return b }), ErrInvalidHeader},
+		{"family", modify(func(b []byte) []byte { b[13] = 0x41; return b }), ErrInvalidHeader},
+		{"short_addresses", modify(func(b []byte) []byte { b[13] = 0x21; return b }), ErrInvalidHeader},
+		{"truncated", valid[:20], io.ErrUnexpectedEOF},
+		{"truncated_tlv", modify(func(b []byte) []byte {
+			b[15] += 3
+			return append(b, TypeNoop, 0, 5)
+		}), ErrInvalidHeader},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			_, err := read(table.data)
+			assert.Equal(t, table.err, err)
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package proxyproto
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// TrustedCIDRs lists the networks of the proxies. Connections from them
+	// must start with a header, other connections are passed on untouched.
+	TrustedCIDRs []*net.IPNet
+	// HeaderTimeout bounds how long a trusted connection may take to send its
+	// header.
+	HeaderTimeout time.Duration
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		HeaderTimeout: 5 * time.Second,
+	}
+}
+
+// ParseCIDRs parses a list of CIDRs for Config.TrustedCIDRs.
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func (c Config) trusts(addr net.Addr) bool {
+	var ip net.IP
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		ip = addr.IP
+	case *net.UDPAddr:
+		ip = addr.IP
+	default:
+		return false
+	}
+	for _, n := range c.TrustedCIDRs {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Listener reads the header of the connections from trusted proxies. It is
+// meant to wrap the TCP listener, below TLS.
+type Listener struct {
+	net.Listener
+	config Config
+}
+
+func NewListener(listener net.Listener, config Config) *Listener {
+	return &Listener{Listener: listener, config: config}
+}
+
+// Accept returns the next connection. The header is read by the first call
+// to Read, LocalAddr or RemoteAddr, so a slow proxy doesn't hold up Accept.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.config.trusts(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &Conn{
+		Conn:    conn,
+		r:       bufio.NewReader(conn),
+		timeout: l.config.HeaderTimeout,
+	}, nil
+}
+
+// Conn is a connection from a trusted proxy. Its addresses are those the
+// header tells.
+type Conn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+
+	once   sync.Once
+	header *Header
+	err    error
+
+	mu           sync.Mutex
+	readDeadline time.Time
+}
+
+// FromConn returns the connection from a trusted proxy conn is or carries,
+// looking through TLS, and false if there is none.
+func FromConn(conn net.Conn) (*Conn, bool) {
+	for {
+		switch c := conn.(type) {
+		case *Conn:
+			return c, true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// ProxyHeader returns the header of the connection, reading it if needed.
+func (c *Conn) ProxyHeader() (*Header, error) {
+	c.once.Do(c.readHeader)
+	return c.header, c.err
+}
+func (c *Conn) readHeader() {
+	if c.timeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+	c.header, c.err = ReadHeader(c.r)
+	if c.timeout > 0 {
+		c.mu.Lock()
+		c.Conn.SetReadDeadline(c.readDeadline)
+		c.mu.Unlock()
+	}
+	if c.err != nil {
+		c.Conn.Close()
+	}
+}
+func (c *Conn) Read(b []byte) (int, error) {
+	if _, err := c.ProxyHeader(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the address of the client, or that of the proxy if the
+// header doesn't tell it.
+func (c *Conn) RemoteAddr() net.Addr {
+	if h, err := c.ProxyHeader(); err == nil && h.Source != nil {
+		return h.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to, or that of the
+// connection if the header doesn't tell it.
+func (c *Conn) LocalAddr() net.Addr {
+	if h, err := c.ProxyHeader(); err == nil && h.Destination != nil {
+		return h.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+// CloseWrite shuts down the writing side of the connection.
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
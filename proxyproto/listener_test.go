@@ -0,0 +1,114 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listen(t *testing.T, config Config) *Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	return NewListener(l, config)
+}
+
+func dial(t *testing.T, l net.Listener, write []byte) (net.Conn, net.Conn) {
+	t.Helper()
+	client, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	_, err = client.Write(write)
+	assert.NoError(t, err)
+	conn, err := l.Accept()
+	assert.NoError(t, err)
+	return client, conn
+}
+
+func TestListenerTrusted(t *testing.T) {
+	config := NewDefaultConfig()
+	config.TrustedCIDRs, _ = ParseCIDRs("127.0.0.0/8")
+	l := listen(t, config)
+	defer l.Close()
+	client, conn := dial(t, l, []byte("PROXY TCP4 203.0.113.7 198.51.100.1 4242 443\r\nhello"))
+	defer client.Close()
+	defer conn.Close()
+
+	assert.Equal(t, "203.0.113.7:4242", conn.RemoteAddr().String())
+	assert.Equal(t, "198.51.100.1:443", conn.LocalAddr().String())
+	b := make([]byte, 5)
+	_, err := io.ReadFull(conn, b)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), b)
+	h, err := conn.(*Conn).ProxyHeader()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, h.Version)
+}
+
+func TestListenerUntrusted(t *testing.T) {
+	config := NewDefaultConfig()
+	config.TrustedCIDRs, _ = ParseCIDRs("10.0.0.0/8")
+	l := listen(t, config)
+	defer l.Close()
+	data := []byte("PROXY TCP4 203.0.113.7 198.51.100.1 4242 443\r\n")
+	client, conn := dial(t, l, data)
+	defer client.Close()
+	defer conn.Close()
+
+	// the header is passed on as data and the address is the real one
+	assert.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+	b := make([]byte, len(data))
+	_, err := io.ReadFull(conn, b)
+	assert.NoError(t, err)
+	assert.Equal(t, data, b)
+}
+
+func TestListenerLocalCommand(t *testing.T) {
+	config := NewDefaultConfig()
+	config.TrustedCIDRs, _ = ParseCIDRs("127.0.0.0/8", "::1/128")
+	l := listen(t, config)
+	defer l.Close()
+	client, conn := dial(t, l, mustFormat(t, &Header{Version: 2, Command: Local}))
+	defer client.Close()
+	defer conn.Close()
+	assert.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+}
+
+func TestListenerMissingHeader(t *testing.T) {
+	config := NewDefaultConfig()
+	config.TrustedCIDRs, _ = ParseCIDRs("127.0.0.0/8")
+	l := listen(t, config)
+	defer l.Close()
+	client, conn := dial(t, l, []byte{0x04, 0x00, 0x00, 0x01, 0x01})
+	defer client.Close()
+
+	_, err := conn.Read(make([]byte, 1))
+	assert.Equal(t, ErrMissingHeader, err)
+	// the connection is closed
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = client.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestListenerHeaderTimeout(t *testing.T) {
+	config := Config{HeaderTimeout: 20 * time.Millisecond}
+	config.TrustedCIDRs, _ = ParseCIDRs("127.0.0.0/8")
+	l := listen(t, config)
+	defer l.Close()
+	client, conn := dial(t, l, []byte("PROXY TCP4"))
+	defer client.Close()
+
+	_, err := conn.Read(make([]byte, 1))
+	netErr, ok := err.(net.Error)
+	assert.True(t, ok && netErr.Timeout())
+}
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := ParseCIDRs("10.0.0.0/8", "fd00::/8")
+	assert.NoError(t, err)
+	assert.Len(t, nets, 2)
+	_, err = ParseCIDRs("10.0.0.0")
+	assert.Error(t, err)
+}
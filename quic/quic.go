@@ -0,0 +1,185 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	logger "github.com/gotechbook/gotechbook-framework-logger"
+	quicgo "github.com/quic-go/quic-go"
+	"net"
+	"sync"
+	"time"
+)
+
+// NextProto is the ALPN protocol negotiated by clients.
+const NextProto = "gotechbook"
+
+// StreamAcceptTimeout bounds how long a new connection may take to open its stream.
+const StreamAcceptTimeout = 5 * time.Second
+
+// lingerTimeout bounds how long a closed connection waits for the peer to
+// close it, so the data written before closing is still delivered.
+const lingerTimeout = 5 * time.Second
+
+var _ acceptor.Acceptor = (*QUIC)(nil)
+var _ acceptor.Conn = (*Conn)(nil)
+
+type QUIC struct {
+	addr     string
+	connChan chan acceptor.Conn
+	mu       sync.Mutex
+	listener *quicgo.EarlyListener
+	running  bool
+	certFile string
+	keyFile  string
+}
+
+// NewQUIC creates a QUIC acceptor. QUIC always runs over TLS 1.3, so the
+// certificate and key files are mandatory.
+func NewQUIC(addr string, certs ...string) *QUIC {
+	if len(certs) != 2 {
+		panic(acceptor.ErrInvalidCertificates)
+	}
+	return &QUIC{
+		addr:     addr,
+		connChan: make(chan acceptor.Conn),
+		running:  false,
+		certFile: certs[0],
+		keyFile:  certs[1],
+	}
+}
+
+func (a *QUIC) GetAddr() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.listener != nil {
+		return a.listener.Addr().String()
+	}
+	return ""
+}
+func (a *QUIC) GetConnChan() chan acceptor.Conn {
+	return a.connChan
+}
+func (a *QUIC) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.running = false
+	if a.listener != nil {
+		a.listener.Close()
+	}
+}
+func (a *QUIC) ListenAndServe() {
+	crt, err := tls.LoadX509KeyPair(a.certFile, a.keyFile)
+	if err != nil {
+		logger.Log.Fatalf("Failed to load x509: %s", err.Error())
+	}
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{crt},
+		NextProtos:   []string{NextProto},
+	}
+	listener, err := quicgo.ListenAddrEarly(a.addr, tlsCfg, &quicgo.Config{Allow0RTT: true})
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.setListener(listener)
+	a.serve()
+}
+func (a *QUIC) setListener(listener *quicgo.EarlyListener) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.listener = listener
+	a.running = true
+}
+func (a *QUIC) isRunning() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.running
+}
+func (a *QUIC) serve() {
+	defer a.Stop()
+	for a.isRunning() {
+		conn, err := a.listener.Accept(context.Background())
+		if err != nil {
+			if a.isRunning() {
+				logger.Log.Errorf("Failed to accept QUIC connection: %s", err.Error())
+			}
+			continue
+		}
+		go a.acceptStream(conn)
+	}
+}
+
+// acceptStream waits for the first bidirectional stream opened by the client
+// and delivers it as the connection once the handshake completed: the 0-RTT
+// data sent before may be replayed by an attacker, who can't complete it.
+func (a *QUIC) acceptStream(conn quicgo.EarlyConnection) {
+	ctx, cancel := context.WithTimeout(context.Background(), StreamAcceptTimeout)
+	defer cancel()
+	stream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to accept QUIC stream: %s", err.Error())
+		conn.CloseWithError(0, "")
+		return
+	}
+	select {
+	case <-conn.HandshakeComplete():
+	case <-ctx.Done():
+		logger.Log.Errorf("Failed to complete QUIC handshake: %s", ctx.Err().Error())
+		conn.CloseWithError(0, "")
+		return
+	}
+	sc := &streamConn{Stream: stream, conn: conn}
+	a.connChan <- &Conn{Conn: tcp.NewConn(sc), stream: sc}
+}
+
+// Conn is the first stream of a QUIC connection using the TCP packet framing.
+type Conn struct {
+	acceptor.Conn
+	stream *streamConn
+}
+
+// Unwrap returns the framed connection.
+func (c *Conn) Unwrap() acceptor.Conn {
+	return c.Conn
+}
+
+// Connection returns the underlying QUIC connection.
+func (c *Conn) Connection() quicgo.Connection {
+	return c.stream.conn
+}
+
+// streamConn adapts a QUIC stream to net.Conn.
+type streamConn struct {
+	quicgo.Stream
+	conn quicgo.Connection
+}
+
+func (s *streamConn) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+func (s *streamConn) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// CloseWrite sends the end of the stream, data written before is still delivered.
+func (s *streamConn) CloseWrite() error {
+	return s.Stream.Close()
+}
+
+// Close ends the stream right away and the connection once the peer closed it
+// or after lingerTimeout: closing the connection drops the data not sent yet.
+func (s *streamConn) Close() error {
+	s.Stream.CancelRead(0)
+	err := s.Stream.Close()
+	go func() {
+		timer := time.NewTimer(lingerTimeout)
+		defer timer.Stop()
+		select {
+		case <-s.conn.Context().Done():
+		case <-timer.C:
+			s.conn.CloseWithError(0, "")
+		}
+	}()
+	return err
+}
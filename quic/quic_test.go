@@ -0,0 +1,158 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/acceptortest"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	quicgo "github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var quicAcceptorTables = []struct {
+	name     string
+	addr     string
+	certs    []string
+	panicErr error
+}{
+	{"test_1", "127.0.0.1:0", []string{"../fixtures/server.crt", "../fixtures/server.key"}, nil},
+	{"test_2", "127.0.0.1:0", []string{}, acceptor.ErrInvalidCertificates},
+	{"test_3", "127.0.0.1:0", []string{"wqd"}, acceptor.ErrInvalidCertificates},
+	{"test_4", "127.0.0.1:0", []string{"wqd", "wqdqwd", "wqdqdqwd"}, acceptor.ErrInvalidCertificates},
+}
+
+func TestNewQUIC(t *testing.T) {
+	t.Parallel()
+	for _, table := range quicAcceptorTables {
+		t.Run(table.name, func(t *testing.T) {
+			if table.panicErr != nil {
+				assert.PanicsWithValue(t, table.panicErr, func() {
+					NewQUIC(table.addr, table.certs...)
+				})
+				return
+			}
+			a := NewQUIC(table.addr, table.certs...)
+			assert.Equal(t, table.certs[0], a.certFile)
+			assert.Equal(t, table.certs[1], a.keyFile)
+			assert.NotNil(t, a.GetConnChan())
+			// returns nothing because not listening yet
+			assert.Equal(t, "", a.GetAddr())
+		})
+	}
+}
+
+func TestStopBeforeListen(t *testing.T) {
+	t.Parallel()
+	a := NewQUIC("127.0.0.1:0", "../fixtures/server.crt", "../fixtures/server.key")
+	assert.NotPanics(t, a.Stop)
+}
+
+func mustDialQUIC(t *testing.T, a *QUIC) (quicgo.Connection, quicgo.Stream) {
+	t.Helper()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	tlsCfg := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{NextProto}}
+	conn, err := quicgo.DialAddr(context.Background(), a.GetAddr(), tlsCfg, nil)
+	assert.NoError(t, err)
+	stream, err := conn.OpenStreamSync(context.Background())
+	assert.NoError(t, err)
+	return conn, stream
+}
+
+func TestListenAndServe(t *testing.T) {
+	a := NewQUIC("127.0.0.1:0", "../fixtures/server.crt", "../fixtures/server.key")
+	go a.ListenAndServe()
+	defer a.Stop()
+
+	conn, stream := mustDialQUIC(t, a)
+	defer conn.CloseWithError(0, "")
+	msg := []byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x02}
+	_, err := stream.Write(msg)
+	assert.NoError(t, err)
+
+	playerConn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(*Conn)
+	b, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg, b)
+	assert.Equal(t, conn.LocalAddr().(*net.UDPAddr).Port, playerConn.RemoteAddr().(*net.UDPAddr).Port)
+	assert.Equal(t, tls.VersionTLS13, int(playerConn.Connection().ConnectionState().TLS.Version))
+	assert.True(t, playerConn.Connection().ConnectionState().TLS.HandshakeComplete)
+
+	assert.NoError(t, playerConn.WritePacket(acceptor.Data, []byte{0x03}))
+	reply := make([]byte, 5)
+	_, err = io.ReadFull(stream, reply)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x03}, reply)
+}
+
+func TestSendKick(t *testing.T) {
+	a := NewQUIC("127.0.0.1:0", "../fixtures/server.crt", "../fixtures/server.key")
+	go a.ListenAndServe()
+	defer a.Stop()
+
+	conn, stream := mustDialQUIC(t, a)
+	defer conn.CloseWithError(0, "")
+	_, err := stream.Write([]byte{0x03, 0x00, 0x00, 0x00})
+	assert.NoError(t, err)
+	playerConn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(*Conn)
+
+	done := make(chan error)
+	go func() {
+		done <- acceptor.SendKick(playerConn, &acceptor.KickReason{Code: acceptor.KickCodeServerShutdown})
+	}()
+
+	// the kick is followed by the end of the stream
+	b, err := io.ReadAll(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(acceptor.Kick), b[0])
+	stream.Close()
+	assert.NoError(t, <-done)
+}
+
+func TestConformance(t *testing.T) {
+	acceptortest.Run(t, acceptortest.Factory{
+		New: func() acceptor.Acceptor {
+			return NewQUIC("127.0.0.1:0", "../fixtures/server.crt", "../fixtures/server.key")
+		},
+		Dial: func(addr string) (acceptor.Conn, error) {
+			raddr, err := net.ResolveUDPAddr("udp", addr)
+			if err != nil {
+				return nil, err
+			}
+			// the local address of a socket bound to the wildcard address
+			// isn't the one the acceptor sees
+			socket, err := net.ListenUDP("udp", &net.UDPAddr{IP: raddr.IP})
+			if err != nil {
+				return nil, err
+			}
+			tlsCfg := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{NextProto}}
+			// fail fast once the acceptor stopped
+			config := &quicgo.Config{HandshakeIdleTimeout: acceptortest.Timeout / 2}
+			conn, err := quicgo.Dial(context.Background(), socket, raddr, tlsCfg, config)
+			if err != nil {
+				socket.Close()
+				return nil, err
+			}
+			go func() {
+				<-conn.Context().Done()
+				socket.Close()
+			}()
+			stream, err := conn.OpenStreamSync(context.Background())
+			if err != nil {
+				conn.CloseWithError(0, "")
+				return nil, err
+			}
+			return tcp.NewConn(&streamConn{Stream: stream, conn: conn}), nil
+		},
+		Stream:      true,
+		FirstPacket: true,
+	})
+}
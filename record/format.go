@@ -0,0 +1,212 @@
+// Package record records the traffic of connections and replays it, to
+// reproduce client bugs.
+//
+// A recording holds the packets of one connection, in both directions, with
+// the time they went through. The file starts with the magic "GTBR", a
+// version byte and a header; then each entry is a direction byte, the
+// microseconds since the previous entry, the length of the data and the
+// data, the numbers as uvarints.
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	magic   = "GTBR"
+	version = 1
+	// MaxEntrySize is the size of the largest entry data, a whole packet.
+	MaxEntrySize = acceptor.HeadLength + acceptor.MaxPacketSize
+)
+
+var (
+	ErrInvalidRecording = errors.New("record: invalid recording")
+	ErrEntryTooLarge    = errors.New("record: entry too large")
+)
+
+// Direction tells which side sent the data of an entry.
+type Direction byte
+
+const (
+	In  Direction = 1 // from the client
+	Out Direction = 2 // to the client
+)
+
+func (d Direction) String() string {
+	switch d {
+	case In:
+		return "in"
+	case Out:
+		return "out"
+	}
+	return fmt.Sprintf("Direction(%d)", byte(d))
+}
+
+// Header describes the recorded connection.
+type Header struct {
+	ID         int64
+	Start      time.Time
+	RemoteAddr string
+	LocalAddr  string
+}
+
+// Entry is data read from or written to the connection, usually whole
+// packets.
+type Entry struct {
+	Direction Direction
+	// Time since the start of the recording.
+	Time time.Duration
+	Data []byte
+}
+
+// Writer writes a recording, it is safe for concurrent use.
+type Writer struct {
+	mu   sync.Mutex
+	w    *bufio.Writer
+	c    io.Closer
+	now  func() time.Time
+	head Header
+	last time.Duration
+}
+
+// NewWriter writes the header of a recording to w. Close closes w if it is
+// an io.Closer.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	writer := &Writer{w: bufio.NewWriter(w), now: time.Now, head: h}
+	if c, ok := w.(io.Closer); ok {
+		writer.c = c
+	}
+	if h.Start.IsZero() {
+		writer.head.Start = writer.now()
+	}
+	buf := append([]byte(magic), version)
+	buf = binary.AppendVarint(buf, writer.head.ID)
+	buf = binary.AppendVarint(buf, writer.head.Start.UnixNano())
+	buf = appendString(buf, h.RemoteAddr)
+	buf = appendString(buf, h.LocalAddr)
+	if _, err := writer.w.Write(buf); err != nil {
+		return nil, err
+	}
+	return writer, writer.w.Flush()
+}
+
+// Write records data as sent in direction d, now.
+func (w *Writer) Write(d Direction, data []byte) error {
+	if len(data) > MaxEntrySize {
+		return ErrEntryTooLarge
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	t := w.now().Sub(w.head.Start)
+	if t < w.last {
+		t = w.last
+	}
+	delta := (t - w.last) / time.Microsecond
+	buf := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(data))
+	buf = append(buf, byte(d))
+	buf = binary.AppendUvarint(buf, uint64(delta))
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	buf = append(buf, data...)
+	w.last += delta * time.Microsecond
+	if _, err := w.w.Write(buf); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.w.Flush()
+	if w.c != nil {
+		if cerr := w.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// Reader reads a recording.
+type Reader struct {
+	r    *bufio.Reader
+	head Header
+	last time.Duration
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{r: bufio.NewReader(r)}
+	buf := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(reader.r, buf); err != nil || string(buf[:len(magic)]) != magic {
+		return nil, ErrInvalidRecording
+	}
+	if buf[len(magic)] != version {
+		return nil, fmt.Errorf("%w: unknown version %d", ErrInvalidRecording, buf[len(magic)])
+	}
+	id, err := binary.ReadVarint(reader.r)
+	if err != nil {
+		return nil, ErrInvalidRecording
+	}
+	start, err := binary.ReadVarint(reader.r)
+	if err != nil {
+		return nil, ErrInvalidRecording
+	}
+	remote, err := reader.readString()
+	if err != nil {
+		return nil, err
+	}
+	local, err := reader.readString()
+	if err != nil {
+		return nil, err
+	}
+	reader.head = Header{ID: id, Start: time.Unix(0, start), RemoteAddr: remote, LocalAddr: local}
+	return reader, nil
+}
+func (r *Reader) Header() Header {
+	return r.head
+}
+
+// Next returns the next entry, io.EOF after the last one.
+func (r *Reader) Next() (*Entry, error) {
+	d, err := r.r.ReadByte()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil || Direction(d) != In && Direction(d) != Out {
+		return nil, ErrInvalidRecording
+	}
+	delta, err := binary.ReadUvarint(r.r)
+	if err != nil || delta > uint64(1<<63-1)/uint64(time.Microsecond) {
+		return nil, ErrInvalidRecording
+	}
+	data, err := r.readBytes(MaxEntrySize)
+	if err != nil {
+		return nil, err
+	}
+	r.last += time.Duration(delta) * time.Microsecond
+	return &Entry{Direction: Direction(d), Time: r.last, Data: data}, nil
+}
+func (r *Reader) readString() (string, error) {
+	b, err := r.readBytes(1 << 10)
+	return string(b), err
+}
+func (r *Reader) readBytes(max int) ([]byte, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil || size > uint64(max) {
+		return nil, ErrInvalidRecording
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, ErrInvalidRecording
+	}
+	return b, nil
+}
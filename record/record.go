@@ -0,0 +1,185 @@
+package record
+
+import (
+	"context"
+	"fmt"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	logger "github.com/gotechbook/gotechbook-framework-logger"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var _ acceptor.Conn = (*Conn)(nil)
+var _ acceptor.Acceptor = (*Acceptor)(nil)
+
+var codec = acceptor.NewPacketCodec()
+
+// Config selects the connections to record: a connection is recorded when
+// its ID, its remote IP or the sampling picks it.
+type Config struct {
+	// IDs of the connections, the n-th connection accepted having ID n,
+	// counting from zero.
+	IDs []int64
+	// RemoteIPs are the networks of the clients.
+	RemoteIPs []*net.IPNet
+	// SampleRate is the probability any connection is recorded.
+	SampleRate float64
+	// Create returns where to write the recording of a connection.
+	Create func(h Header) (io.WriteCloser, error)
+}
+
+// NewDefaultConfig records nothing, to the current directory.
+func NewDefaultConfig() Config {
+	return Config{Create: Dir(".")}
+}
+
+// Dir writes the recording of connection ID in the file conn-ID.rec of dir.
+func Dir(dir string) func(h Header) (io.WriteCloser, error) {
+	return func(h Header) (io.WriteCloser, error) {
+		return os.Create(filepath.Join(dir, fmt.Sprintf("conn-%d.rec", h.ID)))
+	}
+}
+
+// selects tells if config picks the connection id.
+func (config Config) selects(id int64, conn acceptor.Conn) bool {
+	for _, selected := range config.IDs {
+		if selected == id {
+			return true
+		}
+	}
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			for _, network := range config.RemoteIPs {
+				if network.Contains(ip) {
+					return true
+				}
+			}
+		}
+	}
+	return config.SampleRate > 0 && rand.Float64() < config.SampleRate
+}
+
+// Conn records the packets read from and written to the wrapped connection.
+// Recording is best effort: once writing the recording fails the connection
+// goes on unrecorded.
+type Conn struct {
+	acceptor.Conn
+	w       *Writer
+	mu      sync.Mutex
+	stopped bool // the recording failed or is closed
+}
+
+func NewConn(conn acceptor.Conn, w *Writer) *Conn {
+	return &Conn{Conn: conn, w: w}
+}
+
+// Unwrap returns the wrapped connection.
+func (c *Conn) Unwrap() acceptor.Conn {
+	return c.Conn
+}
+func (c *Conn) GetNextMessage() (b []byte, err error) {
+	return c.GetNextMessageContext(context.Background())
+}
+func (c *Conn) GetNextMessageContext(ctx context.Context) (b []byte, err error) {
+	b, err = c.Conn.GetNextMessageContext(ctx)
+	if err == nil {
+		c.record(In, b)
+	}
+	return b, err
+}
+func (c *Conn) ReadPacket() (*acceptor.Packet, error) {
+	p, err := c.Conn.ReadPacket()
+	if err == nil {
+		if b, err := codec.Encode(p.Type, p.Data); err == nil {
+			c.record(In, b)
+		}
+	}
+	return p, err
+}
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.record(In, b[:n])
+	}
+	return n, err
+}
+func (c *Conn) WritePacket(typ acceptor.Type, data []byte) error {
+	err := c.Conn.WritePacket(typ, data)
+	if err == nil {
+		if b, err := codec.Encode(typ, data); err == nil {
+			c.record(Out, b)
+		}
+	}
+	return err
+}
+func (c *Conn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.record(Out, b[:n])
+	}
+	return n, err
+}
+
+// Close closes the connection, then the recording.
+func (c *Conn) Close() error {
+	err := c.Conn.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.stopped {
+		c.stopped = true
+		c.w.Close()
+	}
+	return err
+}
+func (c *Conn) record(d Direction, b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+	if err := c.w.Write(d, b); err != nil {
+		logger.Log.Errorf("Failed to record connection %s: %s", c.RemoteAddr(), err.Error())
+		c.stopped = true
+		c.w.Close()
+	}
+}
+
+// Acceptor delivers the connections of an inner Acceptor, wrapped in a Conn
+// for the ones its config selects.
+type Acceptor struct {
+	*acceptor.WrapAcceptor
+	config Config
+}
+
+func NewAcceptor(a acceptor.Acceptor, config Config) *Acceptor {
+	r := &Acceptor{config: config}
+	r.WrapAcceptor = acceptor.NewWrapAcceptor(a, func(n int, conn acceptor.Conn) (acceptor.Conn, error) {
+		return r.wrap(int64(n), conn), nil
+	})
+	return r
+}
+
+// wrap records conn if selected, a connection that can't be recorded is
+// delivered as is.
+func (a *Acceptor) wrap(id int64, conn acceptor.Conn) acceptor.Conn {
+	if !a.config.selects(id, conn) {
+		return conn
+	}
+	h := Header{ID: id, RemoteAddr: conn.RemoteAddr().String(), LocalAddr: conn.LocalAddr().String()}
+	out, err := a.config.Create(h)
+	if err != nil {
+		logger.Log.Errorf("Failed to record connection %d: %s", id, err.Error())
+		return conn
+	}
+	w, err := NewWriter(out, h)
+	if err != nil {
+		logger.Log.Errorf("Failed to record connection %d: %s", id, err.Error())
+		out.Close()
+		return conn
+	}
+	return NewConn(conn, w)
+}
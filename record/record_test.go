@@ -0,0 +1,184 @@
+package record
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/memory"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// buffer is a recording destination kept in memory.
+type buffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *buffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func readAll(t *testing.T, b []byte) (Header, []*Entry) {
+	t.Helper()
+	r, err := NewReader(bytes.NewReader(b))
+	assert.NoError(t, err)
+	var entries []*Entry
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return r.Header(), entries
+		}
+		assert.NoError(t, err)
+		entries = append(entries, e)
+	}
+}
+
+func TestWriterReader(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	now := start
+	var out buffer
+	w, err := NewWriter(&out, Header{ID: 7, Start: start, RemoteAddr: "10.0.0.1:5000", LocalAddr: "10.0.0.2:3250"})
+	assert.NoError(t, err)
+	w.now = func() time.Time { return now }
+
+	now = start.Add(1500 * time.Microsecond)
+	assert.NoError(t, w.Write(In, []byte{0x01, 0x00, 0x00, 0x00}))
+	now = start.Add(time.Second)
+	assert.NoError(t, w.Write(Out, []byte{0x02, 0x00, 0x00, 0x00}))
+	// a time going backwards is kept in order
+	now = start
+	assert.NoError(t, w.Write(In, nil))
+	assert.Equal(t, ErrEntryTooLarge, w.Write(In, make([]byte, MaxEntrySize+1)))
+	assert.NoError(t, w.Close())
+	assert.True(t, out.closed)
+
+	h, entries := readAll(t, out.Bytes())
+	assert.Equal(t, int64(7), h.ID)
+	assert.True(t, start.Equal(h.Start))
+	assert.Equal(t, "10.0.0.1:5000", h.RemoteAddr)
+	assert.Equal(t, "10.0.0.2:3250", h.LocalAddr)
+	assert.Equal(t, []*Entry{
+		{Direction: In, Time: 1500 * time.Microsecond, Data: []byte{0x01, 0x00, 0x00, 0x00}},
+		{Direction: Out, Time: time.Second, Data: []byte{0x02, 0x00, 0x00, 0x00}},
+		{Direction: In, Time: time.Second, Data: []byte{}},
+	}, entries)
+}
+
+func TestReaderInvalid(t *testing.T) {
+	var out buffer
+	w, err := NewWriter(&out, Header{ID: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(In, []byte{0x01, 0x02}))
+	valid := out.Bytes()
+	header := len(valid) - 5
+
+	tables := []struct {
+		name string
+		data []byte
+	}{
+		{"test_1", []byte("GTB")},
+		{"test_2", []byte("XXXX\x01")},
+		{"test_3", append([]byte(magic), 9)},
+		{"test_4", valid[:header-1]},
+		{"test_5", valid[:len(valid)-1]},
+		{"test_6", append(append([]byte{}, valid[:header]...), 0x03, 0x00, 0x00)},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(table.data))
+			if err == nil {
+				_, err = r.Next()
+			}
+			assert.ErrorIs(t, err, ErrInvalidRecording)
+		})
+	}
+}
+
+func TestSelects(t *testing.T) {
+	client, server := memory.Pipe(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}, memory.Addr("server"))
+	defer client.Close()
+	conn := &Conn{Conn: tcp.NewConn(server)}
+	networks := []*net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(8, 32)}}
+
+	tables := []struct {
+		name   string
+		config Config
+		id     int64
+		out    bool
+	}{
+		{"test_1", Config{}, 0, false},
+		{"test_2", Config{IDs: []int64{3, 4}}, 4, true},
+		{"test_3", Config{IDs: []int64{3, 4}}, 5, false},
+		{"test_4", Config{RemoteIPs: networks}, 0, true},
+		{"test_5", Config{RemoteIPs: []*net.IPNet{{IP: net.ParseIP("192.168.0.0"), Mask: net.CIDRMask(16, 32)}}}, 0, false},
+		{"test_6", Config{SampleRate: 1}, 0, true},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			assert.Equal(t, table.out, table.config.selects(table.id, conn))
+		})
+	}
+}
+
+func TestAcceptor(t *testing.T) {
+	recordings := map[int64]*buffer{}
+	config := NewDefaultConfig()
+	config.IDs = []int64{0}
+	config.Create = func(h Header) (io.WriteCloser, error) {
+		recordings[h.ID] = &buffer{}
+		return recordings[h.ID], nil
+	}
+	m := memory.NewMemory("test")
+	a := NewAcceptor(m, config)
+	go a.ListenAndServe()
+	defer a.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+
+	client, err := m.Dial()
+	assert.NoError(t, err)
+	defer client.Close()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(acceptor.Conn)
+	assert.IsType(t, &Conn{}, conn)
+
+	assert.NoError(t, client.WritePacket(acceptor.Data, []byte("ping")))
+	assert.NoError(t, client.WritePacket(acceptor.Heartbeat, nil))
+	msg, err := conn.GetNextMessage()
+	assert.NoError(t, err)
+	_, err = conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte("pong")))
+	_, err = conn.Write([]byte{0x03, 0x00, 0x00, 0x00})
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Close())
+
+	h, entries := readAll(t, recordings[0].Bytes())
+	assert.True(t, recordings[0].closed)
+	assert.Equal(t, "test", h.LocalAddr)
+	assert.Equal(t, client.LocalAddr().String(), h.RemoteAddr)
+	assert.Len(t, entries, 4)
+	assert.Equal(t, In, entries[0].Direction)
+	assert.Equal(t, msg, entries[0].Data)
+	assert.Equal(t, []byte{0x03, 0x00, 0x00, 0x00}, entries[1].Data)
+	assert.Equal(t, Out, entries[2].Direction)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x04, 'p', 'o', 'n', 'g'}, entries[2].Data)
+	assert.Equal(t, Out, entries[3].Direction)
+
+	// the second connection isn't selected
+	client, err = m.Dial()
+	assert.NoError(t, err)
+	defer client.Close()
+	conn = utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(acceptor.Conn)
+	defer conn.Close()
+	assert.NotContains(t, recordings, int64(1))
+	_, ok := conn.(*Conn)
+	assert.False(t, ok)
+}
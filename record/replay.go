@@ -0,0 +1,177 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/memory"
+	"io"
+	"time"
+)
+
+var ErrMismatch = errors.New("record: responses don't match the recording")
+
+type ReplayConfig struct {
+	// RealTime sends the packets at the time they were recorded, instead of
+	// as fast as possible.
+	RealTime bool
+	// Timeout bounds the wait for each response, zero takes the default.
+	Timeout time.Duration
+	// Ignore lists the types of the packets to the client left out of the
+	// comparison, such as heartbeats whose timing varies.
+	Ignore []acceptor.Type
+	// Equal compares a recorded packet with the one the server sent, both
+	// whole with their header. Nil is bytes.Equal.
+	Equal func(recorded, actual []byte) bool
+}
+
+func NewDefaultReplayConfig() ReplayConfig {
+	return ReplayConfig{
+		Timeout: 5 * time.Second,
+		Ignore:  []acceptor.Type{acceptor.Heartbeat},
+		Equal:   bytes.Equal,
+	}
+}
+
+// Mismatch is a response that doesn't match the recording.
+type Mismatch struct {
+	// Index of the packet among the compared ones, from zero.
+	Index    int
+	Recorded []byte
+	// Actual is nil when no response came, Err tells why.
+	Actual []byte
+	Err    error
+}
+
+type Result struct {
+	// Sent counts the entries sent to the server.
+	Sent int
+	// Compared counts the packets compared.
+	Compared   int
+	Mismatches []Mismatch
+}
+
+// Replay connects to m as the recorded client: it sends what the client
+// sent and checks the server answers what was recorded, packet by packet.
+// It returns ErrMismatch along with the result when some responses don't
+// match, and stops at the first missing one.
+func Replay(ctx context.Context, m *memory.Memory, r *Reader, config ReplayConfig) (*Result, error) {
+	if config.Timeout <= 0 {
+		config.Timeout = NewDefaultReplayConfig().Timeout
+	}
+	if config.Equal == nil {
+		config.Equal = bytes.Equal
+	}
+	conn, err := m.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	rp := &replay{conn: conn, config: config, result: &Result{}}
+	start := time.Now()
+	var recorded []byte
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rp.result, err
+		}
+		switch e.Direction {
+		case In:
+			if config.RealTime {
+				if err := sleep(ctx, time.Until(start.Add(e.Time))); err != nil {
+					return rp.result, err
+				}
+			}
+			if _, err := conn.Write(e.Data); err != nil {
+				return rp.result, err
+			}
+			rp.result.Sent++
+		case Out:
+			recorded = append(recorded, e.Data...)
+			for {
+				packet, rest, ok := nextPacket(recorded)
+				if !ok {
+					break
+				}
+				recorded = rest
+				if rp.ignored(packet) {
+					continue
+				}
+				if !rp.compare(ctx, packet) {
+					return rp.result, ErrMismatch
+				}
+			}
+		}
+	}
+	if len(rp.result.Mismatches) > 0 {
+		return rp.result, ErrMismatch
+	}
+	return rp.result, nil
+}
+
+type replay struct {
+	conn   acceptor.Conn
+	config ReplayConfig
+	result *Result
+}
+
+// compare reads the next response and compares it with recorded. It returns
+// false when no response came.
+func (rp *replay) compare(ctx context.Context, recorded []byte) bool {
+	index := rp.result.Compared
+	rp.result.Compared++
+	ctx, cancel := context.WithTimeout(ctx, rp.config.Timeout)
+	defer cancel()
+	for {
+		actual, err := rp.conn.GetNextMessageContext(ctx)
+		if err != nil {
+			rp.result.Mismatches = append(rp.result.Mismatches, Mismatch{Index: index, Recorded: recorded, Err: err})
+			return false
+		}
+		if rp.ignored(actual) {
+			continue
+		}
+		if !rp.config.Equal(recorded, actual) {
+			rp.result.Mismatches = append(rp.result.Mismatches, Mismatch{Index: index, Recorded: recorded, Actual: actual})
+		}
+		return true
+	}
+}
+func (rp *replay) ignored(packet []byte) bool {
+	for _, typ := range rp.config.Ignore {
+		if acceptor.Type(packet[0]) == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// nextPacket splits the first whole packet off b.
+func nextPacket(b []byte) (packet, rest []byte, ok bool) {
+	if len(b) < acceptor.HeadLength {
+		return nil, b, false
+	}
+	size := acceptor.HeadLength + acceptor.BytesToInt(b[1:acceptor.HeadLength])
+	if len(b) < size {
+		return nil, b, false
+	}
+	return b[:size], b[size:], true
+}
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
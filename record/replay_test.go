@@ -0,0 +1,158 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/memory"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// serve runs a, answering the Data packets of its connections with handle,
+// and closing them when the client does. done receives every closed one.
+func serve(t *testing.T, a acceptor.Acceptor, handle func(acceptor.Conn, []byte), done chan struct{}) {
+	t.Helper()
+	go a.ListenAndServe()
+	t.Cleanup(a.Stop)
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+	go func() {
+		for conn := range a.GetConnChan() {
+			go func(conn acceptor.Conn) {
+				defer func() {
+					conn.Close()
+					if done != nil {
+						done <- struct{}{}
+					}
+				}()
+				for {
+					p, err := conn.ReadPacket()
+					if err != nil {
+						return
+					}
+					if p.Type == acceptor.Data {
+						handle(conn, p.Data)
+					}
+				}
+			}(conn)
+		}
+	}()
+}
+
+func upper(conn acceptor.Conn, data []byte) {
+	conn.WritePacket(acceptor.Data, bytes.ToUpper(data))
+}
+
+// recordSession records a client sending hello and world, pause apart.
+func recordSession(t *testing.T, pause time.Duration) []byte {
+	t.Helper()
+	out := &buffer{}
+	config := NewDefaultConfig()
+	config.SampleRate = 1
+	config.Create = func(h Header) (io.WriteCloser, error) {
+		return out, nil
+	}
+	m := memory.NewMemory("test")
+	done := make(chan struct{}, 1)
+	serve(t, NewAcceptor(m, config), upper, done)
+
+	client, err := m.Dial()
+	assert.NoError(t, err)
+	for n, data := range []string{"hello", "world"} {
+		if n > 0 {
+			time.Sleep(pause)
+		}
+		assert.NoError(t, client.WritePacket(acceptor.Data, []byte(data)))
+		_, err := client.ReadPacket()
+		assert.NoError(t, err)
+	}
+	client.Close()
+	utils.ShouldEventuallyReceive(t, done, 100*time.Millisecond)
+	return out.Bytes()
+}
+
+func replayTo(t *testing.T, recording []byte, handle func(acceptor.Conn, []byte), config ReplayConfig) (*Result, error) {
+	t.Helper()
+	m := memory.NewMemory("test")
+	serve(t, m, handle, nil)
+	r, err := NewReader(bytes.NewReader(recording))
+	assert.NoError(t, err)
+	return Replay(context.Background(), m, r, config)
+}
+
+func TestReplayZeroConfig(t *testing.T) {
+	recording := recordSession(t, 0)
+	result, err := replayTo(t, recording, upper, ReplayConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, &Result{Sent: 2, Compared: 2}, result)
+}
+
+func TestReplay(t *testing.T) {
+	recording := recordSession(t, 0)
+	config := NewDefaultReplayConfig()
+
+	result, err := replayTo(t, recording, upper, config)
+	assert.NoError(t, err)
+	assert.Equal(t, &Result{Sent: 2, Compared: 2}, result)
+
+	// heartbeats are left out
+	result, err = replayTo(t, recording, func(conn acceptor.Conn, data []byte) {
+		conn.WritePacket(acceptor.Heartbeat, nil)
+		upper(conn, data)
+	}, config)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Compared)
+
+	result, err = replayTo(t, recording, func(conn acceptor.Conn, data []byte) {
+		conn.WritePacket(acceptor.Data, data)
+	}, config)
+	assert.Equal(t, ErrMismatch, err)
+	assert.Equal(t, []Mismatch{
+		{Index: 0, Recorded: []byte("\x04\x00\x00\x05HELLO"), Actual: []byte("\x04\x00\x00\x05hello")},
+		{Index: 1, Recorded: []byte("\x04\x00\x00\x05WORLD"), Actual: []byte("\x04\x00\x00\x05world")},
+	}, result.Mismatches)
+
+	// a custom comparison accepts them
+	config.Equal = func(recorded, actual []byte) bool {
+		return bytes.EqualFold(recorded, actual)
+	}
+	_, err = replayTo(t, recording, func(conn acceptor.Conn, data []byte) {
+		conn.WritePacket(acceptor.Data, data)
+	}, config)
+	assert.NoError(t, err)
+}
+
+func TestReplayNoResponse(t *testing.T) {
+	recording := recordSession(t, 0)
+	config := NewDefaultReplayConfig()
+	config.Timeout = 20 * time.Millisecond
+	result, err := replayTo(t, recording, func(acceptor.Conn, []byte) {}, config)
+	assert.Equal(t, ErrMismatch, err)
+	assert.Equal(t, 1, result.Sent)
+	assert.Len(t, result.Mismatches, 1)
+	assert.Nil(t, result.Mismatches[0].Actual)
+	assert.Equal(t, context.DeadlineExceeded, result.Mismatches[0].Err)
+}
+
+func TestReplayRealTime(t *testing.T) {
+	pause := 50 * time.Millisecond
+	recording := recordSession(t, pause)
+
+	config := NewDefaultReplayConfig()
+	start := time.Now()
+	_, err := replayTo(t, recording, upper, config)
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), pause)
+
+	config.RealTime = true
+	start = time.Now()
+	_, err = replayTo(t, recording, upper, config)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), pause)
+}
@@ -0,0 +1,210 @@
+// Package rudp is a reliable UDP acceptor for latency sensitive clients.
+//
+// Sessions run a KCP-like selective repeat ARQ: every segment is acked on
+// receipt, lost segments are retransmitted on timeout or as soon as later
+// segments were acked, and nothing waits for a congestion window. Each
+// session is identified by a 32-bit id chosen by the client and carries a
+// byte stream using the same packet framing as the tcp acceptor.
+package rudp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	logger "github.com/gotechbook/gotechbook-framework-logger"
+	"net"
+	"sync"
+)
+
+const maxDatagramSize = 65535
+
+var _ acceptor.Acceptor = (*RUDP)(nil)
+var _ acceptor.Conn = (*Conn)(nil)
+
+type RUDP struct {
+	addr     string
+	config   Config
+	connChan chan acceptor.Conn
+	mu       sync.Mutex
+	conn     net.PacketConn
+	running  bool
+	sessions map[uint32]*session
+}
+
+// NewRUDP listens on addr, the zero fields of config take their default
+// value.
+func NewRUDP(addr string, config Config) *RUDP {
+	return &RUDP{
+		addr:     addr,
+		config:   config.withDefaults(),
+		connChan: make(chan acceptor.Conn),
+		running:  false,
+		sessions: make(map[uint32]*session),
+	}
+}
+
+func (a *RUDP) GetAddr() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn != nil {
+		return a.conn.LocalAddr().String()
+	}
+	return ""
+}
+func (a *RUDP) GetConnChan() chan acceptor.Conn {
+	return a.connChan
+}
+func (a *RUDP) Stop() {
+	a.mu.Lock()
+	if !a.running {
+		a.mu.Unlock()
+		return
+	}
+	a.running = false
+	sessions := a.sessions
+	a.sessions = make(map[uint32]*session)
+	a.mu.Unlock()
+	a.conn.Close()
+	for _, s := range sessions {
+		s.kill(net.ErrClosed)
+	}
+}
+func (a *RUDP) ListenAndServe() {
+	conn, err := net.ListenPacket("udp", a.addr)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.mu.Lock()
+	a.conn = conn
+	a.running = true
+	a.mu.Unlock()
+	a.serve(conn)
+}
+func (a *RUDP) serve(conn net.PacketConn) {
+	defer a.Stop()
+	buf := make([]byte, maxDatagramSize)
+	for a.isRunning() {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if a.isRunning() {
+				logger.Log.Errorf("Failed to read UDP datagram: %s", err.Error())
+			}
+			continue
+		}
+		seg, err := decodeSegment(buf[:n])
+		if err != nil {
+			continue
+		}
+		if s := a.session(conn, seg, addr); s != nil {
+			s.input(seg)
+		}
+	}
+}
+func (a *RUDP) isRunning() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.running
+}
+
+// session returns the session seg belongs to, creating it when seg opens a
+// new one and there is room for it. Segments coming from another address
+// than the session's are dropped.
+func (a *RUDP) session(conn net.PacketConn, seg *segment, addr net.Addr) *session {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if s, ok := a.sessions[seg.conv]; ok {
+		if s.remote.String() != addr.String() {
+			return nil
+		}
+		return s
+	}
+	if seg.cmd != cmdPush || seg.sn != 0 || !a.running {
+		return nil
+	}
+	if a.config.MaxSessions > 0 && len(a.sessions) >= a.config.MaxSessions {
+		return nil
+	}
+	var s *session
+	conv := seg.conv
+	s = newSession(conv, a.config, conn.LocalAddr(), addr, func(b []byte) error {
+		_, err := conn.WriteTo(b, addr)
+		return err
+	}, func() {
+		a.mu.Lock()
+		if a.sessions[conv] == s {
+			delete(a.sessions, conv)
+		}
+		a.mu.Unlock()
+	})
+	a.sessions[conv] = s
+	// don't hold up the other sessions until the connection is taken
+	go func() {
+		select {
+		case a.connChan <- &Conn{Conn: tcp.NewConn(s), conv: conv}:
+		case <-s.die:
+		}
+	}()
+	return s
+}
+
+// Conn is a reliable UDP session using the TCP packet framing.
+type Conn struct {
+	acceptor.Conn
+	conv uint32
+}
+
+// SessionID returns the id the client chose for the session.
+func (c *Conn) SessionID() uint32 {
+	return c.conv
+}
+
+// Unwrap returns the framed connection.
+func (c *Conn) Unwrap() acceptor.Conn {
+	return c.Conn
+}
+
+// Dial opens a session to a RUDP acceptor. The returned connection is a raw
+// byte stream, wrap it with tcp.NewConn to exchange packets. The zero fields
+// of config take their default value.
+func Dial(addr string, config Config) (net.Conn, error) {
+	config = config.withDefaults()
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	var id [4]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conv := binary.BigEndian.Uint32(id[:])
+	s := newSession(conv, config, conn.LocalAddr(), raddr, func(b []byte) error {
+		_, err := conn.Write(b)
+		return err
+	}, func() {
+		conn.Close()
+	})
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, err := conn.Read(buf)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			} else if err != nil {
+				continue
+			}
+			seg, err := decodeSegment(buf[:n])
+			if err != nil || seg.conv != conv {
+				continue
+			}
+			s.input(seg)
+		}
+	}()
+	return s, nil
+}
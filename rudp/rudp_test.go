@@ -0,0 +1,293 @@
+package rudp
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/acceptortest"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentEncodeDecode(t *testing.T) {
+	t.Parallel()
+	seg := &segment{conv: 0xdeadbeef, cmd: cmdPush, sn: 7, una: 3, wnd: 128, data: []byte{0x01, 0x02}}
+	decoded, err := decodeSegment(seg.encode())
+	assert.NoError(t, err)
+	assert.Equal(t, seg, decoded)
+
+	_, err = decodeSegment([]byte{0x01})
+	assert.Equal(t, errInvalidSegment, err)
+	_, err = decodeSegment((&segment{cmd: 0x09}).encode())
+	assert.Equal(t, errInvalidSegment, err)
+}
+
+// lossyLink connects two sessions in memory, dropping and reordering datagrams.
+type lossyLink struct {
+	in      chan []byte
+	loss    *rand.Rand
+	reorder *rand.Rand
+	rate    float64
+}
+
+func newLossyPair(t *testing.T, config Config, loss float64) (*session, *session) {
+	t.Helper()
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	ab := &lossyLink{in: make(chan []byte, 4096), loss: rand.New(rand.NewSource(1)), reorder: rand.New(rand.NewSource(2)), rate: loss}
+	ba := &lossyLink{in: make(chan []byte, 4096), loss: rand.New(rand.NewSource(3)), reorder: rand.New(rand.NewSource(4)), rate: loss}
+	a := newSession(1, config, addr, addr, ab.output, nil)
+	b := newSession(1, config, addr, addr, ba.output, nil)
+	go ab.run(b)
+	go ba.run(a)
+	return a, b
+}
+
+func (l *lossyLink) output(b []byte) error {
+	if l.loss.Float64() < l.rate {
+		return nil
+	}
+	l.in <- b
+	return nil
+}
+
+func (l *lossyLink) run(to *session) {
+	var held []byte
+	for {
+		select {
+		case b := <-l.in:
+			seg, _ := decodeSegment(b)
+			// hold back every other datagram to reorder them
+			if held == nil && l.reorder.Intn(2) == 0 {
+				held = b
+				continue
+			}
+			to.input(seg)
+			if held != nil {
+				seg, _ = decodeSegment(held)
+				held = nil
+				to.input(seg)
+			}
+		case <-to.die:
+			return
+		}
+	}
+}
+
+func TestSessionLossyTransfer(t *testing.T) {
+	t.Parallel()
+	a, b := newLossyPair(t, NewDefaultConfig(), 0.2)
+	defer b.Close()
+
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(5)).Read(data)
+	go func() {
+		a.Write(data)
+		a.Close()
+	}()
+
+	b.SetReadDeadline(time.Now().Add(20 * time.Second))
+	received, err := io.ReadAll(b)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, received))
+}
+
+func TestSessionDeadline(t *testing.T) {
+	t.Parallel()
+	a, b := newLossyPair(t, NewDefaultConfig(), 0)
+	defer a.Close()
+	defer b.Close()
+
+	b.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err := b.Read(make([]byte, 1))
+	netErr, ok := err.(net.Error)
+	assert.True(t, ok && netErr.Timeout())
+}
+
+func TestSessionDeadLink(t *testing.T) {
+	t.Parallel()
+	config := NewDefaultConfig()
+	config.DeadLink = 3
+	a, b := newLossyPair(t, config, 1)
+	defer b.Close()
+
+	a.Write([]byte{0x01})
+	_, err := a.Read(make([]byte, 1))
+	assert.Equal(t, ErrSessionTimeout, err)
+}
+
+func TestSessionReceiveWindow(t *testing.T) {
+	t.Parallel()
+	config := NewDefaultConfig()
+	config.RcvWnd = 4
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	s := newSession(1, config, addr, addr, func([]byte) error { return nil }, nil)
+	defer s.kill(nil)
+
+	// a sender ignoring the window can't queue more than it
+	for sn := uint32(0); sn < 10; sn++ {
+		s.input(&segment{cmd: cmdPush, sn: sn, wnd: 128, data: make([]byte, s.mss)})
+	}
+	s.mu.Lock()
+	assert.Equal(t, uint32(4), s.rcvNxt)
+	assert.Len(t, s.rcvQueue, 4*s.mss)
+	assert.Equal(t, 0, s.rcvWnd())
+	s.mu.Unlock()
+
+	_, err := io.ReadFull(s, make([]byte, 4*s.mss))
+	assert.NoError(t, err)
+	s.input(&segment{cmd: cmdPush, sn: 4, wnd: 128, data: make([]byte, s.mss)})
+	s.mu.Lock()
+	assert.Equal(t, uint32(5), s.rcvNxt)
+	s.mu.Unlock()
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	t.Parallel()
+	config := NewDefaultConfig()
+	config.IdleTimeout = 50 * time.Millisecond
+	a, b := newLossyPair(t, config, 1)
+	defer b.Close()
+
+	// nothing was ever received
+	_, err := a.Read(make([]byte, 1))
+	assert.Equal(t, ErrSessionTimeout, err)
+}
+
+func TestSessionKeepAlive(t *testing.T) {
+	t.Parallel()
+	config := NewDefaultConfig()
+	config.IdleTimeout = 50 * time.Millisecond
+	a, b := newLossyPair(t, config, 0)
+	defer a.Close()
+	defer b.Close()
+
+	// keepalives hold idle sessions open
+	time.Sleep(200 * time.Millisecond)
+	_, err := a.Write([]byte{0x01})
+	assert.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = b.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, buf)
+}
+
+func TestNewRUDP(t *testing.T) {
+	t.Parallel()
+	a := NewRUDP("127.0.0.1:0", NewDefaultConfig())
+	assert.NotNil(t, a)
+	assert.NotNil(t, a.GetConnChan())
+	// returns nothing because not listening yet
+	assert.Equal(t, "", a.GetAddr())
+}
+
+func TestListenAndServe(t *testing.T) {
+	a := NewRUDP("127.0.0.1:0", NewDefaultConfig())
+	go a.ListenAndServe()
+	defer a.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	raw, err := Dial(a.GetAddr(), NewDefaultConfig())
+	assert.NoError(t, err)
+	client := tcp.NewConn(raw)
+	defer client.Close()
+	assert.NoError(t, client.WritePacket(acceptor.Data, []byte{0x01, 0x02}))
+
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	assert.Equal(t, raw.(*session).conv, conn.SessionID())
+	assert.Equal(t, raw.LocalAddr().String(), conn.RemoteAddr().String())
+
+	msg, err := conn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x02}, msg)
+
+	assert.NoError(t, conn.WritePacket(acceptor.Kick, nil))
+	p, err := client.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.Type(acceptor.Kick), p.Type)
+
+	conn.Close()
+	_, err = client.GetNextMessage()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+}
+
+func TestZeroConfig(t *testing.T) {
+	a := NewRUDP("127.0.0.1:0", Config{})
+	go a.ListenAndServe()
+	defer a.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	raw, err := Dial(a.GetAddr(), Config{})
+	assert.NoError(t, err)
+	client := tcp.NewConn(raw)
+	defer client.Close()
+	assert.NoError(t, client.WritePacket(acceptor.Data, []byte{0x01}))
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	defer conn.Close()
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, p.Data)
+}
+
+func TestMaxSessions(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MaxSessions = 1
+	a := NewRUDP("127.0.0.1:0", config)
+	go a.ListenAndServe()
+	defer a.Stop()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	raw1, err := Dial(a.GetAddr(), NewDefaultConfig())
+	assert.NoError(t, err)
+	client1 := tcp.NewConn(raw1)
+	defer client1.Close()
+	assert.NoError(t, client1.WritePacket(acceptor.Data, []byte{0x01}))
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	defer conn.Close()
+
+	// the second session is dropped while the first one is open
+	config = NewDefaultConfig()
+	config.DeadLink = 2
+	raw2, err := Dial(a.GetAddr(), config)
+	assert.NoError(t, err)
+	client2 := tcp.NewConn(raw2)
+	defer client2.Close()
+	assert.NoError(t, client2.WritePacket(acceptor.Data, []byte{0x02}))
+	select {
+	case <-a.GetConnChan():
+		t.Fatal("the second session was accepted")
+	case <-time.After(100 * time.Millisecond):
+	}
+	a.mu.Lock()
+	assert.Len(t, a.sessions, 1)
+	a.mu.Unlock()
+}
+
+func TestConformance(t *testing.T) {
+	acceptortest.Run(t, acceptortest.Factory{
+		New: func() acceptor.Acceptor {
+			return NewRUDP("127.0.0.1:0", NewDefaultConfig())
+		},
+		Dial: func(addr string) (acceptor.Conn, error) {
+			conn, err := Dial(addr, NewDefaultConfig())
+			if err != nil {
+				return nil, err
+			}
+			return tcp.NewConn(conn), nil
+		},
+		Stream:         true,
+		FirstPacket:    true,
+		Connectionless: true,
+	})
+}
@@ -0,0 +1,73 @@
+package rudp
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+const (
+	cmdPush uint8 = 1
+	cmdAck  uint8 = 2
+	cmdWnd  uint8 = 3
+	cmdFin  uint8 = 4
+)
+
+// headerSize is the size of a segment header:
+//
+//	conv uint32 | cmd uint8 | sn uint32 | una uint32 | wnd uint16
+const headerSize = 15
+
+var errInvalidSegment = errors.New("invalid segment")
+
+type segment struct {
+	conv uint32
+	cmd  uint8
+	sn   uint32
+	una  uint32
+	wnd  uint16
+	data []byte
+
+	// sender state
+	sentAt   time.Time
+	resendAt time.Time
+	rto      time.Duration
+	xmit     int
+	fastack  int
+}
+
+func (s *segment) encode() []byte {
+	b := make([]byte, headerSize+len(s.data))
+	binary.BigEndian.PutUint32(b[0:], s.conv)
+	b[4] = s.cmd
+	binary.BigEndian.PutUint32(b[5:], s.sn)
+	binary.BigEndian.PutUint32(b[9:], s.una)
+	binary.BigEndian.PutUint16(b[13:], s.wnd)
+	copy(b[headerSize:], s.data)
+	return b
+}
+
+func decodeSegment(b []byte) (*segment, error) {
+	if len(b) < headerSize {
+		return nil, errInvalidSegment
+	}
+	s := &segment{
+		conv: binary.BigEndian.Uint32(b[0:]),
+		cmd:  b[4],
+		sn:   binary.BigEndian.Uint32(b[5:]),
+		una:  binary.BigEndian.Uint32(b[9:]),
+		wnd:  binary.BigEndian.Uint16(b[13:]),
+	}
+	if s.cmd < cmdPush || s.cmd > cmdFin {
+		return nil, errInvalidSegment
+	}
+	if len(b) > headerSize {
+		s.data = append([]byte(nil), b[headerSize:]...)
+	}
+	return s, nil
+}
+
+// before reports whether sequence number a comes before b.
+func before(a, b uint32) bool {
+	return int32(a-b) < 0
+}
@@ -0,0 +1,542 @@
+package rudp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	maxRTO = 60 * time.Second
+	// lingerTimeout bounds how long a closed session waits for its pending
+	// segments and the fin of the remote side.
+	lingerTimeout = 5 * time.Second
+)
+
+var ErrSessionTimeout = errors.New("rudp: session timed out")
+
+type Config struct {
+	// SndWnd and RcvWnd are the send and receive windows, in segments.
+	SndWnd int
+	RcvWnd int
+	// MTU is the maximum size of a datagram.
+	MTU int
+	// Interval is the period of the update loop retransmitting lost segments.
+	Interval time.Duration
+	// NoDelay lowers the minimum retransmission timeout and slows down its backoff.
+	NoDelay bool
+	// Resend retransmits a segment as soon as that many later segments were
+	// acked, zero disables fast retransmission.
+	Resend int
+	// DeadLink times the session out once a segment was sent that many times.
+	DeadLink int
+	// IdleTimeout times the session out once nothing was received for that
+	// long. Both sides send a keepalive when they were silent for a quarter
+	// of it.
+	IdleTimeout time.Duration
+	// MaxSessions bounds the number of sessions of an acceptor, segments
+	// opening new sessions are dropped once it is reached. Zero means no
+	// limit.
+	MaxSessions int
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		SndWnd:      128,
+		RcvWnd:      128,
+		MTU:         1400,
+		Interval:    10 * time.Millisecond,
+		NoDelay:     true,
+		Resend:      2,
+		DeadLink:    20,
+		IdleTimeout: 30 * time.Second,
+		MaxSessions: 4096,
+	}
+}
+
+// withDefaults replaces the fields of config a session can't run with by
+// their default value.
+func (config Config) withDefaults() Config {
+	defaults := NewDefaultConfig()
+	if config.SndWnd <= 0 {
+		config.SndWnd = defaults.SndWnd
+	}
+	if config.RcvWnd <= 0 {
+		config.RcvWnd = defaults.RcvWnd
+	}
+	if config.MTU <= headerSize {
+		config.MTU = defaults.MTU
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaults.Interval
+	}
+	if config.DeadLink <= 0 {
+		config.DeadLink = defaults.DeadLink
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaults.IdleTimeout
+	}
+	return config
+}
+
+// session is one end of a reliable, ordered byte stream carried over
+// datagrams. Every datagram holds exactly one segment.
+type session struct {
+	conv    uint32
+	config  Config
+	mss     int
+	local   net.Addr
+	remote  net.Addr
+	output  func([]byte) error
+	onClose func()
+
+	mu            sync.Mutex
+	sndNxt        uint32
+	sndUna        uint32
+	sndQueue      []*segment
+	sndBuf        []*segment
+	rcvNxt        uint32
+	rcvBuf        map[uint32]*segment
+	rcvQueue      []byte
+	rmtWnd        int
+	lastWnd       int
+	acks          []uint32
+	srtt          time.Duration
+	rttvar        time.Duration
+	rto           time.Duration
+	lastRecv      time.Time
+	lastSent      time.Time
+	closed        bool
+	remoteFin     bool
+	dead          bool
+	err           error
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	readEvent  chan struct{}
+	writeEvent chan struct{}
+	die        chan struct{}
+}
+
+func newSession(conv uint32, config Config, local, remote net.Addr, output func([]byte) error, onClose func()) *session {
+	s := &session{
+		conv:       conv,
+		config:     config,
+		mss:        config.MTU - headerSize,
+		local:      local,
+		remote:     remote,
+		output:     output,
+		onClose:    onClose,
+		rcvBuf:     make(map[uint32]*segment),
+		rmtWnd:     config.RcvWnd,
+		lastWnd:    config.RcvWnd,
+		readEvent:  make(chan struct{}, 1),
+		writeEvent: make(chan struct{}, 1),
+		die:        make(chan struct{}),
+		lastRecv:   time.Now(),
+		lastSent:   time.Now(),
+	}
+	s.rto = s.minRTO()
+	go s.update()
+	return s
+}
+
+func (s *session) Read(b []byte) (int, error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return 0, net.ErrClosed
+		}
+		if len(s.rcvQueue) > 0 {
+			n := copy(b, s.rcvQueue)
+			s.rcvQueue = s.rcvQueue[n:]
+			if len(s.rcvQueue) == 0 {
+				s.rcvQueue = nil
+			}
+			s.flushLocked()
+			s.mu.Unlock()
+			return n, nil
+		}
+		if s.remoteFin {
+			s.mu.Unlock()
+			return 0, io.EOF
+		}
+		if s.err != nil {
+			s.mu.Unlock()
+			return 0, s.err
+		}
+		deadline := s.readDeadline
+		s.mu.Unlock()
+		if err := s.wait(s.readEvent, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+func (s *session) Write(b []byte) (int, error) {
+	n := 0
+	for {
+		s.mu.Lock()
+		if s.closed || s.remoteFin {
+			s.mu.Unlock()
+			return n, net.ErrClosed
+		}
+		if s.err != nil {
+			s.mu.Unlock()
+			return n, s.err
+		}
+		if !s.writeDeadline.IsZero() && !time.Now().Before(s.writeDeadline) {
+			s.mu.Unlock()
+			return n, os.ErrDeadlineExceeded
+		}
+		for len(b) > 0 && len(s.sndQueue)+len(s.sndBuf) < 2*s.config.SndWnd {
+			size := len(b)
+			if size > s.mss {
+				size = s.mss
+			}
+			s.sndQueue = append(s.sndQueue, &segment{cmd: cmdPush, data: append([]byte(nil), b[:size]...)})
+			b = b[size:]
+			n += size
+		}
+		s.flushLocked()
+		deadline := s.writeDeadline
+		s.mu.Unlock()
+		if len(b) == 0 {
+			return n, nil
+		}
+		if err := s.wait(s.writeEvent, deadline); err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close sends a fin after the pending data. The session stays alive in the
+// background until the fin is acked and the remote side closed too.
+func (s *session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return net.ErrClosed
+	}
+	s.closed = true
+	notify(s.readEvent)
+	notify(s.writeEvent)
+	if s.dead {
+		return nil
+	}
+	s.sndQueue = append(s.sndQueue, &segment{cmd: cmdFin})
+	s.flushLocked()
+	time.AfterFunc(lingerTimeout, func() {
+		s.kill(nil)
+	})
+	return nil
+}
+func (s *session) LocalAddr() net.Addr {
+	return s.local
+}
+func (s *session) RemoteAddr() net.Addr {
+	return s.remote
+}
+func (s *session) SetDeadline(t time.Time) error {
+	if err := s.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return s.SetWriteDeadline(t)
+}
+func (s *session) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.readDeadline = t
+	s.mu.Unlock()
+	notify(s.readEvent)
+	return nil
+}
+func (s *session) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.writeDeadline = t
+	s.mu.Unlock()
+	notify(s.writeEvent)
+	return nil
+}
+
+func (s *session) wait(event chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-event:
+	case <-s.die:
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+// input handles a segment received from the remote side.
+func (s *session) input(seg *segment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dead {
+		return
+	}
+	s.lastRecv = time.Now()
+	s.rmtWnd = int(seg.wnd)
+	s.processUna(seg.una)
+	switch seg.cmd {
+	case cmdAck:
+		s.processAck(seg.sn)
+	case cmdPush, cmdFin:
+		if before(seg.sn, s.rcvNxt+uint32(s.rcvFree())) {
+			s.acks = append(s.acks, seg.sn)
+			if _, ok := s.rcvBuf[seg.sn]; !ok && !before(seg.sn, s.rcvNxt) {
+				s.rcvBuf[seg.sn] = seg
+			}
+			s.deliver()
+		} else {
+			// the segment doesn't fit in what the application left room for,
+			// it is dropped and the sender told the window again
+			s.send(&segment{cmd: cmdWnd})
+		}
+	}
+	s.flushLocked()
+	if s.closed && s.remoteFin && len(s.sndQueue) == 0 && len(s.sndBuf) == 0 {
+		s.killLocked(nil)
+	}
+}
+func (s *session) processUna(una uint32) {
+	i := 0
+	for i < len(s.sndBuf) && before(s.sndBuf[i].sn, una) {
+		i++
+	}
+	if i > 0 {
+		s.sndBuf = s.sndBuf[i:]
+		notify(s.writeEvent)
+	}
+	if before(s.sndUna, una) {
+		s.sndUna = una
+	}
+}
+
+// processAck removes the acked segment from sndBuf. Earlier segments which
+// were sent before it are counted as skipped for fast retransmission.
+func (s *session) processAck(sn uint32) {
+	for i, seg := range s.sndBuf {
+		if seg.sn != sn {
+			continue
+		}
+		if seg.xmit == 1 {
+			s.updateRTT(time.Since(seg.sentAt))
+		}
+		s.sndBuf = append(s.sndBuf[:i], s.sndBuf[i+1:]...)
+		for _, skipped := range s.sndBuf[:i] {
+			if skipped.sentAt.Before(seg.sentAt) {
+				skipped.fastack++
+			}
+		}
+		notify(s.writeEvent)
+		return
+	}
+}
+func (s *session) updateRTT(rtt time.Duration) {
+	if s.srtt == 0 {
+		s.srtt = rtt
+		s.rttvar = rtt / 2
+	} else {
+		delta := rtt - s.srtt
+		if delta < 0 {
+			delta = -delta
+		}
+		s.rttvar = (3*s.rttvar + delta) / 4
+		s.srtt = (7*s.srtt + rtt) / 8
+	}
+	variance := 4 * s.rttvar
+	if variance < s.config.Interval {
+		variance = s.config.Interval
+	}
+	s.rto = s.srtt + variance
+	if lo := s.minRTO(); s.rto < lo {
+		s.rto = lo
+	} else if s.rto > maxRTO {
+		s.rto = maxRTO
+	}
+}
+func (s *session) minRTO() time.Duration {
+	if s.config.NoDelay {
+		return 30 * time.Millisecond
+	}
+	return 100 * time.Millisecond
+}
+
+// deliver moves the in-order segments of rcvBuf to rcvQueue.
+func (s *session) deliver() {
+	for {
+		seg, ok := s.rcvBuf[s.rcvNxt]
+		if !ok {
+			return
+		}
+		delete(s.rcvBuf, s.rcvNxt)
+		s.rcvNxt++
+		if seg.cmd == cmdFin {
+			s.remoteFin = true
+		} else {
+			s.rcvQueue = append(s.rcvQueue, seg.data...)
+		}
+		notify(s.readEvent)
+	}
+}
+
+// rcvFree is the number of segments following rcvNxt the receive side can
+// hold, the window minus the segments waiting for the application.
+func (s *session) rcvFree() int {
+	queued := (len(s.rcvQueue) + s.mss - 1) / s.mss
+	if queued > s.config.RcvWnd {
+		return 0
+	}
+	return s.config.RcvWnd - queued
+}
+
+// rcvWnd is the number of segments the receive side can still take.
+func (s *session) rcvWnd() int {
+	wnd := s.rcvFree() - len(s.rcvBuf)
+	if wnd < 0 {
+		return 0
+	}
+	return wnd
+}
+
+// flushLocked sends pending acks and new segments and retransmits lost ones.
+func (s *session) flushLocked() {
+	if s.dead {
+		return
+	}
+	for _, sn := range s.acks {
+		s.send(&segment{cmd: cmdAck, sn: sn})
+	}
+	s.acks = s.acks[:0]
+	if s.lastWnd == 0 && s.rcvWnd() > 0 {
+		s.send(&segment{cmd: cmdWnd})
+	}
+
+	cwnd := s.config.SndWnd
+	if s.rmtWnd < cwnd {
+		cwnd = s.rmtWnd
+	}
+	if cwnd == 0 && len(s.sndBuf) == 0 {
+		// probe a closed remote window with a single segment
+		cwnd = 1
+	}
+	for len(s.sndQueue) > 0 && len(s.sndBuf) < cwnd {
+		seg := s.sndQueue[0]
+		s.sndQueue = s.sndQueue[1:]
+		seg.sn = s.sndNxt
+		s.sndNxt++
+		s.sndBuf = append(s.sndBuf, seg)
+	}
+
+	now := time.Now()
+	for _, seg := range s.sndBuf {
+		switch {
+		case seg.xmit == 0:
+			seg.rto = s.rto
+		case !now.Before(seg.resendAt):
+			if s.config.NoDelay {
+				seg.rto += seg.rto / 2
+			} else {
+				seg.rto *= 2
+			}
+			if seg.rto > maxRTO {
+				seg.rto = maxRTO
+			}
+		case s.config.Resend > 0 && seg.fastack >= s.config.Resend:
+			seg.fastack = 0
+		default:
+			continue
+		}
+		seg.xmit++
+		seg.sentAt = now
+		seg.resendAt = now.Add(seg.rto)
+		s.send(seg)
+		// a probe of a closed window isn't lost, the idle timeout tells
+		// whether the remote side is still there
+		if s.config.DeadLink > 0 && seg.xmit >= s.config.DeadLink && s.rmtWnd > 0 {
+			s.killLocked(ErrSessionTimeout)
+			return
+		}
+	}
+}
+func (s *session) send(seg *segment) {
+	seg.conv = s.conv
+	seg.una = s.rcvNxt
+	s.lastWnd = s.rcvWnd()
+	seg.wnd = uint16(s.lastWnd)
+	s.lastSent = time.Now()
+	s.output(seg.encode())
+}
+func (s *session) update() {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.mu.Lock()
+			s.flushLocked()
+			s.keepAliveLocked(now)
+			s.mu.Unlock()
+		case <-s.die:
+			return
+		}
+	}
+}
+
+// keepAliveLocked times the session out when the remote side was silent for
+// IdleTimeout, and sends a keepalive when this side was silent for a quarter
+// of it.
+func (s *session) keepAliveLocked(now time.Time) {
+	if s.dead {
+		return
+	}
+	if now.Sub(s.lastRecv) > s.config.IdleTimeout {
+		s.killLocked(ErrSessionTimeout)
+		return
+	}
+	if now.Sub(s.lastSent) >= s.config.IdleTimeout/4 {
+		s.send(&segment{cmd: cmdWnd})
+	}
+}
+func (s *session) kill(err error) {
+	s.mu.Lock()
+	s.killLocked(err)
+	s.mu.Unlock()
+}
+func (s *session) killLocked(err error) {
+	if s.dead {
+		return
+	}
+	s.dead = true
+	if s.err == nil {
+		if err == nil {
+			err = net.ErrClosed
+		}
+		s.err = err
+	}
+	close(s.die)
+	if s.onClose != nil {
+		go s.onClose()
+	}
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,187 @@
+package sse
+
+import (
+	"errors"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/internal/httpsession"
+	"io"
+	"net"
+	"time"
+)
+
+var (
+	ErrSessionTimeout = errors.New("sse: session timed out")
+	errResumeGap      = errors.New("sse: events to resume from were discarded")
+	errUpstreamFull   = errors.New("sse: upstream buffer full")
+)
+
+// event is a downstream packet waiting to be sent or kept for resuming.
+type event struct {
+	id   uint64
+	data []byte
+}
+
+// session joins the upstream bytes of POST bodies and the downstream events
+// of an SSE stream into a byte stream. Every complete packet written becomes
+// one event. The last ReplayBuffer events are kept so a stream reconnecting
+// with Last-Event-ID gets the events it missed.
+type session struct {
+	*httpsession.Session
+	id     string
+	config Config
+
+	pending    []byte
+	events     []event
+	base       uint64
+	lastID     uint64
+	sentID     uint64
+	streamID   uint64
+	streams    int
+	lastActive time.Time
+}
+
+func newSession(id string, config Config, local, remote net.Addr, onClose func()) *session {
+	return &session{
+		Session:    httpsession.New(local, remote, onClose),
+		id:         id,
+		config:     config,
+		lastActive: time.Now(),
+	}
+}
+
+// Write turns every complete packet of b into an event, the bytes of an
+// incomplete one are kept until the rest is written. It blocks while
+// ReplayBuffer events wait to be sent, since older ones would otherwise be
+// discarded before the client got them.
+func (s *session) Write(b []byte) (int, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	for {
+		if s.Closed || s.WriteClosed {
+			return 0, net.ErrClosed
+		}
+		if s.Err != nil {
+			return 0, s.Err
+		}
+		if s.lastID-s.sentID < uint64(s.config.ReplayBuffer) {
+			break
+		}
+		if err := s.WaitLocked(s.WriteDeadline, nil); err != nil {
+			return 0, err
+		}
+	}
+	s.pending = append(s.pending, b...)
+	for len(s.pending) >= acceptor.HeadLength {
+		size, _, err := acceptor.ParseHeader(s.pending[:acceptor.HeadLength])
+		if err != nil {
+			s.pending = nil
+			return 0, err
+		}
+		if len(s.pending) < acceptor.HeadLength+size {
+			break
+		}
+		s.lastID++
+		s.events = append(s.events, event{id: s.lastID, data: s.pending[:acceptor.HeadLength+size]})
+		s.pending = s.pending[acceptor.HeadLength+size:]
+		if len(s.events) > s.config.ReplayBuffer {
+			s.base = s.events[0].id
+			s.events = s.events[1:]
+		}
+	}
+	if len(s.pending) == 0 {
+		s.pending = nil
+	} else {
+		s.pending = append([]byte(nil), s.pending...)
+	}
+	s.SignalLocked()
+	return len(b), nil
+}
+
+// post appends the body of an upstream POST. A post is refused while
+// MaxUpstreamSize bytes are waiting to be read.
+func (s *session) post(body []byte) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.lastActive = time.Now()
+	if s.Dead || s.RemoteClosed {
+		return net.ErrClosed
+	}
+	if buffered := s.Upstream.Len(); buffered > 0 && buffered+len(body) > s.config.MaxUpstreamSize {
+		return errUpstreamFull
+	}
+	s.Upstream.Write(body)
+	s.SignalLocked()
+	return nil
+}
+
+// stream sends the events following lastID through send until cancel is
+// closed, a newer stream takes over or the downstream ends. ping is called
+// when nothing was sent for KeepAlive.
+func (s *session) stream(lastID uint64, cancel <-chan struct{}, send func([]event) error, ping func() error) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	if lastID < s.base || lastID > s.lastID {
+		return errResumeGap
+	}
+	s.streamID++
+	id := s.streamID
+	s.streams++
+	s.sentID = lastID
+	defer func() {
+		s.streams--
+		s.lastActive = time.Now()
+	}()
+	s.SignalLocked()
+	cursor := lastID
+	for {
+		if s.streamID != id {
+			return nil
+		}
+		if cursor < s.base {
+			return errResumeGap
+		}
+		if s.lastID > cursor {
+			events := append([]event(nil), s.events[len(s.events)-int(s.lastID-cursor):]...)
+			s.Mu.Unlock()
+			err := send(events)
+			s.Mu.Lock()
+			if err != nil {
+				return err
+			}
+			cursor = events[len(events)-1].id
+			if s.streamID == id {
+				s.sentID = cursor
+				s.SignalLocked()
+			}
+			continue
+		}
+		if s.WriteClosed || s.Dead {
+			if !s.Dead {
+				s.RemoteClosed = true
+				s.KillLocked(io.EOF)
+			}
+			return net.ErrClosed
+		}
+		select {
+		case <-cancel:
+			return nil
+		default:
+		}
+		if err := s.WaitLocked(time.Now().Add(s.config.KeepAlive), cancel); err != nil {
+			s.Mu.Unlock()
+			err = ping()
+			s.Mu.Lock()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// idle reports whether the session had no stream attached and no POST for
+// longer than the session timeout.
+func (s *session) idle(now time.Time) bool {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return s.streams == 0 && now.Sub(s.lastActive) > s.config.SessionTimeout
+}
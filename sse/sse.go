@@ -0,0 +1,375 @@
+// Package sse is an acceptor sending downstream packets over a Server-Sent
+// Events stream and receiving upstream packets in HTTP POST bodies, a
+// lighter fallback than long-polling for clients that can't use WebSocket.
+//
+// A GET to the endpoint without a session id opens a session. The stream
+// starts with a "session" event whose data is {"sid": "..."}, followed by
+// one event per packet with the base64 encoded packet, header included, as
+// data and an increasing id. A client reconnects with GET ?sid=<id> and the
+// Last-Event-ID header, or the lastEventId query parameter, to get the
+// events it missed. When the server ends the session the stream sends a
+// "close" event.
+//
+// Upstream packets are POSTed to ?sid=<id> as raw bytes in the TCP packet
+// framing. Bodies are applied in the order they arrive, so clients wait for
+// a POST to complete before sending the next one.
+package sse
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/internal/httpsession"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	logger "github.com/gotechbook/gotechbook-framework-logger"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var _ acceptor.Acceptor = (*SSE)(nil)
+var _ acceptor.Conn = (*Conn)(nil)
+
+type Config struct {
+	// Path is the endpoint of the sessions.
+	Path string
+	// KeepAlive is the interval of the comments sent on an idle stream to
+	// keep proxies from closing it.
+	KeepAlive time.Duration
+	// SessionTimeout closes sessions without a stream for that long.
+	SessionTimeout time.Duration
+	// MaxPostSize limits the body of an upstream POST.
+	MaxPostSize int64
+	// ReplayBuffer is the number of events kept for resuming a stream.
+	ReplayBuffer int
+	// MaxUpstreamSize is the number of upstream bytes buffered until the
+	// application reads them, further POSTs get 429 and can be retried.
+	MaxUpstreamSize int
+	// MaxSessions bounds the number of sessions, new ones get 503 once it is
+	// reached. Zero means no limit.
+	MaxSessions int
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		Path:            "/sse",
+		KeepAlive:       15 * time.Second,
+		SessionTimeout:  60 * time.Second,
+		MaxPostSize:     1 << 20,
+		ReplayBuffer:    256,
+		MaxUpstreamSize: 1 << 20,
+		MaxSessions:     4096,
+	}
+}
+
+// withDefaults replaces the fields of config the acceptor can't run with by
+// their default value.
+func (config Config) withDefaults() Config {
+	defaults := NewDefaultConfig()
+	if config.Path == "" {
+		config.Path = defaults.Path
+	}
+	if config.KeepAlive <= 0 {
+		config.KeepAlive = defaults.KeepAlive
+	}
+	if config.SessionTimeout <= 0 {
+		config.SessionTimeout = defaults.SessionTimeout
+	}
+	if config.MaxPostSize <= 0 {
+		config.MaxPostSize = defaults.MaxPostSize
+	}
+	if config.ReplayBuffer <= 0 {
+		config.ReplayBuffer = defaults.ReplayBuffer
+	}
+	if config.MaxUpstreamSize <= 0 {
+		config.MaxUpstreamSize = defaults.MaxUpstreamSize
+	}
+	return config
+}
+
+type SSE struct {
+	addr     string
+	config   Config
+	connChan chan acceptor.Conn
+	listener net.Listener
+	certFile string
+	keyFile  string
+	mu       sync.Mutex
+	sessions map[string]*session
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSSE listens on addr, the zero fields of config take their default value.
+func NewSSE(addr string, config Config, certs ...string) *SSE {
+	keyFile := ""
+	certFile := ""
+	if len(certs) != 2 && len(certs) != 0 {
+		panic(acceptor.ErrInvalidCertificates)
+	} else if len(certs) == 2 {
+		certFile = certs[0]
+		keyFile = certs[1]
+	}
+	return &SSE{
+		addr:     addr,
+		config:   config.withDefaults(),
+		connChan: make(chan acceptor.Conn),
+		certFile: certFile,
+		keyFile:  keyFile,
+		sessions: make(map[string]*session),
+		stopChan: make(chan struct{}),
+	}
+}
+
+func (a *SSE) GetAddr() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.listener != nil {
+		return a.listener.Addr().String()
+	}
+	return ""
+}
+func (a *SSE) GetConnChan() chan acceptor.Conn {
+	return a.connChan
+}
+func (a *SSE) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stopChan)
+		a.mu.Lock()
+		listener := a.listener
+		sessions := a.sessions
+		a.sessions = make(map[string]*session)
+		a.mu.Unlock()
+		if listener != nil {
+			if err := listener.Close(); err != nil {
+				logger.Log.Errorf("Failed to stop: %s", err.Error())
+			}
+		}
+		for _, s := range sessions {
+			s.Kill(acceptor.ErrConnectionClosed)
+		}
+	})
+}
+func (a *SSE) ListenAndServe() {
+	if a.hasTLSCertificates() {
+		a.ListenAndServeTLS(a.certFile, a.keyFile)
+		return
+	}
+	listener, err := net.Listen("tcp", a.addr)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.serve(listener)
+}
+func (a *SSE) ListenAndServeTLS(cert, key string) {
+	crt, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		logger.Log.Fatalf("Failed to load x509: %s", err.Error())
+	}
+	tlsCfg := &tls.Config{Certificates: []tls.Certificate{crt}}
+	listener, err := tls.Listen("tcp", a.addr, tlsCfg)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.serve(listener)
+}
+func (a *SSE) serve(listener net.Listener) {
+	a.mu.Lock()
+	a.listener = listener
+	a.mu.Unlock()
+	defer a.Stop()
+	go a.expire()
+	http.Serve(listener, a)
+}
+func (a *SSE) hasTLSCertificates() bool {
+	return a.certFile != "" && a.keyFile != ""
+}
+
+// expire closes the sessions abandoned by their client.
+func (a *SSE) expire() {
+	ticker := time.NewTicker(a.config.SessionTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			a.mu.Lock()
+			var idle []*session
+			for _, s := range a.sessions {
+				if s.idle(now) {
+					idle = append(idle, s)
+				}
+			}
+			a.mu.Unlock()
+			for _, s := range idle {
+				s.Kill(ErrSessionTimeout)
+			}
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+
+func (a *SSE) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != a.config.Path {
+		http.NotFound(w, r)
+		return
+	}
+	sid := r.URL.Query().Get("sid")
+	if r.Method == http.MethodGet && sid == "" {
+		if s := a.open(w, r); s != nil {
+			a.stream(w, r, s, 0)
+		}
+		return
+	}
+	a.mu.Lock()
+	s, ok := a.sessions[sid]
+	a.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("lastEventId")
+		}
+		var id uint64
+		if lastID != "" {
+			var err error
+			if id, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+				http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+				return
+			}
+		}
+		a.stream(w, r, s, id)
+	case http.MethodPost:
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, a.config.MaxPostSize))
+		if err != nil {
+			http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		switch err := s.post(body); {
+		case errors.Is(err, errUpstreamFull):
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		case err != nil:
+			http.Error(w, "session closed", http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// open creates a session and hands its connection to the application. It
+// answers the request itself and returns nil when no session can be opened.
+func (a *SSE) open(w http.ResponseWriter, r *http.Request) *session {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		logger.Log.Errorf("Failed to generate session id: %s", err.Error())
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil
+	}
+	sid := hex.EncodeToString(id)
+	var s *session
+	s = newSession(sid, a.config, httpsession.LocalAddr(r), httpsession.RemoteAddr(r), func() {
+		a.mu.Lock()
+		if a.sessions[sid] == s {
+			delete(a.sessions, sid)
+		}
+		a.mu.Unlock()
+	})
+	a.mu.Lock()
+	if a.config.MaxSessions > 0 && len(a.sessions) >= a.config.MaxSessions {
+		a.mu.Unlock()
+		http.Error(w, "too many sessions", http.StatusServiceUnavailable)
+		return nil
+	}
+	a.sessions[sid] = s
+	a.mu.Unlock()
+	go func() {
+		select {
+		case a.connChan <- &Conn{Conn: tcp.NewConn(s), sid: sid}:
+		case <-s.Die:
+		}
+	}()
+	return s
+}
+
+// stream attaches the response as the event stream of s, starting after the
+// event lastID.
+func (a *SSE) stream(w http.ResponseWriter, r *http.Request, s *session, lastID uint64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	bw := bufio.NewWriter(w)
+	started := false
+	flush := func() error {
+		started = true
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	if lastID == 0 {
+		data, _ := json.Marshal(map[string]string{"sid": s.id})
+		bw.WriteString("event: session\ndata: ")
+		bw.Write(data)
+		bw.WriteString("\n\n")
+		flush()
+	}
+	err := s.stream(lastID, r.Context().Done(), func(events []event) error {
+		for _, e := range events {
+			bw.WriteString("id: ")
+			bw.WriteString(strconv.FormatUint(e.id, 10))
+			bw.WriteString("\ndata: ")
+			bw.WriteString(base64.StdEncoding.EncodeToString(e.data))
+			bw.WriteString("\n\n")
+		}
+		return flush()
+	}, func() error {
+		bw.WriteString(": ping\n\n")
+		return flush()
+	})
+	if errors.Is(err, errResumeGap) && !started {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if errors.Is(err, net.ErrClosed) {
+		bw.WriteString("event: close\ndata: \n\n")
+	}
+	flush()
+}
+
+// Conn is a SSE session using the TCP packet framing.
+type Conn struct {
+	acceptor.Conn
+	sid string
+}
+
+// SessionID returns the id of the session.
+func (c *Conn) SessionID() string {
+	return c.sid
+}
+
+// Unwrap returns the framed connection.
+func (c *Conn) Unwrap() acceptor.Conn {
+	return c.Conn
+}
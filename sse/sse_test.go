@@ -0,0 +1,290 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var sseAcceptorTables = []struct {
+	name     string
+	addr     string
+	certs    []string
+	panicErr error
+}{
+	{"test_1", "127.0.0.1:0", []string{"../fixtures/server.crt", "../fixtures/server.key"}, nil},
+	{"test_2", "127.0.0.1:0", []string{}, nil},
+	{"test_3", "127.0.0.1:0", []string{"wqd"}, acceptor.ErrInvalidCertificates},
+	{"test_4", "127.0.0.1:0", []string{"wqd", "wqdqwd", "wqdqdqwd"}, acceptor.ErrInvalidCertificates},
+}
+
+func TestNewSSE(t *testing.T) {
+	t.Parallel()
+	for _, table := range sseAcceptorTables {
+		t.Run(table.name, func(t *testing.T) {
+			if table.panicErr != nil {
+				assert.PanicsWithValue(t, table.panicErr, func() {
+					NewSSE(table.addr, NewDefaultConfig(), table.certs...)
+				})
+				return
+			}
+			a := NewSSE(table.addr, NewDefaultConfig(), table.certs...)
+			assert.NotNil(t, a.GetConnChan())
+			assert.Equal(t, len(table.certs) == 2, a.hasTLSCertificates())
+			// returns nothing because not listening yet
+			assert.Equal(t, "", a.GetAddr())
+		})
+	}
+}
+
+type testEvent struct {
+	name string
+	id   string
+	data string
+}
+
+type testStream struct {
+	res *http.Response
+	r   *bufio.Reader
+}
+
+func (s *testStream) next(t *testing.T) testEvent {
+	t.Helper()
+	var e testEvent
+	for {
+		line, err := s.r.ReadString('\n')
+		assert.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if e != (testEvent{}) {
+				return e
+			}
+		case strings.HasPrefix(line, "event: "):
+			e.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+func (s *testStream) packet(t *testing.T) (string, []byte) {
+	t.Helper()
+	e := s.next(t)
+	b, err := base64.StdEncoding.DecodeString(e.data)
+	assert.NoError(t, err)
+	return e.id, b
+}
+
+func listen(t *testing.T, config Config) (*SSE, string) {
+	t.Helper()
+	a := NewSSE("127.0.0.1:0", config)
+	go a.ListenAndServe()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	return a, fmt.Sprintf("http://%s%s", a.GetAddr(), a.config.Path)
+}
+
+func get(t *testing.T, url, lastEventID string) *testStream {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	return &testStream{res: res, r: bufio.NewReader(res.Body)}
+}
+
+func open(t *testing.T, url string) (*testStream, string) {
+	t.Helper()
+	stream := get(t, url, "")
+	assert.Equal(t, "text/event-stream", stream.res.Header.Get("Content-Type"))
+	e := stream.next(t)
+	assert.Equal(t, "session", e.name)
+	var body struct {
+		Sid string `json:"sid"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(e.data), &body))
+	return stream, body.Sid
+}
+
+func TestListenAndServe(t *testing.T) {
+	a, url := listen(t, NewDefaultConfig())
+	defer a.Stop()
+	stream, sid := open(t, url)
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	assert.Equal(t, sid, conn.SessionID())
+
+	res, err := http.Post(url+"?sid="+sid, "application/octet-stream", bytes.NewReader([]byte{0x04, 0x00, 0x00, 0x01, 0x01, 0x03, 0x00}))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res, err = http.Post(url+"?sid="+sid, "application/octet-stream", bytes.NewReader([]byte{0x00, 0x00}))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, p.Data)
+	p, err = conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.Type(acceptor.Heartbeat), p.Type)
+
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x05}))
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x06}))
+	id, b := stream.packet(t)
+	assert.Equal(t, "1", id)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x05}, b)
+	stream.res.Body.Close()
+
+	// a reconnecting stream resumes after the last event it got
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x07}))
+	stream = get(t, url+"?sid="+sid, "1")
+	defer stream.res.Body.Close()
+	for i, expected := range []byte{0x06, 0x07} {
+		id, b = stream.packet(t)
+		assert.Equal(t, fmt.Sprint(i+2), id)
+		assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, expected}, b)
+	}
+
+	res, err = http.Get(url + "?sid=unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestResumeGap(t *testing.T) {
+	config := NewDefaultConfig()
+	config.ReplayBuffer = 2
+	a, url := listen(t, config)
+	defer a.Stop()
+	stream, sid := open(t, url)
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+
+	for i := 1; i <= 4; i++ {
+		assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{byte(i)}))
+		id, _ := stream.packet(t)
+		assert.Equal(t, fmt.Sprint(i), id)
+	}
+	stream.res.Body.Close()
+
+	stream = get(t, url+"?sid="+sid, "1")
+	stream.res.Body.Close()
+	assert.Equal(t, http.StatusGone, stream.res.StatusCode)
+	stream = get(t, url+"?sid="+sid, "3")
+	defer stream.res.Body.Close()
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x05}))
+	id, _ := stream.packet(t)
+	assert.Equal(t, "4", id)
+}
+
+func TestSendKick(t *testing.T) {
+	a, url := listen(t, NewDefaultConfig())
+	defer a.Stop()
+	stream, _ := open(t, url)
+	defer stream.res.Body.Close()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+
+	done := make(chan error)
+	go func() {
+		done <- acceptor.SendKick(conn, &acceptor.KickReason{Code: acceptor.KickCodeServerShutdown})
+	}()
+	_, b := stream.packet(t)
+	assert.Equal(t, byte(acceptor.Kick), b[0])
+	assert.Equal(t, "close", stream.next(t).name)
+	assert.NoError(t, <-done)
+}
+
+func TestSessionTimeout(t *testing.T) {
+	config := NewDefaultConfig()
+	config.SessionTimeout = 50 * time.Millisecond
+	a, url := listen(t, config)
+	defer a.Stop()
+	stream, sid := open(t, url)
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	stream.res.Body.Close()
+
+	_, err := conn.GetNextMessage()
+	assert.Equal(t, ErrSessionTimeout, err)
+	res, err := http.Get(url + "?sid=" + sid)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestZeroConfig(t *testing.T) {
+	a, url := listen(t, Config{})
+	defer a.Stop()
+	expected := NewDefaultConfig()
+	expected.MaxSessions = 0
+	assert.Equal(t, expected, a.config)
+	stream, _ := open(t, url)
+	defer stream.res.Body.Close()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+
+	assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x01}))
+	id, b := stream.packet(t)
+	assert.Equal(t, "1", id)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x01}, b)
+}
+
+func TestMaxSessions(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MaxSessions = 1
+	a, url := listen(t, config)
+	defer a.Stop()
+	stream, _ := open(t, url)
+	defer stream.res.Body.Close()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+
+	res, err := http.Get(url)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	// ending a session makes room for another one
+	conn.Close()
+	utils.ShouldEventuallyReturn(t, func() int {
+		res, err := http.Get(url)
+		assert.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}, http.StatusOK, 10*time.Millisecond, 100*time.Millisecond)
+}
+
+func TestMaxUpstreamSize(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MaxUpstreamSize = 8
+	a, url := listen(t, config)
+	defer a.Stop()
+	stream, sid := open(t, url)
+	defer stream.res.Body.Close()
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+
+	post := func(body []byte) int {
+		res, err := http.Post(url+"?sid="+sid, "application/octet-stream", bytes.NewReader(body))
+		assert.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	assert.Equal(t, http.StatusNoContent, post([]byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x02}))
+	assert.Equal(t, http.StatusTooManyRequests, post([]byte{0x04, 0x00, 0x00, 0x01, 0x03}))
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x02}, p.Data)
+	// the refused post can be retried once the application read
+	assert.Equal(t, http.StatusNoContent, post([]byte{0x04, 0x00, 0x00, 0x01, 0x03}))
+	p, err = conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x03}, p.Data)
+}
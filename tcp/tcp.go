@@ -1,24 +1,31 @@
 package tcp
 
 import (
+	"context"
 	"crypto/tls"
 	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/proxyproto"
 	logger "github.com/gotechbook/gotechbook-framework-logger"
 	"io"
-	"io/ioutil"
 	"net"
+	"sync"
+	"time"
 )
 
 var _ acceptor.Acceptor = (*TCP)(nil)
 var _ acceptor.Conn = (*tcpConn)(nil)
 
+var codec = acceptor.NewPacketCodec()
+
 type TCP struct {
 	addr     string
 	connChan chan acceptor.Conn
+	mu       sync.Mutex
 	listener net.Listener
 	running  bool
 	certFile string
 	keyFile  string
+	proxy    *proxyproto.Config
 }
 
 func NewTCP(addr string, certs ...string) *TCP {
@@ -40,7 +47,15 @@ func NewTCP(addr string, certs ...string) *TCP {
 	}
 }
 
+// UseProxyProtocol makes the acceptor read the PROXY protocol header of the
+// connections from the proxies of config, before TLS, so RemoteAddr reports
+// the client. It must be called before ListenAndServe.
+func (a *TCP) UseProxyProtocol(config proxyproto.Config) {
+	a.proxy = &config
+}
 func (a *TCP) GetAddr() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	if a.listener != nil {
 		return a.listener.Addr().String()
 	}
@@ -50,6 +65,8 @@ func (a *TCP) GetConnChan() chan acceptor.Conn {
 	return a.connChan
 }
 func (a *TCP) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	a.running = false
 	a.listener.Close()
 }
@@ -58,12 +75,7 @@ func (a *TCP) ListenAndServe() {
 		a.ListenAndServeTLS(a.certFile, a.keyFile)
 		return
 	}
-	listener, err := net.Listen("tcp", a.addr)
-	if err != nil {
-		logger.Log.Fatalf("Failed to listen: %s", err.Error())
-	}
-	a.listener = listener
-	a.running = true
+	a.setListener(a.listen())
 	a.serve()
 }
 func (a *TCP) ListenAndServeTLS(cert, key string) {
@@ -73,23 +85,41 @@ func (a *TCP) ListenAndServeTLS(cert, key string) {
 	}
 	tlsCfg := &tls.Config{Certificates: []tls.Certificate{crt}}
 
-	listener, err := tls.Listen("tcp", a.addr, tlsCfg)
+	a.setListener(tls.NewListener(a.listen(), tlsCfg))
+	a.serve()
+}
+func (a *TCP) listen() net.Listener {
+	listener, err := net.Listen("tcp", a.addr)
 	if err != nil {
 		logger.Log.Fatalf("Failed to listen: %s", err.Error())
 	}
+	if a.proxy != nil {
+		return proxyproto.NewListener(listener, *a.proxy)
+	}
+	return listener
+}
+func (a *TCP) setListener(listener net.Listener) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	a.listener = listener
 	a.running = true
-	a.serve()
+}
+func (a *TCP) isRunning() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.running
 }
 func (a *TCP) hasTLSCertificates() bool {
 	return a.certFile != "" && a.keyFile != ""
 }
 func (a *TCP) serve() {
 	defer a.Stop()
-	for a.running {
+	for a.isRunning() {
 		conn, err := a.listener.Accept()
 		if err != nil {
-			logger.Log.Errorf("Failed to accept TCP connection: %s", err.Error())
+			if a.isRunning() {
+				logger.Log.Errorf("Failed to accept TCP connection: %s", err.Error())
+			}
 			continue
 		}
 		a.connChan <- &tcpConn{
@@ -98,28 +128,158 @@ func (a *TCP) serve() {
 	}
 }
 
+// NewConn wraps a stream connection with the packet framing used by TCP.
+func NewConn(conn net.Conn) acceptor.Conn {
+	return &tcpConn{Conn: conn}
+}
+
 type tcpConn struct {
 	net.Conn
+	buf []byte
+
+	// mu guards readDeadline, which GetNextMessageContext restores once
+	// cancelled while SetReadDeadline may be called from another goroutine.
+	mu           sync.Mutex
+	readDeadline time.Time
 }
 
+// aLongTimeAgo is used as read deadline to unblock a pending Read.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// readSize is the smallest buffer allocated to read a frame.
+const readSize = 4096
+
 func (t *tcpConn) GetNextMessage() (b []byte, err error) {
-	header, err := ioutil.ReadAll(io.LimitReader(t.Conn, acceptor.HeadLength))
+	b, _, err = t.readFrame()
+	return b, err
+}
+func (t *tcpConn) ReadPacket() (*acceptor.Packet, error) {
+	b, typ, err := t.readFrame()
 	if err != nil {
 		return nil, err
 	}
-	if len(header) == 0 {
-		return nil, acceptor.ErrConnectionClosed
-	}
-	msgSize, _, err := acceptor.ParseHeader(header)
+	return &acceptor.Packet{Type: typ, Length: len(b) - acceptor.HeadLength, Data: b[acceptor.HeadLength:]}, nil
+}
+func (t *tcpConn) WritePacket(typ acceptor.Type, data []byte) error {
+	b, err := codec.Encode(typ, data)
 	if err != nil {
+		return err
+	}
+	_, err = t.Conn.Write(b)
+	return err
+}
+
+// GetNextMessageContext works like GetNextMessage but returns ctx.Err() as soon
+// as ctx is done. Bytes of a partially read message are kept, so the next call
+// continues from where the cancelled one stopped.
+func (t *tcpConn) GetNextMessageContext(ctx context.Context) (b []byte, err error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	msgData, err := ioutil.ReadAll(io.LimitReader(t.Conn, int64(msgSize)))
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			t.mu.Lock()
+			t.Conn.SetReadDeadline(aLongTimeAgo)
+			t.mu.Unlock()
+		case <-stop:
+		}
+	}()
+	b, err = t.GetNextMessage()
+	close(stop)
+	<-done
+	if ctx.Err() != nil {
+		t.mu.Lock()
+		t.Conn.SetReadDeadline(t.readDeadline)
+		t.mu.Unlock()
+		if err != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return b, err
+}
+
+// ProxyHeader returns the PROXY protocol header the connection started with,
+// nil if it didn't come from a trusted proxy.
+func (t *tcpConn) ProxyHeader() (*proxyproto.Header, error) {
+	if c, ok := proxyproto.FromConn(t.Conn); ok {
+		return c.ProxyHeader()
+	}
+	return nil, nil
+}
+
+// CloseWrite shuts down the writing side of the connection, flushing what
+// was written so far.
+func (t *tcpConn) CloseWrite() error {
+	if cw, ok := t.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+func (t *tcpConn) SetDeadline(d time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.readDeadline = d
+	return t.Conn.SetDeadline(d)
+}
+func (t *tcpConn) SetReadDeadline(d time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.readDeadline = d
+	return t.Conn.SetReadDeadline(d)
+}
+
+// readFrame reads one header+body frame from the connection.
+func (t *tcpConn) readFrame() ([]byte, acceptor.Type, error) {
+	if err := t.fill(acceptor.HeadLength); err != nil {
+		if err != io.EOF {
+			return nil, 0, err
+		}
+		defer t.reset()
+		if len(t.buf) == 0 {
+			return nil, 0, acceptor.ErrConnectionClosed
+		}
+		return nil, 0, acceptor.ErrInvalidHeader
+	}
+	msgSize, typ, err := acceptor.ParseHeader(t.buf[:acceptor.HeadLength])
 	if err != nil {
-		return nil, err
+		t.reset()
+		return nil, 0, err
+	}
+	if err := t.fill(acceptor.HeadLength + msgSize); err != nil {
+		if err != io.EOF {
+			return nil, 0, err
+		}
+		t.reset()
+		return nil, 0, acceptor.ErrReceivedMsgSmallerThanExpected
 	}
-	if len(msgData) < msgSize {
-		return nil, acceptor.ErrReceivedMsgSmallerThanExpected
+	b := t.buf
+	t.buf = nil
+	return b, typ, nil
+}
+
+// fill reads from the connection until buf holds n bytes. The buffer grows
+// with the bytes received, not with the size a header announces.
+func (t *tcpConn) fill(n int) error {
+	for len(t.buf) < n {
+		if len(t.buf) == cap(t.buf) {
+			size := min(max(2*cap(t.buf), readSize), n)
+			buf := make([]byte, len(t.buf), size)
+			copy(buf, t.buf)
+			t.buf = buf
+		}
+		m, err := t.Conn.Read(t.buf[len(t.buf):min(n, cap(t.buf))])
+		t.buf = t.buf[:len(t.buf)+m]
+		// a reader may return the last bytes along with io.EOF
+		if err != nil && len(t.buf) < n {
+			return err
+		}
 	}
-	return append(header, msgData...), nil
+	return nil
+}
+func (t *tcpConn) reset() {
+	t.buf = t.buf[:0]
 }
@@ -1,8 +1,13 @@
 package tcp
 
 import (
+	"context"
+	"crypto/tls"
 	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/acceptortest"
+	"github.com/gotechbook/gotechbook-framework-acceptor/proxyproto"
 	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"io"
 	"net"
 	"testing"
 	"time"
@@ -269,7 +274,8 @@ func TestGetNextMessageInParts(t *testing.T) {
 
 	go func() {
 		time.Sleep(200 * time.Millisecond)
-		_, err = conn.Write(part2)
+		_, err := conn.Write(part2)
+		assert.NoError(t, err)
 	}()
 
 	msg, err := playerConn.GetNextMessage()
@@ -277,3 +283,290 @@ func TestGetNextMessageInParts(t *testing.T) {
 	assert.Equal(t, msg, append(part1, part2...))
 
 }
+
+// chunkedConn is a connection reading data at most chunk bytes at a time.
+// With eof, io.EOF comes along with the last bytes.
+type chunkedConn struct {
+	net.Conn
+	data  []byte
+	chunk int
+	eof   bool
+}
+
+func (c *chunkedConn) Read(b []byte) (int, error) {
+	if len(c.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b[:min(len(b), c.chunk)], c.data)
+	c.data = c.data[n:]
+	if c.eof && len(c.data) == 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestGetNextMessageDataWithEOF(t *testing.T) {
+	conn := NewConn(&chunkedConn{data: []byte{0x03, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x01, 0x01}, chunk: 4, eof: true})
+	msg, err := conn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x03, 0x00, 0x00, 0x00}, msg)
+	msg, err = conn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x01}, msg)
+	_, err = conn.GetNextMessage()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+}
+
+func TestGetNextMessageAnnouncedSize(t *testing.T) {
+	// a header announcing the largest packet doesn't allocate it before the
+	// bytes arrive
+	conn := NewConn(&chunkedConn{data: []byte{0x04, 0xff, 0xff, 0xff, 0x01}, chunk: 5}).(*tcpConn)
+	_, err := conn.GetNextMessage()
+	assert.Equal(t, acceptor.ErrReceivedMsgSmallerThanExpected, err)
+	assert.LessOrEqual(t, cap(conn.buf), readSize)
+}
+
+func FuzzGetNextMessage(f *testing.F) {
+	f.Add([]byte{0x02, 0x00, 0x00, 0x03, 0x01, 0x01, 0x02}, uint8(1))
+	f.Add([]byte{0x02, 0x00, 0x00, 0x02, 0x01}, uint8(4))
+	f.Add([]byte{0x01, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x01, 0x01, 0x03, 0x00}, uint8(3))
+	f.Add([]byte{0x04, 0x00, 0x00, 0x01, 0x01, 0x09, 0x00, 0x00, 0x00}, uint8(255))
+	f.Fuzz(func(t *testing.T, data []byte, chunk uint8) {
+		if chunk == 0 {
+			chunk = 1
+		}
+		conn := NewConn(&chunkedConn{data: data, chunk: int(chunk)})
+		// the connection reads the packets Decode finds, however the bytes
+		// are split
+		packets, decodeErr := codec.Decode(data)
+		var read []byte
+		for _, p := range packets {
+			msg, err := conn.GetNextMessage()
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, byte(p.Type), msg[0])
+			assert.Equal(t, p.Data, msg[acceptor.HeadLength:])
+			read = append(read, msg...)
+		}
+		_, err := conn.GetNextMessage()
+		rest := data[len(read):]
+		switch {
+		case decodeErr != nil:
+			assert.Equal(t, decodeErr, err)
+		case len(rest) == 0:
+			assert.Equal(t, acceptor.ErrConnectionClosed, err)
+		case len(rest) < acceptor.HeadLength:
+			assert.Equal(t, acceptor.ErrInvalidHeader, err)
+		default:
+			assert.Equal(t, acceptor.ErrReceivedMsgSmallerThanExpected, err)
+		}
+	})
+}
+
+func TestGetNextMessageContextCancel(t *testing.T) {
+	a := NewTCP("0.0.0.0:0")
+	go a.ListenAndServe()
+	defer a.Stop()
+	c := a.GetConnChan()
+	// should be able to connect within 100 milliseconds
+	var conn net.Conn
+	var err error
+	utils.ShouldEventuallyReturn(t, func() error {
+		conn, err = net.Dial("tcp", a.GetAddr())
+		return err
+	}, nil, 10*time.Millisecond, 100*time.Millisecond)
+	defer conn.Close()
+
+	playerConn := utils.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(acceptor.Conn)
+	part1 := []byte{0x02, 0x00}
+	part2 := []byte{0x00, 0x02, 0x01, 0x02}
+	_, err = conn.Write(part1)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = playerConn.GetNextMessageContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	_, err = conn.Write(part2)
+	assert.NoError(t, err)
+
+	msg, err := playerConn.GetNextMessageContext(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, append(part1, part2...), msg)
+}
+
+func TestGetNextMessageContextSetReadDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := NewConn(server)
+	defer conn.Close()
+
+	// setting the deadline while a cancelled read restores it doesn't race
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Hour)))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		_, err := conn.GetNextMessageContext(ctx)
+		cancel()
+		assert.Equal(t, context.DeadlineExceeded, err)
+	}
+	<-done
+}
+
+func TestReadAndWritePacket(t *testing.T) {
+	a := NewTCP("0.0.0.0:0")
+	go a.ListenAndServe()
+	defer a.Stop()
+	c := a.GetConnChan()
+	// should be able to connect within 100 milliseconds
+	var conn net.Conn
+	var err error
+	utils.ShouldEventuallyReturn(t, func() error {
+		conn, err = net.Dial("tcp", a.GetAddr())
+		return err
+	}, nil, 10*time.Millisecond, 100*time.Millisecond)
+	defer conn.Close()
+
+	playerConn := utils.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(acceptor.Conn)
+	_, err = conn.Write([]byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x02})
+	assert.NoError(t, err)
+
+	p, err := playerConn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, &acceptor.Packet{Type: acceptor.Data, Length: 2, Data: []byte{0x01, 0x02}}, p)
+
+	err = playerConn.WritePacket(acceptor.Kick, []byte{0x03})
+	assert.NoError(t, err)
+	b := make([]byte, 5)
+	_, err = io.ReadFull(conn, b)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x05, 0x00, 0x00, 0x01, 0x03}, b)
+
+	err = playerConn.WritePacket(0x00, nil)
+	assert.ErrorIs(t, err, acceptor.ErrWrongPacketType)
+}
+
+func TestSendKick(t *testing.T) {
+	a := NewTCP("0.0.0.0:0")
+	go a.ListenAndServe()
+	defer a.Stop()
+	c := a.GetConnChan()
+	// should be able to connect within 100 milliseconds
+	var conn net.Conn
+	var err error
+	utils.ShouldEventuallyReturn(t, func() error {
+		conn, err = net.Dial("tcp", a.GetAddr())
+		return err
+	}, nil, 10*time.Millisecond, 100*time.Millisecond)
+	defer conn.Close()
+
+	playerConn := utils.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(acceptor.Conn)
+	// unread data on the server side must not prevent the kick from arriving
+	_, err = conn.Write([]byte{0x04, 0x00, 0x00, 0x01, 0x01})
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- acceptor.SendKick(playerConn, &acceptor.KickReason{Code: acceptor.KickCodeServerShutdown, Message: "bye"})
+	}()
+
+	b, err := io.ReadAll(conn)
+	assert.NoError(t, err)
+	size, typ, err := acceptor.ParseHeader(b[:acceptor.HeadLength])
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.Type(acceptor.Kick), typ)
+	reason, err := acceptor.ParseKick(b[acceptor.HeadLength : acceptor.HeadLength+size])
+	assert.NoError(t, err)
+	assert.Equal(t, &acceptor.KickReason{Code: acceptor.KickCodeServerShutdown, Message: "bye"}, reason)
+
+	conn.Close()
+	assert.NoError(t, <-done)
+}
+
+func TestProxyProtocol(t *testing.T) {
+	tables := []struct {
+		name    string
+		trusted string
+		remote  string
+	}{
+		{"test_1", "127.0.0.0/8", "203.0.113.7:4242"},
+		{"test_2", "10.0.0.0/8", "127.0.0.1"},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			config := proxyproto.NewDefaultConfig()
+			config.TrustedCIDRs, _ = proxyproto.ParseCIDRs(table.trusted)
+			a := NewTCP("127.0.0.1:0", "../fixtures/server.crt", "../fixtures/server.key")
+			a.UseProxyProtocol(config)
+			defer a.Stop()
+			go a.ListenAndServe()
+
+			var raw net.Conn
+			var err error
+			utils.ShouldEventuallyReturn(t, func() error {
+				raw, err = net.Dial("tcp", a.GetAddr())
+				return err
+			}, nil, 10*time.Millisecond, 100*time.Millisecond)
+			defer raw.Close()
+			header, _ := (&proxyproto.Header{
+				Version:     2,
+				Command:     proxyproto.Proxy,
+				Source:      &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 4242},
+				Destination: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 443},
+				TLVs:        []proxyproto.TLV{{Type: proxyproto.TypeUniqueID, Value: []byte("req-1")}},
+			}).Format()
+			_, err = raw.Write(header)
+			assert.NoError(t, err)
+			// the header comes before the TLS handshake
+			client := tls.Client(raw, &tls.Config{InsecureSkipVerify: true})
+			go client.Write([]byte{0x04, 0x00, 0x00, 0x01, 0x01})
+
+			conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(acceptor.Conn)
+			defer conn.Close()
+			b, err := conn.GetNextMessage()
+			proxied := conn.(interface {
+				ProxyHeader() (*proxyproto.Header, error)
+			})
+			if table.trusted == "127.0.0.0/8" {
+				assert.NoError(t, err)
+				assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x01}, b)
+				assert.Equal(t, table.remote, conn.RemoteAddr().String())
+				h, err := proxied.ProxyHeader()
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("req-1"), h.UniqueID())
+			} else {
+				// the header of an untrusted source breaks the handshake
+				assert.Error(t, err)
+				assert.Equal(t, table.remote, conn.RemoteAddr().(*net.TCPAddr).IP.String())
+				h, err := proxied.ProxyHeader()
+				assert.NoError(t, err)
+				assert.Nil(t, h)
+			}
+		})
+	}
+}
+
+// TestConformance runs without TLS, whose handshake waits for the server to read.
+func TestConformance(t *testing.T) {
+	acceptortest.Run(t, acceptortest.Factory{
+		New: func() acceptor.Acceptor {
+			return NewTCP("127.0.0.1:0")
+		},
+		Dial: func(addr string) (acceptor.Conn, error) {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				return nil, err
+			}
+			return NewConn(conn), nil
+		},
+		Stream: true,
+	})
+}
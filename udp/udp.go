@@ -0,0 +1,376 @@
+// Package udp is an unreliable datagram acceptor for fire-and-forget traffic
+// such as telemetry and position updates.
+//
+// A single socket is demultiplexed by remote address into virtual
+// connections. Every datagram carries exactly one framed packet, datagrams
+// are neither acknowledged nor retransmitted and may arrive out of order.
+// Peers that stay silent longer than the idle timeout are expired.
+package udp
+
+import (
+	"context"
+	"errors"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	logger "github.com/gotechbook/gotechbook-framework-logger"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const maxDatagramSize = 65535
+
+var ErrIdleTimeout = errors.New("udp: peer idle timeout")
+
+var _ acceptor.Acceptor = (*UDP)(nil)
+var _ acceptor.Conn = (*Conn)(nil)
+
+var codec = acceptor.NewPacketCodec()
+
+type Config struct {
+	// IdleTimeout expires a peer once no datagram was received from it for
+	// that long.
+	IdleTimeout time.Duration
+	// MaxPeers bounds the number of peers, datagrams from new peers are
+	// dropped once it is reached.
+	MaxPeers int
+	// QueueSize is the number of datagrams buffered per peer, further
+	// datagrams are dropped until the application reads.
+	QueueSize int
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		IdleTimeout: 30 * time.Second,
+		MaxPeers:    4096,
+		QueueSize:   64,
+	}
+}
+
+// withDefaults replaces the fields of config the acceptor can't run with by
+// their default value. Any source address opens a peer, so their number and
+// lifetime must be bounded.
+func (config Config) withDefaults() Config {
+	defaults := NewDefaultConfig()
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaults.IdleTimeout
+	}
+	if config.MaxPeers <= 0 {
+		config.MaxPeers = defaults.MaxPeers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	return config
+}
+
+type UDP struct {
+	addr     string
+	config   Config
+	connChan chan acceptor.Conn
+	conn     net.PacketConn
+	running  bool
+	mu       sync.Mutex
+	peers    map[string]*Conn
+	stopChan chan struct{}
+}
+
+// NewUDP listens on addr, the zero fields of config take their default value.
+func NewUDP(addr string, config Config) *UDP {
+	return &UDP{
+		addr:     addr,
+		config:   config.withDefaults(),
+		connChan: make(chan acceptor.Conn),
+		running:  false,
+		peers:    make(map[string]*Conn),
+		stopChan: make(chan struct{}),
+	}
+}
+
+func (a *UDP) GetAddr() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn != nil {
+		return a.conn.LocalAddr().String()
+	}
+	return ""
+}
+func (a *UDP) GetConnChan() chan acceptor.Conn {
+	return a.connChan
+}
+func (a *UDP) Stop() {
+	a.mu.Lock()
+	if !a.running {
+		a.mu.Unlock()
+		return
+	}
+	a.running = false
+	peers := a.peers
+	a.peers = make(map[string]*Conn)
+	a.mu.Unlock()
+	close(a.stopChan)
+	a.conn.Close()
+	for _, c := range peers {
+		c.kill(acceptor.ErrConnectionClosed)
+	}
+}
+func (a *UDP) ListenAndServe() {
+	conn, err := net.ListenPacket("udp", a.addr)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.mu.Lock()
+	a.conn = conn
+	a.running = true
+	a.mu.Unlock()
+	go a.expire()
+	a.serve()
+}
+func (a *UDP) serve() {
+	defer a.Stop()
+	buf := make([]byte, maxDatagramSize)
+	for a.isRunning() {
+		n, addr, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			if a.isRunning() {
+				logger.Log.Errorf("Failed to read UDP datagram: %s", err.Error())
+			}
+			continue
+		}
+		if !validDatagram(buf[:n]) {
+			continue
+		}
+		if c := a.peer(addr); c != nil {
+			c.input(append([]byte(nil), buf[:n]...))
+		}
+	}
+}
+func (a *UDP) isRunning() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.running
+}
+
+// validDatagram reports whether b holds exactly one framed packet.
+func validDatagram(b []byte) bool {
+	if len(b) < acceptor.HeadLength {
+		return false
+	}
+	size, _, err := acceptor.ParseHeader(b[:acceptor.HeadLength])
+	return err == nil && size == len(b)-acceptor.HeadLength
+}
+
+// peer returns the connection of addr, creating it when there is room for a
+// new peer.
+func (a *UDP) peer(addr net.Addr) *Conn {
+	key := addr.String()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if c, ok := a.peers[key]; ok {
+		return c
+	}
+	if !a.running || len(a.peers) >= a.config.MaxPeers {
+		return nil
+	}
+	c := &Conn{
+		acceptor: a,
+		remote:   addr,
+		in:       make(chan []byte, a.config.QueueSize),
+		die:      make(chan struct{}),
+	}
+	c.touch()
+	a.peers[key] = c
+	// don't hold up the other peers until the connection is taken
+	go func() {
+		select {
+		case a.connChan <- c:
+		case <-c.die:
+		}
+	}()
+	return c
+}
+func (a *UDP) remove(c *Conn) {
+	a.mu.Lock()
+	if a.peers[c.remote.String()] == c {
+		delete(a.peers, c.remote.String())
+	}
+	a.mu.Unlock()
+}
+
+// expire periodically kills the peers that were idle for too long.
+func (a *UDP) expire() {
+	ticker := time.NewTicker(a.config.IdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-a.stopChan:
+			return
+		}
+		deadline := time.Now().Add(-a.config.IdleTimeout).UnixNano()
+		var idle []*Conn
+		a.mu.Lock()
+		for key, c := range a.peers {
+			if atomic.LoadInt64(&c.lastSeen) < deadline {
+				delete(a.peers, key)
+				idle = append(idle, c)
+			}
+		}
+		a.mu.Unlock()
+		for _, c := range idle {
+			c.kill(ErrIdleTimeout)
+		}
+	}
+}
+
+// Conn is a virtual connection to one remote address. Reads return one
+// datagram at a time and writes send one datagram each.
+type Conn struct {
+	acceptor *UDP
+	remote   net.Addr
+	in       chan []byte
+	lastSeen int64
+
+	mu            sync.Mutex
+	err           error
+	readDeadline  time.Time
+	writeDeadline time.Time
+	die           chan struct{}
+}
+
+func (c *Conn) touch() {
+	atomic.StoreInt64(&c.lastSeen, time.Now().UnixNano())
+}
+
+// input queues a datagram received from the peer, dropping it when the
+// queue is full.
+func (c *Conn) input(b []byte) {
+	c.touch()
+	select {
+	case c.in <- b:
+	default:
+	}
+}
+func (c *Conn) kill(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.die)
+}
+
+// GetNextMessage returns the next datagram, header included.
+func (c *Conn) GetNextMessage() (b []byte, err error) {
+	return c.GetNextMessageContext(context.Background())
+}
+func (c *Conn) GetNextMessageContext(ctx context.Context) (b []byte, err error) {
+	// datagrams received before the connection died are still delivered
+	select {
+	case b := <-c.in:
+		return b, nil
+	default:
+	}
+	c.mu.Lock()
+	deadline := c.readDeadline
+	c.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return nil, os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case b := <-c.in:
+		return b, nil
+	case <-c.die:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timeout:
+		return nil, os.ErrDeadlineExceeded
+	}
+}
+func (c *Conn) ReadPacket() (*acceptor.Packet, error) {
+	b, err := c.GetNextMessage()
+	if err != nil {
+		return nil, err
+	}
+	size, typ, err := acceptor.ParseHeader(b[:acceptor.HeadLength])
+	if err != nil {
+		return nil, err
+	}
+	return &acceptor.Packet{Type: typ, Length: size, Data: b[acceptor.HeadLength:]}, nil
+}
+func (c *Conn) WritePacket(typ acceptor.Type, data []byte) error {
+	b, err := codec.Encode(typ, data)
+	if err != nil {
+		return err
+	}
+	_, err = c.Write(b)
+	return err
+}
+
+// Read reads the next datagram into b. Like a UDP socket, the part of the
+// datagram that doesn't fit into b is discarded.
+func (c *Conn) Read(b []byte) (int, error) {
+	msg, err := c.GetNextMessage()
+	if err != nil {
+		return 0, err
+	}
+	return copy(b, msg), nil
+}
+
+// Write sends b as a single datagram.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	err, deadline := c.err, c.writeDeadline
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return c.acceptor.conn.WriteTo(b, c.remote)
+}
+
+// Close forgets the peer. Its next datagram opens a new connection.
+func (c *Conn) Close() error {
+	c.acceptor.remove(c)
+	c.kill(acceptor.ErrConnectionClosed)
+	return nil
+}
+func (c *Conn) LocalAddr() net.Addr {
+	return c.acceptor.conn.LocalAddr()
+}
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return nil
+}
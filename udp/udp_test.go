@@ -0,0 +1,180 @@
+package udp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var validDatagramTables = []struct {
+	name  string
+	data  []byte
+	valid bool
+}{
+	{"test_1", []byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x02}, true},
+	{"test_2", []byte{0x03, 0x00, 0x00, 0x00}, true},
+	{"test_3", []byte{0x04, 0x00, 0x00, 0x03, 0x01, 0x02}, false},
+	{"test_4", []byte{0x04, 0x00, 0x00, 0x01, 0x01, 0x02}, false},
+	{"test_5", []byte{0x09, 0x00, 0x00, 0x00}, false},
+	{"test_6", []byte{0x04, 0x00}, false},
+}
+
+func TestValidDatagram(t *testing.T) {
+	t.Parallel()
+	for _, table := range validDatagramTables {
+		t.Run(table.name, func(t *testing.T) {
+			assert.Equal(t, table.valid, validDatagram(table.data))
+		})
+	}
+}
+
+func TestNewUDP(t *testing.T) {
+	t.Parallel()
+	a := NewUDP("127.0.0.1:0", NewDefaultConfig())
+	assert.NotNil(t, a)
+	assert.NotNil(t, a.GetConnChan())
+	// returns nothing because not listening yet
+	assert.Equal(t, "", a.GetAddr())
+}
+
+func listen(t *testing.T, config Config) *UDP {
+	t.Helper()
+	a := NewUDP("127.0.0.1:0", config)
+	go a.ListenAndServe()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	return a
+}
+
+func dial(t *testing.T, a *UDP) net.Conn {
+	t.Helper()
+	client, err := net.Dial("udp", a.GetAddr())
+	assert.NoError(t, err)
+	return client
+}
+
+func TestListenAndServe(t *testing.T) {
+	a := listen(t, NewDefaultConfig())
+	defer a.Stop()
+
+	client1 := dial(t, a)
+	defer client1.Close()
+	client2 := dial(t, a)
+	defer client2.Close()
+
+	// garbage is dropped without opening a connection
+	client1.Write([]byte{0x09, 0x00})
+	client1.Write([]byte{0x04, 0x00, 0x00, 0x01, 0x01})
+	client1.Write([]byte{0x04, 0x00, 0x00, 0x01, 0x02})
+	conn1 := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	assert.Equal(t, client1.LocalAddr().String(), conn1.RemoteAddr().String())
+
+	client2.Write([]byte{0x03, 0x00, 0x00, 0x00})
+	conn2 := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	assert.Equal(t, client2.LocalAddr().String(), conn2.RemoteAddr().String())
+
+	msg, err := conn1.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x01}, msg)
+	p, err := conn1.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.Type(acceptor.Data), p.Type)
+	assert.Equal(t, []byte{0x02}, p.Data)
+	p, err = conn2.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.Type(acceptor.Heartbeat), p.Type)
+
+	assert.NoError(t, conn2.WritePacket(acceptor.Data, []byte{0x05}))
+	buf := make([]byte, maxDatagramSize)
+	client2.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := client2.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x05}, buf[:n])
+
+	conn1.Close()
+	_, err = conn1.GetNextMessage()
+	assert.Equal(t, acceptor.ErrConnectionClosed, err)
+	// the next datagram opens a new connection
+	client1.Write([]byte{0x03, 0x00, 0x00, 0x00})
+	conn3 := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	assert.NotEqual(t, conn1, conn3)
+}
+
+func TestReadDeadline(t *testing.T) {
+	a := listen(t, NewDefaultConfig())
+	defer a.Stop()
+	client := dial(t, a)
+	defer client.Close()
+
+	client.Write([]byte{0x03, 0x00, 0x00, 0x00})
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	_, err := conn.GetNextMessage()
+	assert.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = conn.GetNextMessage()
+	netErr, ok := err.(net.Error)
+	assert.True(t, ok && netErr.Timeout())
+}
+
+func TestMaxPeers(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MaxPeers = 1
+	a := listen(t, config)
+	defer a.Stop()
+
+	client1 := dial(t, a)
+	defer client1.Close()
+	client1.Write([]byte{0x03, 0x00, 0x00, 0x00})
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+
+	client2 := dial(t, a)
+	defer client2.Close()
+	client2.Write([]byte{0x03, 0x00, 0x00, 0x00})
+	select {
+	case <-a.GetConnChan():
+		t.Fatal("peer over the limit was accepted")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// closing a peer makes room for another one
+	conn.Close()
+	client2.Write([]byte{0x03, 0x00, 0x00, 0x00})
+	conn = utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	assert.Equal(t, client2.LocalAddr().String(), conn.RemoteAddr().String())
+}
+
+func TestIdleTimeout(t *testing.T) {
+	config := NewDefaultConfig()
+	config.IdleTimeout = 50 * time.Millisecond
+	a := listen(t, config)
+	defer a.Stop()
+	client := dial(t, a)
+	defer client.Close()
+
+	client.Write([]byte{0x03, 0x00, 0x00, 0x00})
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	_, err := conn.GetNextMessage()
+	assert.NoError(t, err)
+	_, err = conn.GetNextMessage()
+	assert.Equal(t, ErrIdleTimeout, err)
+}
+
+func TestZeroConfig(t *testing.T) {
+	a := listen(t, Config{})
+	defer a.Stop()
+	assert.Equal(t, NewDefaultConfig(), a.config)
+	client := dial(t, a)
+	defer client.Close()
+
+	client.Write([]byte{0x04, 0x00, 0x00, 0x01, 0x01})
+	conn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	p, err := conn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, p.Data)
+}
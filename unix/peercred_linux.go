@@ -0,0 +1,31 @@
+//go:build linux
+
+package unix
+
+import (
+	"net"
+	"syscall"
+)
+
+func peerCredentials(conn net.Conn) (*Credentials, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, ErrPeerCredUnsupported
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var ucred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		ucred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+	return &Credentials{PID: ucred.Pid, UID: ucred.Uid, GID: ucred.Gid}, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package unix
+
+import "net"
+
+func peerCredentials(conn net.Conn) (*Credentials, error) {
+	return nil, ErrPeerCredUnsupported
+}
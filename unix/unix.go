@@ -0,0 +1,214 @@
+package unix
+
+import (
+	"errors"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	logger "github.com/gotechbook/gotechbook-framework-logger"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var _ acceptor.Acceptor = (*Unix)(nil)
+var _ acceptor.Conn = (*Conn)(nil)
+
+var (
+	ErrNotSocket           = errors.New("path exists and is not a socket")
+	ErrAddrInUse           = errors.New("socket is in use by another process")
+	ErrPeerCredUnsupported = errors.New("peer credentials are not supported on this platform")
+)
+
+type Config struct {
+	// Mode is applied to the socket file when not zero.
+	Mode os.FileMode
+	// UID and GID own the socket file, -1 leaves them unchanged.
+	UID int
+	GID int
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		UID: -1,
+		GID: -1,
+	}
+}
+
+type Unix struct {
+	path     string
+	config   Config
+	connChan chan acceptor.Conn
+	mu       sync.Mutex
+	listener net.Listener
+	running  bool
+}
+
+func NewUnix(path string, config Config) *Unix {
+	return &Unix{
+		path:     path,
+		config:   config,
+		connChan: make(chan acceptor.Conn),
+		running:  false,
+	}
+}
+
+func (a *Unix) GetAddr() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.listener != nil {
+		return a.listener.Addr().String()
+	}
+	return ""
+}
+func (a *Unix) GetConnChan() chan acceptor.Conn {
+	return a.connChan
+}
+func (a *Unix) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.running = false
+	a.listener.Close()
+}
+func (a *Unix) ListenAndServe() {
+	if err := removeStale(a.path); err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	listener, err := a.listen()
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.setListener(listener)
+	a.serve()
+}
+
+// listen creates the socket. When the config restricts it, the socket is
+// created in a directory only the process can enter and moved into place
+// once its mode and owner are set, so no one can connect in between.
+func (a *Unix) listen() (net.Listener, error) {
+	if a.config.Mode == 0 && a.config.UID == -1 && a.config.GID == -1 {
+		return net.Listen("unix", a.path)
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(a.path), "."+filepath.Base(a.path)+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// the socket file is removed by Stop, under its final name
+	listener.SetUnlinkOnClose(false)
+	if err := a.setPermissions(tmp); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &renamedListener{UnixListener: listener, path: a.path}, nil
+}
+func (a *Unix) setPermissions(path string) error {
+	if a.config.Mode != 0 {
+		if err := os.Chmod(path, a.config.Mode); err != nil {
+			return err
+		}
+	}
+	if a.config.UID != -1 || a.config.GID != -1 {
+		return os.Chown(path, a.config.UID, a.config.GID)
+	}
+	return nil
+}
+func (a *Unix) setListener(listener net.Listener) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.listener = listener
+	a.running = true
+}
+func (a *Unix) isRunning() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.running
+}
+func (a *Unix) serve() {
+	defer a.Stop()
+	for a.isRunning() {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			if a.isRunning() {
+				logger.Log.Errorf("Failed to accept unix connection: %s", err.Error())
+			}
+			continue
+		}
+		c := &Conn{Conn: tcp.NewConn(conn)}
+		c.cred, c.credErr = peerCredentials(conn)
+		a.connChan <- c
+	}
+}
+
+// renamedListener is a listener whose socket file was moved to path after
+// it was created.
+type renamedListener struct {
+	*net.UnixListener
+	path string
+	once sync.Once
+}
+
+func (l *renamedListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+func (l *renamedListener) Close() error {
+	err := l.UnixListener.Close()
+	l.once.Do(func() {
+		os.Remove(l.path)
+	})
+	return err
+}
+
+// removeStale removes a socket file left behind by a previous process that
+// is no longer listening on it.
+func removeStale(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return ErrNotSocket
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return ErrAddrInUse
+	}
+	return os.Remove(path)
+}
+
+// Credentials of the process on the other end of a connection.
+type Credentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// Conn is a unix socket connection using the TCP packet framing.
+type Conn struct {
+	acceptor.Conn
+	cred    *Credentials
+	credErr error
+}
+
+// Unwrap returns the framed connection.
+func (c *Conn) Unwrap() acceptor.Conn {
+	return c.Conn
+}
+
+// PeerCredentials returns the credentials of the connected process, as read
+// when the connection was accepted.
+func (c *Conn) PeerCredentials() (*Credentials, error) {
+	return c.cred, c.credErr
+}
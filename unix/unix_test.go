@@ -0,0 +1,149 @@
+package unix
+
+import (
+	"fmt"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/acceptortest"
+	"github.com/gotechbook/gotechbook-framework-acceptor/tcp"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustConnectToUnix(t *testing.T, a *Unix) net.Conn {
+	t.Helper()
+	var conn net.Conn
+	var err error
+	// should be able to connect within 100 milliseconds
+	utils.ShouldEventuallyReturn(t, func() error {
+		conn, err = net.Dial("unix", a.path)
+		return err
+	}, nil, 10*time.Millisecond, 100*time.Millisecond)
+	return conn
+}
+
+func TestNewUnix(t *testing.T) {
+	t.Parallel()
+	a := NewUnix("/tmp/acceptor.sock", NewDefaultConfig())
+	assert.NotNil(t, a)
+	assert.NotNil(t, a.GetConnChan())
+	// returns nothing because not listening yet
+	assert.Equal(t, "", a.GetAddr())
+	assert.Equal(t, -1, a.config.UID)
+	assert.Equal(t, -1, a.config.GID)
+}
+
+func TestListenAndServe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acceptor.sock")
+	config := NewDefaultConfig()
+	config.Mode = 0600
+	a := NewUnix(path, config)
+	go a.ListenAndServe()
+	conn := mustConnectToUnix(t, a)
+	defer conn.Close()
+	assert.Equal(t, path, a.GetAddr())
+
+	fi, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	// the directory the socket was created in is gone
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	playerConn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	msg := []byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x02}
+	_, err = conn.Write(msg)
+	assert.NoError(t, err)
+	b, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg, b)
+
+	assert.NoError(t, playerConn.WritePacket(acceptor.Data, []byte{0x03}))
+	reply := make([]byte, 5)
+	_, err = conn.Read(reply)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x03}, reply)
+
+	a.Stop()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestListenAndServeRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acceptor.sock")
+	l, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	// leave the socket file behind like a crashed process would
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	a := NewUnix(path, NewDefaultConfig())
+	go a.ListenAndServe()
+	defer a.Stop()
+	conn := mustConnectToUnix(t, a)
+	defer conn.Close()
+	assert.NotNil(t, utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond))
+}
+
+func TestRemoveStale(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "file")
+	assert.NoError(t, os.WriteFile(file, nil, 0600))
+	assert.Equal(t, ErrNotSocket, removeStale(file))
+
+	inUse := filepath.Join(dir, "in-use.sock")
+	l, err := net.Listen("unix", inUse)
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, ErrAddrInUse, removeStale(inUse))
+
+	assert.NoError(t, removeStale(filepath.Join(dir, "missing.sock")))
+}
+
+func TestPeerCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acceptor.sock")
+	a := NewUnix(path, NewDefaultConfig())
+	go a.ListenAndServe()
+	defer a.Stop()
+	conn := mustConnectToUnix(t, a)
+	defer conn.Close()
+
+	playerConn := utils.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*Conn)
+	cred, err := playerConn.PeerCredentials()
+	if runtime.GOOS != "linux" {
+		assert.Equal(t, ErrPeerCredUnsupported, err)
+		return
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, int32(os.Getpid()), cred.PID)
+	assert.Equal(t, uint32(os.Getuid()), cred.UID)
+	assert.Equal(t, uint32(os.Getgid()), cred.GID)
+}
+
+func TestConformance(t *testing.T) {
+	dir := t.TempDir()
+	n := 0
+	acceptortest.Run(t, acceptortest.Factory{
+		New: func() acceptor.Acceptor {
+			n++
+			return NewUnix(filepath.Join(dir, fmt.Sprintf("acceptor-%d.sock", n)), NewDefaultConfig())
+		},
+		Dial: func(addr string) (acceptor.Conn, error) {
+			conn, err := net.Dial("unix", addr)
+			if err != nil {
+				return nil, err
+			}
+			return tcp.NewConn(conn), nil
+		},
+		Stream: true,
+	})
+}
@@ -0,0 +1,85 @@
+package acceptor
+
+import "sync"
+
+var _ Acceptor = (*WrapAcceptor)(nil)
+
+// WrapAcceptor delivers the connections of an inner Acceptor on its own
+// channel after passing each of them through a wrap function, it is the base
+// of the acceptors adding a layer to the connections of another one.
+type WrapAcceptor struct {
+	// OnDeliver is called with every connection taken from GetConnChan, and
+	// OnDrop with every wrapped connection dropped because the acceptor
+	// stopped first, before it is closed. Both are optional and must be set
+	// before ListenAndServe.
+	OnDeliver func(Conn)
+	OnDrop    func(Conn)
+
+	acceptor Acceptor
+	wrap     func(n int, conn Conn) (Conn, error)
+	connChan chan Conn
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewWrapAcceptor wraps the connections of a with wrap, which runs in a
+// goroutine of its own for every connection. n numbers the connections in the
+// order a accepted them, from zero. Connections for which wrap fails are
+// closed and dropped, and a nil connection without error tells wrap took the
+// connection over, nothing is delivered then.
+func NewWrapAcceptor(a Acceptor, wrap func(n int, conn Conn) (Conn, error)) *WrapAcceptor {
+	return &WrapAcceptor{
+		acceptor: a,
+		wrap:     wrap,
+		connChan: make(chan Conn),
+		stopChan: make(chan struct{}),
+	}
+}
+func (w *WrapAcceptor) ListenAndServe() {
+	go w.dispatch()
+	w.acceptor.ListenAndServe()
+}
+func (w *WrapAcceptor) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+	})
+	w.acceptor.Stop()
+}
+func (w *WrapAcceptor) GetAddr() string {
+	return w.acceptor.GetAddr()
+}
+func (w *WrapAcceptor) GetConnChan() chan Conn {
+	return w.connChan
+}
+func (w *WrapAcceptor) dispatch() {
+	in := w.acceptor.GetConnChan()
+	for n := 0; ; n++ {
+		select {
+		case conn := <-in:
+			go w.handle(n, conn)
+		case <-w.stopChan:
+			return
+		}
+	}
+}
+func (w *WrapAcceptor) handle(n int, conn Conn) {
+	wrapped, err := w.wrap(n, conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if wrapped == nil {
+		return
+	}
+	select {
+	case w.connChan <- wrapped:
+		if w.OnDeliver != nil {
+			w.OnDeliver(wrapped)
+		}
+	case <-w.stopChan:
+		if w.OnDrop != nil {
+			w.OnDrop(wrapped)
+		}
+		wrapped.Close()
+	}
+}
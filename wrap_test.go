@@ -0,0 +1,76 @@
+package acceptor
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapAcceptor(t *testing.T) {
+	inner := newChanAcceptor()
+	taken := make(chan Conn, 1)
+	w := NewWrapAcceptor(inner, func(n int, conn Conn) (Conn, error) {
+		switch n {
+		case 0:
+			return conn, nil
+		case 1:
+			taken <- conn
+			return nil, nil
+		default:
+			return nil, errors.New("rejected")
+		}
+	})
+	delivered := make(chan Conn, 1)
+	w.OnDeliver = func(conn Conn) { delivered <- conn }
+	go w.ListenAndServe()
+	defer w.Stop()
+	assert.Equal(t, "chan", w.GetAddr())
+
+	var clients []*pipeConn
+	for i := 0; i < 3; i++ {
+		server, client := newPipeConns()
+		defer client.Close()
+		clients = append(clients, client)
+		inner.connChan <- server
+	}
+	select {
+	case conn := <-w.GetConnChan():
+		assert.Equal(t, conn, <-delivered)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("connection not delivered")
+	}
+	select {
+	case <-taken:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("connection not taken over")
+	}
+	// the rejected connection is closed
+	_, err := clients[2].Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestWrapAcceptorStop(t *testing.T) {
+	inner := newChanAcceptor()
+	w := NewWrapAcceptor(inner, func(_ int, conn Conn) (Conn, error) {
+		return conn, nil
+	})
+	dropped := make(chan Conn, 1)
+	w.OnDrop = func(conn Conn) { dropped <- conn }
+	go w.ListenAndServe()
+
+	server, client := newPipeConns()
+	defer client.Close()
+	inner.connChan <- server
+	w.Stop()
+	select {
+	case conn := <-dropped:
+		assert.Equal(t, server, conn)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("connection not dropped")
+	}
+	_, err := client.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
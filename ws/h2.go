@@ -0,0 +1,154 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/gorilla/websocket"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// isExtendedConnect reports whether r opens a websocket over an HTTP/2
+// stream, as defined by RFC 8441.
+func isExtendedConnect(r *http.Request) bool {
+	return r.ProtoMajor == 2 && r.Method == http.MethodConnect && r.Header.Get(":protocol") == "websocket"
+}
+
+// upgradeExtendedConnect upgrades an RFC 8441 extended CONNECT stream.
+//
+// The upgrader only knows HTTP/1.1, so it gets the equivalent upgrade request
+// and the stream as hijacked connection. The 101 response it writes is turned
+// into the 200 response of the CONNECT.
+func upgradeExtendedConnect(up *websocket.Upgrader, rw http.ResponseWriter, r *http.Request) (*websocket.Conn, *h2Conn, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	req := r.Clone(r.Context())
+	req.Method = http.MethodGet
+	req.Header.Del(":protocol")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-Websocket-Key", base64.StdEncoding.EncodeToString(key))
+	c := &h2Conn{
+		body:   r.Body,
+		rw:     rw,
+		rc:     http.NewResponseController(rw),
+		local:  localAddr(r),
+		remote: remoteAddr(r),
+		done:   make(chan struct{}),
+	}
+	conn, err := up.Upgrade(&h2Hijacker{ResponseWriter: rw, conn: c}, req, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, c, nil
+}
+
+// h2Hijacker hands the stream to the upgrader as hijacked connection.
+type h2Hijacker struct {
+	http.ResponseWriter
+	conn *h2Conn
+}
+
+func (h *h2Hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.conn, bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriter(h.conn)), nil
+}
+
+var errHandshakeResponse = errors.New("ws: invalid handshake response")
+
+// h2Conn is the net.Conn of a websocket carried by an HTTP/2 stream. The
+// stream lives as long as its handler, so the handler waits for done.
+type h2Conn struct {
+	body        io.ReadCloser
+	rw          http.ResponseWriter
+	rc          *http.ResponseController
+	local       net.Addr
+	remote      net.Addr
+	wroteHeader bool
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+func (c *h2Conn) Read(b []byte) (int, error) {
+	return c.body.Read(b)
+}
+
+// Write sends b on the stream. The first write is the handshake response of
+// the upgrader, it becomes the response headers of the CONNECT.
+func (c *h2Conn) Write(b []byte) (int, error) {
+	n := len(b)
+	if !c.wroteHeader {
+		end := bytes.Index(b, []byte("\r\n\r\n"))
+		if end < 0 {
+			return 0, errHandshakeResponse
+		}
+		for _, line := range bytes.Split(b[:end], []byte("\r\n"))[1:] {
+			k, v, ok := bytes.Cut(line, []byte(": "))
+			if !ok {
+				return 0, errHandshakeResponse
+			}
+			// only the headers that make sense without the upgrade are kept
+			if http.CanonicalHeaderKey(string(k)) == "Sec-Websocket-Protocol" {
+				c.rw.Header().Set(string(k), string(v))
+			}
+		}
+		c.rw.WriteHeader(http.StatusOK)
+		c.wroteHeader = true
+		b = b[end+4:]
+		if len(b) == 0 {
+			return n, c.rc.Flush()
+		}
+	}
+	if _, err := c.rw.Write(b); err != nil {
+		return 0, err
+	}
+	if err := c.rc.Flush(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+func (c *h2Conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.body.Close()
+	})
+	return nil
+}
+func (c *h2Conn) LocalAddr() net.Addr {
+	return c.local
+}
+func (c *h2Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+func (c *h2Conn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+func (c *h2Conn) SetReadDeadline(t time.Time) error {
+	return c.rc.SetReadDeadline(t)
+}
+func (c *h2Conn) SetWriteDeadline(t time.Time) error {
+	return c.rc.SetWriteDeadline(t)
+}
+
+func localAddr(r *http.Request) net.Addr {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
+func remoteAddr(r *http.Request) net.Addr {
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
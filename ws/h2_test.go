@@ -0,0 +1,239 @@
+package ws
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"github.com/gorilla/websocket"
+	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	utils "github.com/gotechbook/gotechbook-framework-utils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// h2Stream is the client side of a websocket over an HTTP/2 stream. The
+// request is written frame by frame: the http2 transport writes :protocol in
+// the order of the header map, after regular headers every other time, which
+// the server refuses as a protocol error.
+type h2Stream struct {
+	conn   net.Conn
+	framer *http2.Framer
+	mu     sync.Mutex
+	status string
+	body   *io.PipeReader
+}
+
+const h2StreamID = 1
+
+func mustConnectToWSOverH2(t *testing.T, w *WS, tlsEnabled bool) *h2Stream {
+	t.Helper()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return w.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	scheme := "http"
+	conn, err := net.Dial("tcp", w.GetAddr())
+	if tlsEnabled {
+		scheme = "https"
+		conn, err = tls.Dial("tcp", w.GetAddr(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{http2.NextProtoTLS}})
+	}
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte(http2.ClientPreface))
+	assert.NoError(t, err)
+	framer := http2.NewFramer(conn, conn)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	assert.NoError(t, framer.WriteSettings())
+
+	// extended CONNECT may only be used once the server allowed it
+	for {
+		f, err := framer.ReadFrame()
+		if !assert.NoError(t, err) {
+			break
+		}
+		if settings, ok := f.(*http2.SettingsFrame); ok && !settings.IsAck() {
+			v, _ := settings.Value(http2.SettingEnableConnectProtocol)
+			assert.Equal(t, uint32(1), v)
+			assert.NoError(t, framer.WriteSettingsAck())
+			break
+		}
+	}
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	for _, f := range []hpack.HeaderField{
+		{Name: ":method", Value: http.MethodConnect},
+		{Name: ":protocol", Value: "websocket"},
+		{Name: ":scheme", Value: scheme},
+		{Name: ":path", Value: "/"},
+		{Name: ":authority", Value: w.GetAddr()},
+		{Name: "sec-websocket-version", Value: "13"},
+	} {
+		assert.NoError(t, enc.WriteField(f))
+	}
+	assert.NoError(t, framer.WriteHeaders(http2.HeadersFrameParam{StreamID: h2StreamID, BlockFragment: block.Bytes(), EndHeaders: true}))
+
+	pr, pw := io.Pipe()
+	s := &h2Stream{conn: conn, framer: framer, body: pr}
+	for s.status == "" {
+		f, err := framer.ReadFrame()
+		if !assert.NoError(t, err) {
+			break
+		}
+		s.handle(f)
+	}
+	assert.Equal(t, "200", s.status)
+	go func() {
+		for {
+			f, err := framer.ReadFrame()
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			data, ended, err := s.handle(f)
+			if len(data) > 0 {
+				pw.Write(data)
+			}
+			if ended {
+				pw.Close()
+			} else if err != nil {
+				pw.CloseWithError(err)
+			}
+		}
+	}()
+	return s
+}
+
+// handle takes a frame read from the server and returns the data it carries
+// for the stream, whether the stream ended and the error it was reset with.
+func (s *h2Stream) handle(f http2.Frame) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch f := f.(type) {
+	case *http2.MetaHeadersFrame:
+		if f.StreamID == h2StreamID {
+			s.status = f.PseudoValue("status")
+		}
+	case *http2.DataFrame:
+		if f.StreamID != h2StreamID {
+			return nil, false, nil
+		}
+		if n := uint32(len(f.Data())); n > 0 {
+			s.framer.WriteWindowUpdate(0, n)
+			s.framer.WriteWindowUpdate(h2StreamID, n)
+		}
+		return f.Data(), f.StreamEnded(), nil
+	case *http2.SettingsFrame:
+		if !f.IsAck() {
+			s.framer.WriteSettingsAck()
+		}
+	case *http2.PingFrame:
+		if !f.IsAck() {
+			s.framer.WritePing(true, f.Data)
+		}
+	case *http2.RSTStreamFrame:
+		if f.StreamID == h2StreamID {
+			return nil, false, http2.StreamError{StreamID: f.StreamID, Code: f.ErrCode}
+		}
+	case *http2.GoAwayFrame:
+		return nil, false, http2.ConnectionError(f.ErrCode)
+	}
+	return nil, false, nil
+}
+
+// writeMessage sends a masked binary frame.
+func (s *h2Stream) writeMessage(b []byte) error {
+	return s.writeFrame(websocket.BinaryMessage, b)
+}
+func (s *h2Stream) writeFrame(opcode int, b []byte) error {
+	frame := []byte{0x80 | byte(opcode), 0x80 | byte(len(b)), 0x01, 0x02, 0x03, 0x04}
+	for i, c := range b {
+		frame = append(frame, c^frame[2+i%4])
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.framer.WriteData(h2StreamID, false, frame)
+}
+func (s *h2Stream) readMessage() (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(s.body, header); err != nil {
+		return 0, nil, err
+	}
+	size := int(header[1] & 0x7f)
+	if size == 126 {
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(s.body, ext); err != nil {
+			return 0, nil, err
+		}
+		size = int(binary.BigEndian.Uint16(ext))
+	}
+	b := make([]byte, size)
+	_, err := io.ReadFull(s.body, b)
+	return header[0] & 0x0f, b, err
+}
+func (s *h2Stream) Close() {
+	s.conn.Close()
+}
+
+func TestWSOverH2(t *testing.T) {
+	for _, tlsEnabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("tls_%v", tlsEnabled), func(t *testing.T) {
+			w := NewWS("127.0.0.1:0")
+			if tlsEnabled {
+				w = NewWS("127.0.0.1:0", "../fixtures/server.crt", "../fixtures/server.key")
+			}
+			c := w.GetConnChan()
+			defer w.Stop()
+			go w.ListenAndServe()
+
+			stream := mustConnectToWSOverH2(t, w, tlsEnabled)
+			defer stream.Close()
+			conn := utils.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(*Conn)
+			defer conn.Close()
+
+			assert.NoError(t, stream.writeMessage([]byte{0x04, 0x00, 0x00, 0x01, 0x01}))
+			p, err := conn.ReadPacket()
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{0x01}, p.Data)
+
+			assert.NoError(t, conn.WritePacket(acceptor.Data, []byte{0x02}))
+			opcode, msg, err := stream.readMessage()
+			assert.NoError(t, err)
+			assert.Equal(t, byte(websocket.BinaryMessage), opcode)
+			assert.Equal(t, []byte{0x04, 0x00, 0x00, 0x01, 0x02}, msg)
+		})
+	}
+}
+
+func TestWSOverH2SendKick(t *testing.T) {
+	w := NewWS("127.0.0.1:0")
+	c := w.GetConnChan()
+	defer w.Stop()
+	go w.ListenAndServe()
+
+	stream := mustConnectToWSOverH2(t, w, false)
+	defer stream.Close()
+	playerConn := utils.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(*Conn)
+	done := make(chan error)
+	go func() {
+		done <- acceptor.SendKick(playerConn, &acceptor.KickReason{Code: acceptor.KickCodeKicked})
+	}()
+
+	_, msg, err := stream.readMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(acceptor.Kick), msg[0])
+	opcode, _, err := stream.readMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(websocket.CloseMessage), opcode)
+
+	// the stream ends once the server closed the connection
+	assert.NoError(t, stream.writeFrame(websocket.CloseMessage, nil))
+	assert.NoError(t, <-done)
+	_, err = io.ReadAll(stream.body)
+	assert.NoError(t, err)
+}
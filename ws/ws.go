@@ -1,25 +1,35 @@
 package ws
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"github.com/gorilla/websocket"
 	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/proxyproto"
 	logger "github.com/gotechbook/gotechbook-framework-logger"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"io"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 )
 
 var _ acceptor.Acceptor = (*WS)(nil)
 var _ acceptor.Conn = (*Conn)(nil)
 
+var codec = acceptor.NewPacketCodec()
+
 type WS struct {
 	addr     string
 	connChan chan acceptor.Conn
+	mu       sync.Mutex
 	listener net.Listener
 	certFile string
 	keyFile  string
+	proxy    *proxyproto.Config
 }
 
 func NewWS(addr string, certs ...string) *WS {
@@ -40,6 +50,12 @@ func NewWS(addr string, certs ...string) *WS {
 	return w
 }
 
+// UseProxyProtocol makes the acceptor read the PROXY protocol header of the
+// connections from the proxies of config, before TLS and the upgrade, so
+// RemoteAddr reports the client. It must be called before ListenAndServe.
+func (w *WS) UseProxyProtocol(config proxyproto.Config) {
+	w.proxy = &config
+}
 func (w *WS) ListenAndServe() {
 	if w.hasTLSCertificates() {
 		w.ListenAndServeTLS(w.certFile, w.keyFile)
@@ -52,20 +68,37 @@ func (w *WS) ListenAndServe() {
 			return true
 		},
 	}
-	listener, err := net.Listen("tcp", w.addr)
-	if err != nil {
-		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	w.setListener(w.listen())
+	w.serve(&up)
+}
+
+// Serve accepts the connections of listener, so the acceptor can share a port
+// with other protocols. TLS, if any, is up to the listener.
+func (w *WS) Serve(listener net.Listener) {
+	var up = websocket.Upgrader{
+		ReadBufferSize:  acceptor.IOBufferBytesSize,
+		WriteBufferSize: acceptor.IOBufferBytesSize,
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
 	}
-	w.listener = listener
+	w.setListener(listener)
 	w.serve(&up)
 }
 func (w *WS) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.listener == nil {
+		return
+	}
 	err := w.listener.Close()
 	if err != nil {
 		logger.Log.Errorf("Failed to stop: %s", err.Error())
 	}
 }
 func (w *WS) GetAddr() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	if w.listener != nil {
 		return w.listener.Addr().String()
 	}
@@ -85,57 +118,176 @@ func (w *WS) ListenAndServeTLS(cert, key string) {
 		logger.Log.Fatalf("Failed to load x509: %s", err.Error())
 	}
 
-	tlsCfg := &tls.Config{Certificates: []tls.Certificate{crt}}
-	listener, err := tls.Listen("tcp", w.addr, tlsCfg)
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{crt},
+		NextProtos:   []string{http2.NextProtoTLS, "http/1.1"},
+	}
+	w.setListener(tls.NewListener(w.listen(), tlsCfg))
+	w.serve(&up)
+}
+func (w *WS) listen() net.Listener {
+	listener, err := net.Listen("tcp", w.addr)
 	if err != nil {
 		logger.Log.Fatalf("Failed to listen: %s", err.Error())
 	}
-	w.listener = listener
-	w.serve(&up)
+	if w.proxy != nil {
+		return proxyproto.NewListener(listener, *w.proxy)
+	}
+	return listener
 }
+
+// serve accepts HTTP/1.1 upgrades as well as RFC 8441 extended CONNECT
+// streams over HTTP/2, negotiated with ALPN or as cleartext h2c.
 func (w *WS) serve(up *websocket.Upgrader) {
 	defer w.Stop()
-	http.Serve(w.listener, &connHandler{
-		up:       up,
-		connChan: w.connChan,
-	})
+	h2 := &http2.Server{}
+	srv := &http.Server{
+		Handler: h2c.NewHandler(&connHandler{
+			up:       up,
+			connChan: w.connChan,
+		}, h2),
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, netConnKey{}, conn)
+		},
+	}
+	if err := http2.ConfigureServer(srv, h2); err != nil {
+		logger.Log.Errorf("Failed to configure HTTP/2: %s", err.Error())
+	}
+	w.mu.Lock()
+	listener := w.listener
+	w.mu.Unlock()
+	srv.Serve(listener)
+}
+func (w *WS) setListener(listener net.Listener) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listener = listener
 }
 func (w *WS) hasTLSCertificates() bool {
 	return w.certFile != "" && w.keyFile != ""
 }
 
 type Conn struct {
-	conn   *websocket.Conn
-	typ    int
-	reader io.Reader
+	conn    *websocket.Conn
+	proxy   *proxyproto.Conn
+	typ     int
+	reader  io.Reader
+	pending chan readResult
+	writeMu sync.Mutex
+}
+
+type readResult struct {
+	b   []byte
+	err error
 }
 
 func NewWSConn(conn *websocket.Conn) (*Conn, error) {
 	c := &Conn{conn: conn}
+	// a message never holds more than one packet
+	conn.SetReadLimit(acceptor.HeadLength + acceptor.MaxPacketSize)
 	return c, nil
 }
 func (c *Conn) GetNextMessage() (b []byte, err error) {
-	_, msgBytes, err := c.conn.ReadMessage()
+	b, _, err = c.readMessage()
+	return b, err
+}
+func (c *Conn) ReadPacket() (*acceptor.Packet, error) {
+	b, typ, err := c.readMessage()
 	if err != nil {
 		return nil, err
 	}
+	return &acceptor.Packet{Type: typ, Length: len(b) - acceptor.HeadLength, Data: b[acceptor.HeadLength:]}, nil
+}
+func (c *Conn) WritePacket(typ acceptor.Type, data []byte) error {
+	b, err := codec.Encode(typ, data)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(websocket.BinaryMessage, b)
+}
+func (c *Conn) readMessage() ([]byte, acceptor.Type, error) {
+	if c.pending != nil {
+		r := <-c.pending
+		c.pending = nil
+		return c.checkMessage(r.b, r.err)
+	}
+	_, msgBytes, err := c.conn.ReadMessage()
+	return c.checkMessage(msgBytes, err)
+}
+
+// GetNextMessageContext works like GetNextMessage but returns ctx.Err() as soon
+// as ctx is done. A websocket read can't be interrupted without breaking the
+// connection, so the read keeps going and its message is returned by the next
+// read, whichever method it goes through.
+func (c *Conn) GetNextMessageContext(ctx context.Context) (b []byte, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.pending == nil {
+		// the read in flight discards the rest of the message Read was on
+		c.reader = nil
+		c.pending = make(chan readResult, 1)
+		go func(ch chan<- readResult) {
+			_, msgBytes, err := c.conn.ReadMessage()
+			ch <- readResult{b: msgBytes, err: err}
+		}(c.pending)
+	}
+	select {
+	case r := <-c.pending:
+		c.pending = nil
+		b, _, err = c.checkMessage(r.b, r.err)
+		return b, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+func (c *Conn) checkMessage(msgBytes []byte, err error) ([]byte, acceptor.Type, error) {
+	if isClosed(err) {
+		return nil, 0, acceptor.ErrConnectionClosed
+	}
+	if err == websocket.ErrReadLimit {
+		return nil, 0, acceptor.ErrPacketSizeExceed
+	}
+	if err != nil {
+		return nil, 0, err
+	}
 	if len(msgBytes) < acceptor.HeadLength {
-		return nil, acceptor.ErrInvalidHeader
+		return nil, 0, acceptor.ErrInvalidHeader
 	}
 	header := msgBytes[:acceptor.HeadLength]
-	msgSize, _, err := acceptor.ParseHeader(header)
+	msgSize, typ, err := acceptor.ParseHeader(header)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	dataLen := len(msgBytes[acceptor.HeadLength:])
 	if dataLen < msgSize {
-		return nil, acceptor.ErrReceivedMsgSmallerThanExpected
+		return nil, 0, acceptor.ErrReceivedMsgSmallerThanExpected
 	} else if dataLen > msgSize {
-		return nil, acceptor.ErrReceivedMsgBiggerThanExpected
+		return nil, 0, acceptor.ErrReceivedMsgBiggerThanExpected
 	}
-	return msgBytes, err
+	return msgBytes, typ, nil
+}
+
+// isClosed reports whether err tells the peer closed the connection, with a
+// close frame or not.
+func isClosed(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	return websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway,
+		websocket.CloseNoStatusReceived, websocket.CloseAbnormalClosure)
 }
 func (c *Conn) Read(b []byte) (int, error) {
+	if c.pending != nil {
+		r := <-c.pending
+		c.pending = nil
+		if r.err != nil {
+			return 0, r.err
+		}
+		c.reader = bytes.NewReader(r.b)
+	}
 	if c.reader == nil {
 		t, r, err := c.conn.NextReader()
 		if err != nil {
@@ -157,6 +309,8 @@ func (c *Conn) Read(b []byte) (int, error) {
 	return n, nil
 }
 func (c *Conn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
 	err := c.conn.WriteMessage(websocket.BinaryMessage, b)
 	if err != nil {
 		return 0, err
@@ -164,6 +318,13 @@ func (c *Conn) Write(b []byte) (int, error) {
 
 	return len(b), nil
 }
+
+// CloseWrite sends a close frame to the client, after which nothing else can
+// be written. Reads continue until the client answers with its close frame.
+func (c *Conn) CloseWrite() error {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	return c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
 func (c *Conn) Close() error {
 	return c.conn.Close()
 }
@@ -173,6 +334,15 @@ func (c *Conn) LocalAddr() net.Addr {
 func (c *Conn) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
 }
+
+// ProxyHeader returns the PROXY protocol header the connection started with,
+// nil if it didn't come from a trusted proxy.
+func (c *Conn) ProxyHeader() (*proxyproto.Header, error) {
+	if c.proxy == nil {
+		return nil, nil
+	}
+	return c.proxy.ProxyHeader()
+}
 func (c *Conn) SetDeadline(t time.Time) error {
 	if err := c.SetReadDeadline(t); err != nil {
 		return err
@@ -186,12 +356,29 @@ func (c *Conn) SetWriteDeadline(t time.Time) error {
 	return c.conn.SetWriteDeadline(t)
 }
 
+// netConnKey is the context key of the connection a request came on.
+type netConnKey struct{}
+
 type connHandler struct {
 	up       *websocket.Upgrader
 	connChan chan acceptor.Conn
 }
 
+// proxyConn returns the connection from a trusted proxy r came on, if any.
+func proxyConn(r *http.Request) *proxyproto.Conn {
+	if conn, ok := r.Context().Value(netConnKey{}).(net.Conn); ok {
+		if c, ok := proxyproto.FromConn(conn); ok {
+			return c
+		}
+	}
+	return nil
+}
+
 func (h *connHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if isExtendedConnect(r) {
+		h.serveExtendedConnect(rw, r)
+		return
+	}
 	conn, err := h.up.Upgrade(rw, r, nil)
 	if err != nil {
 		logger.Log.Errorf("Upgrade failure, URI=%s, Error=%s", r.RequestURI, err.Error())
@@ -203,5 +390,29 @@ func (h *connHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		logger.Log.Errorf("Failed to create new ws connection: %s", err.Error())
 		return
 	}
+	c.proxy = proxyConn(r)
+	h.connChan <- c
+}
+
+// serveExtendedConnect keeps the handler, and so the stream, alive until the
+// connection is closed.
+func (h *connHandler) serveExtendedConnect(rw http.ResponseWriter, r *http.Request) {
+	conn, stream, err := upgradeExtendedConnect(h.up, rw, r)
+	if err != nil {
+		logger.Log.Errorf("Upgrade failure, URI=%s, Error=%s", r.RequestURI, err.Error())
+		return
+	}
+	c, err := NewWSConn(conn)
+	if err != nil {
+		logger.Log.Errorf("Failed to create new ws connection: %s", err.Error())
+		conn.Close()
+		return
+	}
+	c.proxy = proxyConn(r)
 	h.connChan <- c
+	select {
+	case <-stream.done:
+	case <-r.Context().Done():
+		conn.Close()
+	}
 }
@@ -1,12 +1,16 @@
 package ws
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"github.com/gorilla/websocket"
 	acceptor "github.com/gotechbook/gotechbook-framework-acceptor"
+	"github.com/gotechbook/gotechbook-framework-acceptor/acceptortest"
+	"github.com/gotechbook/gotechbook-framework-acceptor/proxyproto"
 	utils "github.com/gotechbook/gotechbook-framework-utils"
 	"github.com/stretchr/testify/assert"
+	"net"
 	"testing"
 	"time"
 )
@@ -259,6 +263,69 @@ func TestWSGetNextMessage(t *testing.T) {
 	}
 }
 
+func TestWSGetNextMessageTooBig(t *testing.T) {
+	w := NewWS("127.0.0.1:0")
+	c := w.GetConnChan()
+	defer w.Stop()
+	go w.ListenAndServe()
+	utils.ShouldEventuallyReturn(t, func() bool {
+		return w.GetAddr() != ""
+	}, true, time.Millisecond, 100*time.Millisecond)
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+w.GetAddr(), nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	playerConn := utils.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(*Conn)
+	defer playerConn.Close()
+
+	go conn.WriteMessage(websocket.BinaryMessage, make([]byte, acceptor.HeadLength+acceptor.MaxPacketSize+1))
+	_, err = playerConn.GetNextMessage()
+	assert.Equal(t, acceptor.ErrPacketSizeExceed, err)
+}
+
+func FuzzWSGetNextMessage(f *testing.F) {
+	f.Add([]byte{0x02, 0x00, 0x00, 0x01, 0x00})
+	f.Add([]byte{0x02, 0x00, 0x00, 0x02, 0x00})
+	f.Add([]byte{0x02, 0x00, 0x00, 0x00, 0x00})
+	f.Add([]byte{0x00, 0x00, 0x00, 0x00})
+	f.Add([]byte{0x02, 0x00})
+	f.Add([]byte{})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		f.Fatal(err)
+	}
+	w := NewWS("127.0.0.1:0")
+	defer w.Stop()
+	go w.Serve(listener)
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+listener.Addr().String(), nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer conn.Close()
+	playerConn := (<-w.GetConnChan()).(*Conn)
+	defer playerConn.Close()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, data))
+		msg, err := playerConn.GetNextMessage()
+		// a message is accepted when it is exactly one packet
+		packets, decodeErr := codec.Decode(data)
+		switch {
+		case len(data) < acceptor.HeadLength:
+			assert.Equal(t, acceptor.ErrInvalidHeader, err)
+		case decodeErr != nil && len(packets) == 0:
+			assert.Equal(t, decodeErr, err)
+		case len(packets) == 0:
+			assert.Equal(t, acceptor.ErrReceivedMsgSmallerThanExpected, err)
+		case acceptor.HeadLength+packets[0].Length < len(data):
+			assert.Equal(t, acceptor.ErrReceivedMsgBiggerThanExpected, err)
+		default:
+			assert.NoError(t, err)
+			assert.Equal(t, data, msg)
+		}
+	})
+}
+
 func TestWSGetNextMessageSequentially(t *testing.T) {
 	w := NewWS("0.0.0.0:0")
 	c := w.GetConnChan()
@@ -289,3 +356,207 @@ func TestWSGetNextMessageSequentially(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, msg2, msg)
 }
+
+func TestWSGetNextMessageContextCancel(t *testing.T) {
+	w := NewWS("0.0.0.0:0")
+	c := w.GetConnChan()
+	defer w.Stop()
+	go w.ListenAndServe()
+
+	var conn *websocket.Conn
+	var err error
+	utils.ShouldEventuallyReturn(t, func() error {
+		addr := fmt.Sprintf("%s://%s", "ws", w.GetAddr())
+		dialer := websocket.DefaultDialer
+		conn, _, err = dialer.Dial(addr, nil)
+		return err
+	}, nil, 10*time.Millisecond, 100*time.Millisecond)
+
+	playerConn := utils.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(*Conn)
+	defer playerConn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = playerConn.GetNextMessageContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	msg1 := []byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x01}
+	err = conn.WriteMessage(websocket.BinaryMessage, msg1)
+	assert.NoError(t, err)
+	msg, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg1, msg)
+}
+
+func TestWSReadAfterGetNextMessageContextCancel(t *testing.T) {
+	w := NewWS("0.0.0.0:0")
+	c := w.GetConnChan()
+	defer w.Stop()
+	go w.ListenAndServe()
+
+	var conn *websocket.Conn
+	var err error
+	utils.ShouldEventuallyReturn(t, func() error {
+		addr := fmt.Sprintf("%s://%s", "ws", w.GetAddr())
+		dialer := websocket.DefaultDialer
+		conn, _, err = dialer.Dial(addr, nil)
+		return err
+	}, nil, 10*time.Millisecond, 100*time.Millisecond)
+
+	playerConn := utils.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(*Conn)
+	defer playerConn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = playerConn.GetNextMessageContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// Read gets the message of the read left in flight
+	msg1 := []byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x01}
+	msg2 := []byte{0x04, 0x00, 0x00, 0x01, 0x02}
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, msg1))
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, msg2))
+	b := make([]byte, len(msg1))
+	n, err := playerConn.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, msg1, b[:n])
+	msg, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg2, msg)
+}
+
+func TestWSReadAndWritePacket(t *testing.T) {
+	w := NewWS("0.0.0.0:0")
+	c := w.GetConnChan()
+	defer w.Stop()
+	go w.ListenAndServe()
+
+	var conn *websocket.Conn
+	var err error
+	utils.ShouldEventuallyReturn(t, func() error {
+		addr := fmt.Sprintf("%s://%s", "ws", w.GetAddr())
+		dialer := websocket.DefaultDialer
+		conn, _, err = dialer.Dial(addr, nil)
+		return err
+	}, nil, 10*time.Millisecond, 100*time.Millisecond)
+
+	playerConn := utils.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(*Conn)
+	defer playerConn.Close()
+	err = conn.WriteMessage(websocket.BinaryMessage, []byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x02})
+	assert.NoError(t, err)
+
+	p, err := playerConn.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, &acceptor.Packet{Type: acceptor.Data, Length: 2, Data: []byte{0x01, 0x02}}, p)
+
+	err = playerConn.WritePacket(acceptor.Kick, []byte{0x03})
+	assert.NoError(t, err)
+	_, msg, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x05, 0x00, 0x00, 0x01, 0x03}, msg)
+}
+
+func TestWSSendKick(t *testing.T) {
+	w := NewWS("0.0.0.0:0")
+	c := w.GetConnChan()
+	defer w.Stop()
+	go w.ListenAndServe()
+
+	var conn *websocket.Conn
+	var err error
+	utils.ShouldEventuallyReturn(t, func() error {
+		addr := fmt.Sprintf("%s://%s", "ws", w.GetAddr())
+		dialer := websocket.DefaultDialer
+		conn, _, err = dialer.Dial(addr, nil)
+		return err
+	}, nil, 10*time.Millisecond, 100*time.Millisecond)
+	defer conn.Close()
+
+	playerConn := utils.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(*Conn)
+	done := make(chan error)
+	go func() {
+		done <- acceptor.SendKick(playerConn, &acceptor.KickReason{Code: acceptor.KickCodeKicked})
+	}()
+
+	_, msg, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(acceptor.Kick), msg[0])
+	reason, err := acceptor.ParseKick(msg[acceptor.HeadLength:])
+	assert.NoError(t, err)
+	assert.Equal(t, acceptor.KickCodeKicked, reason.Code)
+
+	// the close frame follows the kick and is answered by the client
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure))
+	assert.NoError(t, <-done)
+}
+
+func TestWSProxyProtocol(t *testing.T) {
+	for _, protocol := range []string{"ws", "wss"} {
+		t.Run(protocol, func(t *testing.T) {
+			config := proxyproto.NewDefaultConfig()
+			config.TrustedCIDRs, _ = proxyproto.ParseCIDRs("127.0.0.0/8")
+			w := NewWS("127.0.0.1:0")
+			if protocol == "wss" {
+				w = NewWS("127.0.0.1:0", "../fixtures/server.crt", "../fixtures/server.key")
+			}
+			w.UseProxyProtocol(config)
+			defer w.Stop()
+			go w.ListenAndServe()
+
+			header, _ := (&proxyproto.Header{Version: 2, Command: proxyproto.Proxy,
+				Source:      &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 4242},
+				Destination: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 443},
+				TLVs:        []proxyproto.TLV{{Type: proxyproto.TypeUniqueID, Value: []byte("req-1")}},
+			}).Format()
+			dialer := websocket.Dialer{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				NetDial: func(network, addr string) (net.Conn, error) {
+					conn, err := net.Dial(network, addr)
+					if err == nil {
+						_, err = conn.Write(header)
+					}
+					return conn, err
+				},
+			}
+			var client *websocket.Conn
+			var err error
+			utils.ShouldEventuallyReturn(t, func() error {
+				client, _, err = dialer.Dial(fmt.Sprintf("%s://%s", protocol, w.GetAddr()), nil)
+				return err
+			}, nil, 10*time.Millisecond, 100*time.Millisecond)
+			defer client.Close()
+
+			conn := utils.ShouldEventuallyReceive(t, w.GetConnChan(), 100*time.Millisecond).(*Conn)
+			defer conn.Close()
+			assert.Equal(t, "203.0.113.7:4242", conn.RemoteAddr().String())
+			assert.Equal(t, "198.51.100.1:443", conn.LocalAddr().String())
+			h, err := conn.ProxyHeader()
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("req-1"), h.UniqueID())
+		})
+	}
+}
+
+func TestConformance(t *testing.T) {
+	for _, protocol := range []string{"ws", "wss"} {
+		t.Run(protocol, func(t *testing.T) {
+			acceptortest.Run(t, acceptortest.Factory{
+				New: func() acceptor.Acceptor {
+					if protocol == "wss" {
+						return NewWS("127.0.0.1:0", "../fixtures/server.crt", "../fixtures/server.key")
+					}
+					return NewWS("127.0.0.1:0")
+				},
+				Dial: func(addr string) (acceptor.Conn, error) {
+					dialer := websocket.Dialer{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+					conn, _, err := dialer.Dial(fmt.Sprintf("%s://%s", protocol, addr), nil)
+					if err != nil {
+						return nil, err
+					}
+					return NewWSConn(conn)
+				},
+			})
+		})
+	}
+}